@@ -0,0 +1,110 @@
+// Command dlq inspects and settles the dead-letter stream without the admin
+// API, e.g. while the service is down.
+//
+//	dlq list [-after seq] [-limit n]
+//	dlq show <seq>
+//	dlq edit <seq> <file>
+//	dlq replay <seq>
+//	dlq discard <seq>
+//
+// It reads NATS_URL like the server and prints entries as JSON. A replay
+// reaches only the consumer that gave up on the entry.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/configuration"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+)
+
+const usage = `usage:
+  dlq list [-after seq] [-limit n]
+  dlq show <seq>
+  dlq edit <seq> <file>    replace the payload with the file's content
+  dlq replay <seq>         hand the entry back to the consumer that gave up
+  dlq discard <seq>`
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		log.Fatal(usage)
+	}
+	command, args := os.Args[1], os.Args[2:]
+	if !slices.Contains([]string{"list", "show", "edit", "replay", "discard"}, command) {
+		log.Fatal(usage)
+	}
+
+	cfg := configuration.Load()
+	if _, _, err := services.ConnectNATS(cfg.NATSURL); err != nil {
+		log.Fatalf("Failed to connect to NATS: %v", err)
+	}
+
+	switch command {
+	case "list":
+		flags := flag.NewFlagSet("list", flag.ExitOnError)
+		after := flags.Uint64("after", 0, "list entries stored after this sequence")
+		limit := flags.Int("limit", 50, "entries to list")
+		_ = flags.Parse(args)
+
+		entries, total, err := services.ListDeadLetters(*after, *limit)
+		if err != nil {
+			log.Fatalf("List failed: %v", err)
+		}
+		printJSON(map[string]any{"entries": entries, "total": total})
+	case "show":
+		entry, err := services.GetDeadLetter(sequence(args, 1))
+		if err != nil {
+			log.Fatalf("Show failed: %v", err)
+		}
+		printJSON(entry)
+	case "edit":
+		seq := sequence(args, 2)
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			log.Fatalf("Failed to read the payload: %v", err)
+		}
+		entry, err := services.EditDeadLetter(seq, data)
+		if err != nil {
+			log.Fatalf("Edit failed: %v", err)
+		}
+		printJSON(entry)
+	case "replay":
+		seq := sequence(args, 1)
+		if err := services.ReplayDeadLetter(seq); err != nil {
+			log.Fatalf("Replay failed: %v", err)
+		}
+		log.Printf("Dead letter %d replayed", seq)
+	case "discard":
+		seq := sequence(args, 1)
+		if err := services.DiscardDeadLetter(seq); err != nil {
+			log.Fatalf("Discard failed: %v", err)
+		}
+		log.Printf("Dead letter %d discarded", seq)
+	}
+}
+
+// sequence parses the first of want arguments as a DLQ sequence
+func sequence(args []string, want int) uint64 {
+	if len(args) != want {
+		log.Fatal(usage)
+	}
+	seq, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil || seq == 0 {
+		log.Fatalf("invalid sequence %q", args[0])
+	}
+	return seq
+}
+
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatal(err)
+	}
+}
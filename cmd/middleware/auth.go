@@ -2,7 +2,10 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"log"
+	"sort"
 	"strings"
 
 	"github.com/coreos/go-oidc"
@@ -35,30 +38,135 @@ func RequireAuth() gin.HandlerFunc {
 			return
 		}
 
-		idToken, err := verifier.Verify(c.Request.Context(), tokenStr)
-		if err != nil {
-			log.Printf("[AUTH] VERIFY FAILED: %v", err)
-			c.AbortWithStatusJSON(401, gin.H{"error": "invalid token", "details": err.Error()})
-			return
+		if authenticate(c, tokenStr) {
+			c.Next()
 		}
+	}
+}
 
-		var claims struct {
-			Sub string `json:"sub"`
-			Azp string `json:"azp"`
+// RequireStreamAuth is RequireAuth for Server-Sent Events. Browsers'
+// EventSource cannot set headers, so the token may also be passed as
+// ?access_token=.
+func RequireStreamAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenStr := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if tokenStr == "" {
+			tokenStr = c.Query("access_token")
 		}
-		if err := idToken.Claims(&claims); err != nil {
-			c.AbortWithStatusJSON(401, gin.H{"error": "claim parse failed"})
+		if tokenStr == "" {
+			c.AbortWithStatusJSON(401, gin.H{"error": "missing auth"})
 			return
 		}
 
-		// Manually check azp == "frontend"
-		if claims.Azp != "frontend" {
-			log.Printf("[AUTH] REJECTED: azp=%s (expected 'frontend')", claims.Azp)
-			c.AbortWithStatusJSON(401, gin.H{"error": "invalid client"})
-			return
+		if authenticate(c, tokenStr) {
+			c.Next()
 		}
+	}
+}
+
+// authenticate verifies tokenStr and stores the user in the context. On
+// failure it aborts the request and returns false.
+func authenticate(c *gin.Context, tokenStr string) bool {
+	idToken, err := verifier.Verify(c.Request.Context(), tokenStr)
+	if err != nil {
+		log.Printf("[AUTH] VERIFY FAILED: %v", err)
+		c.AbortWithStatusJSON(401, gin.H{"error": "invalid token", "details": err.Error()})
+		return false
+	}
 
-		c.Set("user_id", claims.Sub)
+	var claims struct {
+		Sub         string `json:"sub"`
+		Azp         string `json:"azp"`
+		RealmAccess struct {
+			Roles []string `json:"roles"`
+		} `json:"realm_access"`
+		Organization json.RawMessage `json:"organization"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		c.AbortWithStatusJSON(401, gin.H{"error": "claim parse failed"})
+		return false
+	}
+
+	// Manually check azp == "frontend"
+	if claims.Azp != "frontend" {
+		log.Printf("[AUTH] REJECTED: azp=%s (expected 'frontend')", claims.Azp)
+		c.AbortWithStatusJSON(401, gin.H{"error": "invalid client"})
+		return false
+	}
+
+	c.Set("user_id", claims.Sub)
+	c.Set("roles", claims.RealmAccess.Roles)
+	c.Set("organizations", organizations(claims.Organization))
+	return true
+}
+
+// organizations reads Keycloak's organization claim, which is a list of
+// aliases or, with organization attributes mapped, an object keyed by alias
+func organizations(claim json.RawMessage) []string {
+	var aliases []string
+	if json.Unmarshal(claim, &aliases) == nil {
+		return aliases
+	}
+	var byAlias map[string]json.RawMessage
+	if json.Unmarshal(claim, &byAlias) == nil {
+		for alias := range byAlias {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+	}
+	return aliases
+}
+
+// Organizations returns the organizations of the authenticated user
+func Organizations(c *gin.Context) []string {
+	organizations, _ := c.Get("organizations")
+	list, _ := organizations.([]string)
+	return list
+}
+
+// RequireRole only lets through users holding the given Keycloak realm role.
+// It must run after RequireAuth.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasRole(c, role) {
+			c.AbortWithStatusJSON(403, gin.H{"error": "forbidden"})
+			return
+		}
 		c.Next()
 	}
 }
+
+func HasRole(c *gin.Context, role string) bool {
+	roles, _ := c.Get("roles")
+	list, _ := roles.([]string)
+	for _, r := range list {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyServiceToken verifies a Keycloak client-credentials token and
+// returns the client it was issued to. It is used by callers that are other
+// services rather than users.
+func VerifyServiceToken(ctx context.Context, tokenStr string) (string, error) {
+	if verifier == nil {
+		return "", errors.New("auth not initialized")
+	}
+	idToken, err := verifier.Verify(ctx, tokenStr)
+	if err != nil {
+		return "", err
+	}
+
+	var claims struct {
+		Azp string `json:"azp"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return "", err
+	}
+	if claims.Azp == "" {
+		return "", errors.New("token names no client")
+	}
+	return claims.Azp, nil
+}
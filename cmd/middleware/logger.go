@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redactedParams are query parameters that carry credentials
+var redactedParams = []string{"access_token"}
+
+// Logger is gin's access log with credentials removed from the query
+// string; RequireStreamAuth accepts the bearer token as ?access_token=.
+func Logger() gin.HandlerFunc {
+	return gin.LoggerWithConfig(gin.LoggerConfig{
+		Formatter: func(param gin.LogFormatterParams) string {
+			return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+				param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+				param.StatusCode,
+				param.Latency,
+				param.ClientIP,
+				param.Method,
+				redactQuery(param.Path),
+				param.ErrorMessage,
+			)
+		},
+	})
+}
+
+// redactQuery replaces the values of redactedParams in path?query
+func redactQuery(path string) string {
+	base, rawQuery, ok := strings.Cut(path, "?")
+	if !ok {
+		return path
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return base + "?REDACTED"
+	}
+	redacted := false
+	for _, name := range redactedParams {
+		if query.Has(name) {
+			query.Set(name, "REDACTED")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return path
+	}
+	return base + "?" + query.Encode()
+}
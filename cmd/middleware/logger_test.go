@@ -0,0 +1,17 @@
+package middleware
+
+import "testing"
+
+func TestRedactQuery(t *testing.T) {
+	for path, want := range map[string]string{
+		"/api/events":                           "/api/events",
+		"/api/files?page=2":                     "/api/files?page=2",
+		"/api/events?access_token=eyJ.secret.x": "/api/events?access_token=REDACTED",
+		"/api/events?since=5&access_token=eyJ":  "/api/events?access_token=REDACTED&since=5",
+		"/api/events?access_token=%zz":          "/api/events?REDACTED",
+	} {
+		if got := redactQuery(path); got != want {
+			t.Errorf("%s: got %s, want %s", path, got, want)
+		}
+	}
+}
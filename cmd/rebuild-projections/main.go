@@ -0,0 +1,64 @@
+// Command rebuild-projections compares user_file_stats with the files table,
+// or with a replay of the file-events stream, and corrects drifted counts.
+//
+//	rebuild-projections [-user id | -shard n] [-source files|events] [-dry-run]
+//
+// It reads the same environment as the server and prints the report as JSON.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/app"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/configuration"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/projection"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+)
+
+func main() {
+	userID := flag.String("user", "", "rebuild the stats of one user")
+	shard := flag.Int("shard", -1, "rebuild one shard; all shards by default")
+	source := flag.String("source", projection.SourceFiles, "files, or events to replay the file-events stream")
+	dryRun := flag.Bool("dry-run", false, "only report the differences")
+	batch := flag.Int("batch", 500, "users per batch")
+	pause := flag.Duration("pause", 0, "pause between batches")
+	flag.Parse()
+
+	cfg := configuration.Load()
+	if err := app.SetupPostgres(cfg.Database); err != nil {
+		log.Fatalf("Failed to initialize PostgreSQL shards: %v", err)
+	}
+	if *source == projection.SourceEvents {
+		if _, _, err := services.ConnectNATS(cfg.NATSURL); err != nil {
+			log.Fatalf("Failed to connect to NATS: %v", err)
+		}
+	}
+
+	opts := projection.FileStatsOptions{
+		UserID:    *userID,
+		Source:    *source,
+		DryRun:    *dryRun,
+		BatchSize: *batch,
+		Pause:     *pause,
+	}
+	if *shard >= 0 {
+		opts.Shard = shard
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, err := projection.RebuildFileStats(ctx, opts)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(report)
+	if err != nil {
+		log.Fatalf("Rebuild failed: %v", err)
+	}
+}
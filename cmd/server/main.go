@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"log"
 	"os"
 	"os/signal"
@@ -13,12 +12,14 @@ import (
 	"github.com/File-Sharing-BondBridg/File-Service/internal/api"
 	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/user"
 	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/util"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/webhooks"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/app"
 	"github.com/File-Sharing-BondBridg/File-Service/internal/configuration"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/metrics"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/policy"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/scanner"
 	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
-	"github.com/File-Sharing-BondBridg/File-Service/internal/services/infrastructure"
-	"github.com/gin-gonic/gin"
-	"github.com/nats-io/nats.go"
-	gintrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/gin-gonic/gin"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/webhook"
 	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
 )
 
@@ -32,6 +33,13 @@ func main() {
 
 	// Load configuration
 	cfg := configuration.Load()
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	if err := metrics.Init(cfg.StatsdAddr); err != nil {
+		log.Printf("Metrics disabled: %v", err)
+	}
 
 	err := middleware.InitAuth(cfg.KeycloakUrl)
 	if err != nil {
@@ -39,84 +47,99 @@ func main() {
 	}
 
 	// Initialize PostgreSQL
-	shards := []string{}
-	if cfg.Database.Shard0 != "" {
-		shards = append(shards, cfg.Database.Shard0)
-	}
-	if cfg.Database.Shard1 != "" {
-		shards = append(shards, cfg.Database.Shard1)
-	}
-
-	if len(shards) < 2 {
-		log.Fatal("At least 2 database shards are required")
-	}
-
-	if err := infrastructure.InitializePostgresShards(shards); err != nil {
+	if err := app.SetupPostgres(cfg.Database); err != nil {
 		log.Fatalf("Failed to initialize PostgreSQL shards: %v", err)
 	}
 
-	log.Printf("PostgreSQL initialized successfully")
-
 	// Initialize MinIO
 	if err := services.InitializeMinio(
 		cfg.MinIO.Endpoint,
 		cfg.MinIO.AccessKey,
 		cfg.MinIO.SecretKey,
 		cfg.MinIO.BucketName,
+		cfg.MinIO.QuarantineBucket,
 		cfg.MinIO.UseSSL,
 	); err != nil {
 		log.Fatalf("Failed to initialize MinIO: %v", err)
 	}
 	log.Printf("MinIO initialized successfully")
 
-	setupNATS(cfg.NATSURL, cfg.CLAMAVURL)
-
-	setupGracefulShutdown()
-
-	r := gin.Default()
-
-	r.Use(gintrace.Middleware("file-service"))
-	r.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	// Initialize ClamAV (INSTREAM over the network, no shared filesystem needed)
+	if err := services.InitializeClamAV(cfg.CLAMAVURL, cfg.Scan.StreamMaxLength); err != nil {
+		log.Fatalf("Failed to initialize ClamAV: %v", err)
+	}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
+	engine, err := scanner.New(cfg.Scan.Engines, scanner.Options{
+		ClamAV:            services.GetClamAVService(),
+		HashBlocklistPath: cfg.Scan.HashBlocklistPath,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize scanner: %v", err)
+	}
+	log.Printf("Scanner initialized: %s", engine.Name())
 
-		c.Next()
+	accessPolicy, err := policy.ParseMode(cfg.Scan.AccessPolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	policy.SetMode(accessPolicy)
+
+	user.ConfigureDeletion(user.DeletionConfig{
+		BatchSize:  cfg.Deletion.BatchSize,
+		Lease:      cfg.Deletion.Lease,
+		RunTimeout: cfg.Deletion.RunTimeout,
+		Interval:   cfg.Deletion.Interval,
+		BaseDelay:  cfg.Deletion.RetryBaseDelay,
+		MaxDelay:   cfg.Deletion.RetryMaxDelay,
 	})
+	if err := app.SetupNATS(cfg.NATSURL, engine, cfg.Scan, cfg.Consumers, cfg.RPC, cfg.Webhooks); err != nil {
+		log.Fatal(err)
+	}
 
-	r.GET("/health", func(c *gin.Context) {
-		stats := infrastructure.GetStats()
-		minioService := services.GetMinioService()
-		var minioStatus string
-
-		if minioService != nil {
-			// Test MinIO connection
-			if err := minioService.CheckConnection(); err == nil {
-				minioStatus = "connected"
-			} else {
-				minioStatus = "degraded"
-			}
-		} else {
-			minioStatus = "failed"
-		}
-
-		c.JSON(200, gin.H{
-			"status": "ok",
-			"storage": gin.H{
-				"postgres": "connected",
-				"minio":    minioStatus,
-			},
-			"stats": stats,
+	util.StartOutboxRelay(context.Background(), util.OutboxRelayConfig{
+		Interval:  cfg.Outbox.RelayInterval,
+		BatchSize: cfg.Outbox.BatchSize,
+		BaseDelay: cfg.Outbox.RetryBaseDelay,
+		MaxDelay:  cfg.Outbox.RetryMaxDelay,
+		Retention: cfg.Outbox.Retention,
+	})
+	if cfg.Webhooks.Enabled {
+		sender := webhook.NewSender(cfg.Webhooks.Timeout, cfg.Webhooks.AllowPrivateNetworks)
+		webhooks.Configure(sender, cfg.Webhooks.AllowHTTP, cfg.Webhooks.AllowPrivateNetworks)
+		util.StartWebhookDispatcher(context.Background(), util.WebhookDispatcherConfig{
+			Interval:     cfg.Webhooks.DispatchInterval,
+			BatchSize:    cfg.Webhooks.BatchSize,
+			Concurrency:  cfg.Webhooks.Concurrency,
+			MaxAttempts:  cfg.Webhooks.MaxAttempts,
+			BaseDelay:    cfg.Webhooks.RetryBaseDelay,
+			MaxDelay:     cfg.Webhooks.RetryMaxDelay,
+			DisableAfter: cfg.Webhooks.DisableAfter,
+			Retention:    cfg.Webhooks.Retention,
+			Lease:        cfg.Webhooks.Timeout + time.Minute,
+		}, sender)
+	}
+	user.StartDeletionRunner(context.Background())
+	if cfg.FileStats.CheckInterval > 0 {
+		util.StartFileStatsCheck(context.Background(), util.FileStatsCheckConfig{
+			Interval:  cfg.FileStats.CheckInterval,
+			Repair:    cfg.FileStats.Repair,
+			BatchSize: cfg.FileStats.BatchSize,
+			Pause:     cfg.FileStats.Pause,
 		})
+	}
+	util.StartPendingScanSweeper(context.Background(), cfg.Scan.SweepInterval, cfg.Scan.StuckAfter, 100)
+	util.StartSignatureWatcher(context.Background(), engine, util.RescanPolicy{
+		CheckInterval:    cfg.Scan.Rescan.CheckInterval,
+		MaxAge:           cfg.Scan.Rescan.MaxAge,
+		AtRiskMaxAge:     cfg.Scan.Rescan.AtRiskMaxAge,
+		AtRiskExtensions: util.ParseExtensions(cfg.Scan.Rescan.AtRiskExtensions),
+		Rate:             cfg.Scan.Rescan.Rate,
+		BatchSize:        cfg.Scan.Rescan.BatchSize,
 	})
 
-	apiGroup := r.Group("/api")
-	api.RegisterRoutes(apiGroup)
+	setupGracefulShutdown()
+
+	r := api.NewRouter()
 
 	log.Printf("Server starting on :%s", cfg.Server.Port)
 	if err := r.Run(":" + cfg.Server.Port); err != nil {
@@ -134,93 +157,3 @@ func setupGracefulShutdown() {
 		os.Exit(0)
 	}()
 }
-
-func setupNATS(natsUrl, clamAvUrl string) {
-	_, _, err := services.ConnectNATS(natsUrl)
-	if err != nil {
-		log.Fatal("Failed to connect to NATS/JetStream:", err)
-	}
-
-	// Subscribe to files.uploaded (durable consumer)
-	_, err = services.SubscribeEvent("files.uploaded", "file_service_preview", func(msg *nats.Msg) {
-		log.Printf("[JetStream] files.uploaded message: %s", string(msg.Data))
-
-		var event map[string]interface{}
-		if err := json.Unmarshal(msg.Data, &event); err != nil {
-			log.Println("Invalid event:", err)
-			msg.Nak()
-			return
-		}
-
-		// Extract with type assertions (add more fields as needed)
-		fileID, ok := event["file_id"].(string)
-		if !ok {
-			log.Println("Missing or invalid file_id")
-			msg.Nak()
-			return
-		}
-
-		userID, ok := event["user_id"].(string)
-		if !ok {
-			log.Println("Missing or invalid user_id")
-			msg.Nak()
-			return
-		}
-
-		filePath, ok := event["object_name"].(string)
-		if !ok {
-			log.Println("Missing or invalid object_name")
-			msg.Nak()
-			return
-		}
-
-		util.ScanFile(fileID, userID, filePath, clamAvUrl)
-
-		if err := msg.Ack(); err != nil {
-			log.Printf("[JetStream] ack failed: %v", err)
-		}
-	})
-	if err != nil {
-		log.Printf("Failed to subscribe to files.uploaded: %v", err)
-	} else {
-		log.Println("Subscribed to files.uploaded (durable preview consumer)")
-	}
-
-	// Subscribe to users.deleted (durable consumer)
-	_, err = services.SubscribeEvent(
-		"users.deleted",
-		"file_service_user_cleanup",
-		user.HandleUserDeleted,
-	)
-	if err != nil {
-		log.Printf("Failed to subscribe to users.deleted: %v", err)
-	} else {
-		log.Println("Subscribed to users.deleted (durable cleanup consumer)")
-	}
-
-	_, err = services.SubscribeEvent(
-		"users.synced",
-		"file_service_user_init",
-		func(msg *nats.Msg) {
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-
-			if err := user.HandleUserSynced(ctx, msg.Data); err != nil {
-				log.Printf("[JetStream] user sync failed: %v", err)
-				_ = msg.Nak()
-				return
-			}
-
-			if err := msg.Ack(); err != nil {
-				log.Printf("[JetStream] ack failed: %v", err)
-			}
-		},
-	)
-	if err != nil {
-		log.Printf("Failed to subscribe to users.synced: %v", err)
-	} else {
-		log.Println("Subscribed to users.synced (durable cleanup consumer)")
-	}
-
-	log.Println("NATS/JetStream setup completed")
-}
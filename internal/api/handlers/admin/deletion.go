@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/user"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/command"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/query"
+	"github.com/gin-gonic/gin"
+)
+
+// GetUserDeletion reports the progress of a user's deletion job.
+func GetUserDeletion(c *gin.Context) {
+	job, exists, err := query.GetUserDeletion(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load deletion job"})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No deletion job for this user"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// StartUserDeletion starts the deletion job of a user, or resumes an
+// unfinished one right away instead of waiting for its retry.
+func StartUserDeletion(c *gin.Context) {
+	userID := c.Param("id")
+	job, err := command.StartUserDeletion(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start deletion job"})
+		return
+	}
+	if job.Status == models.DeletionCompleted {
+		c.JSON(http.StatusOK, job)
+		return
+	}
+
+	go func() {
+		if err := user.RunDeletion(context.Background(), userID); err != nil {
+			log.Printf("[Deletion] user %s paused: %v; the runner resumes it", userID, err)
+		}
+	}()
+
+	log.Printf("[ADMIN] %s started deletion of user %s (phase %s)", c.GetString("user_id"), userID, job.Phase)
+	c.JSON(http.StatusAccepted, job)
+}
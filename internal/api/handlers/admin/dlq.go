@@ -0,0 +1,129 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ListDeadLetters pages through the dead-letter stream, oldest first.
+// ?after= is the last sequence of the previous page.
+func ListDeadLetters(c *gin.Context) {
+	after, err := strconv.ParseUint(c.DefaultQuery("after", "0"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "after must be a sequence number"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 {
+		limit = 50
+	}
+	if limit > 500 {
+		limit = 500
+	}
+
+	entries, total, err := services.ListDeadLetters(after, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read dead letters"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"dead_letters": entries,
+		"total":        total,
+	})
+}
+
+// GetDeadLetter returns one entry with its headers and payload.
+func GetDeadLetter(c *gin.Context) {
+	seq, ok := deadLetterSequence(c)
+	if !ok {
+		return
+	}
+	entry, err := services.GetDeadLetter(seq)
+	if err != nil {
+		writeDeadLetterError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+type editDeadLetterRequest struct {
+	Data       json.RawMessage `json:"data"`
+	DataBase64 []byte          `json:"data_base64"`
+}
+
+// EditDeadLetter replaces the payload of an entry before it is replayed. The
+// edited entry gets a new sequence.
+func EditDeadLetter(c *gin.Context) {
+	seq, ok := deadLetterSequence(c)
+	if !ok {
+		return
+	}
+	var req editDeadLetterRequest
+	if err := c.ShouldBindJSON(&req); err != nil || (len(req.Data) == 0) == (len(req.DataBase64) == 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "exactly one of data or data_base64 is required"})
+		return
+	}
+	data := []byte(req.Data)
+	if len(data) == 0 {
+		data = req.DataBase64
+	}
+
+	entry, err := services.EditDeadLetter(seq, data)
+	if err != nil {
+		writeDeadLetterError(c, err)
+		return
+	}
+	log.Printf("[ADMIN] %s edited dead letter %d (now %d)", c.GetString("user_id"), seq, entry.Sequence)
+	c.JSON(http.StatusOK, entry)
+}
+
+// ReplayDeadLetter hands an entry back to the consumer that gave up on it.
+func ReplayDeadLetter(c *gin.Context) {
+	seq, ok := deadLetterSequence(c)
+	if !ok {
+		return
+	}
+	if err := services.ReplayDeadLetter(seq); err != nil {
+		writeDeadLetterError(c, err)
+		return
+	}
+	log.Printf("[ADMIN] %s replayed dead letter %d", c.GetString("user_id"), seq)
+	c.JSON(http.StatusOK, gin.H{"message": "Dead letter replayed", "sequence": seq})
+}
+
+// DiscardDeadLetter drops an entry for good.
+func DiscardDeadLetter(c *gin.Context) {
+	seq, ok := deadLetterSequence(c)
+	if !ok {
+		return
+	}
+	if err := services.DiscardDeadLetter(seq); err != nil {
+		writeDeadLetterError(c, err)
+		return
+	}
+	log.Printf("[ADMIN] %s discarded dead letter %d", c.GetString("user_id"), seq)
+	c.JSON(http.StatusOK, gin.H{"message": "Dead letter discarded", "sequence": seq})
+}
+
+func deadLetterSequence(c *gin.Context) (uint64, bool) {
+	seq, err := strconv.ParseUint(c.Param("seq"), 10, 64)
+	if err != nil || seq == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sequence"})
+		return 0, false
+	}
+	return seq, true
+}
+
+func writeDeadLetterError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrDeadLetterNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead letter not found"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Dead letter operation failed: " + err.Error()})
+}
@@ -0,0 +1,57 @@
+package admin
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/command"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/query"
+	"github.com/gin-gonic/gin"
+)
+
+type scanOverrideRequest struct {
+	Allow *bool `json:"allow" binding:"required"`
+}
+
+// SetScanOverride allows serving a single file regardless of the scan access policy.
+func SetScanOverride(c *gin.Context) {
+	var req scanOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "allow (boolean) is required"})
+		return
+	}
+
+	metadata, exists := query.GetFileMetadata(c.Param("id"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	updateEvent, err := events.NewOutboxMessage(c.Request.Context(), events.FileUpdated{
+		FileID:       metadata.ID,
+		UserID:       metadata.UserID,
+		Changed:      []string{events.FieldScanOverride},
+		ScanStatus:   metadata.ScanStatus,
+		ScanOverride: *req.Allow,
+		UpdatedAt:    time.Now().UTC(),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode update event"})
+		return
+	}
+
+	adminID := c.GetString("user_id")
+	if !command.SetScanOverride(metadata.ID, metadata.UserID, *req.Allow, adminID, updateEvent) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update scan override"})
+		return
+	}
+
+	log.Printf("[ADMIN] %s set scan override of %s (%s) to %t", adminID, metadata.ID, metadata.ScanStatus, *req.Allow)
+	c.JSON(http.StatusOK, gin.H{
+		"file_id":       metadata.ID,
+		"scan_status":   metadata.ScanStatus,
+		"scan_override": *req.Allow,
+	})
+}
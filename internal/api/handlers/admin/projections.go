@@ -0,0 +1,49 @@
+package admin
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/projection"
+	"github.com/gin-gonic/gin"
+)
+
+type rebuildFileStatsRequest struct {
+	UserID string `json:"user_id"`
+	Shard  *int   `json:"shard"`
+	Source string `json:"source"`
+	DryRun bool   `json:"dry_run"`
+}
+
+// RebuildFileStats compares user_file_stats with the files table, or with a
+// replay of the event stream, and corrects the counts unless dry_run is set.
+// Without user_id or shard every shard is rebuilt.
+func RebuildFileStats(c *gin.Context) {
+	var req rebuildFileStatsRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+	}
+	if req.Source != "" && req.Source != projection.SourceFiles && req.Source != projection.SourceEvents {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "source must be files or events"})
+		return
+	}
+
+	report, err := projection.RebuildFileStats(c.Request.Context(), projection.FileStatsOptions{
+		UserID: req.UserID,
+		Shard:  req.Shard,
+		Source: req.Source,
+		DryRun: req.DryRun,
+	})
+	if err != nil {
+		log.Printf("[ADMIN] file stats rebuild failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "report": report})
+		return
+	}
+
+	log.Printf("[ADMIN] %s rebuilt file stats from %s: %d of %d users drifted, %d repaired",
+		c.GetString("user_id"), report.Source, report.Drifted, report.UsersChecked, report.Repaired)
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,166 @@
+package admin
+
+import (
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/command"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/query"
+	"github.com/gin-gonic/gin"
+)
+
+// ListQuarantinedFiles lists quarantined files across all shards.
+func ListQuarantinedFiles(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "50"))
+	if err != nil || pageSize < 1 {
+		pageSize = 50
+	}
+	if pageSize > 500 {
+		pageSize = 500
+	}
+
+	files, total, err := query.ListQuarantinedFiles(pageSize, (page-1)*pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch quarantined files"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"files":    files,
+		"page":     page,
+		"pageSize": pageSize,
+		"total":    total,
+	})
+}
+
+// DownloadQuarantinedFile streams the infected object for offline analysis.
+// It is always sent as an opaque attachment.
+func DownloadQuarantinedFile(c *gin.Context) {
+	metadata, ok := quarantinedFile(c)
+	if !ok {
+		return
+	}
+
+	minioService := services.GetMinioService()
+	if minioService == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Storage service not available"})
+		return
+	}
+
+	obj, info, err := minioService.GetQuarantinedObject(c.Request.Context(), metadata.FilePath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read quarantined object"})
+		return
+	}
+	defer obj.Close()
+
+	log.Printf("[ADMIN] %s downloaded quarantined file %s (%s)", c.GetString("user_id"), metadata.ID, metadata.ScanSignature)
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": metadata.ID + ".quarantined"}))
+	c.Header("Content-Length", strconv.FormatInt(info.Size, 10))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("X-Scan-Signature", metadata.ScanSignature)
+	c.Status(http.StatusOK)
+
+	if _, err := io.Copy(c.Writer, obj); err != nil {
+		log.Printf("[ADMIN] quarantined download of %s aborted: %v", metadata.ID, err)
+	}
+}
+
+// ReleaseQuarantinedFile moves a file back to the files bucket after review.
+func ReleaseQuarantinedFile(c *gin.Context) {
+	metadata, ok := quarantinedFile(c)
+	if !ok {
+		return
+	}
+
+	minioService := services.GetMinioService()
+	if minioService == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Storage service not available"})
+		return
+	}
+
+	if err := minioService.ReleaseObject(c.Request.Context(), metadata.FilePath); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release object: " + err.Error()})
+		return
+	}
+
+	updateEvent, err := events.NewOutboxMessage(c.Request.Context(), events.FileUpdated{
+		FileID:       metadata.ID,
+		UserID:       metadata.UserID,
+		Changed:      []string{events.FieldScanStatus, events.FieldBucket},
+		ScanStatus:   models.ScanStatusReleased,
+		ScanOverride: metadata.ScanOverride,
+		Bucket:       minioService.BucketName,
+		UpdatedAt:    time.Now().UTC(),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode update event"})
+		return
+	}
+
+	if !command.ReleaseQuarantinedFile(metadata.ID, metadata.UserID, minioService.BucketName, updateEvent) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update file metadata"})
+		return
+	}
+
+	log.Printf("[ADMIN] %s released quarantined file %s (%s)", c.GetString("user_id"), metadata.ID, metadata.ScanSignature)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "File released from quarantine",
+		"file_id": metadata.ID,
+	})
+}
+
+// DeleteQuarantinedFile permanently removes the quarantined file. The object
+// is removed by the storage cleanup consumer.
+func DeleteQuarantinedFile(c *gin.Context) {
+	metadata, ok := quarantinedFile(c)
+	if !ok {
+		return
+	}
+
+	deleteEvent, err := events.NewOutboxMessage(c.Request.Context(), events.NewFileDeleted(metadata, events.DeleteReasonInfected))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode delete event"})
+		return
+	}
+
+	deleted, err := command.DeleteFileMetadata(metadata.ID, metadata.UserID, deleteEvent)
+	if err != nil {
+		log.Printf("[ADMIN] failed to delete quarantined file %s: %v", metadata.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file metadata"})
+		return
+	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	log.Printf("[ADMIN] %s permanently deleted quarantined file %s (%s)", c.GetString("user_id"), metadata.ID, metadata.ScanSignature)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Quarantined file deleted",
+		"file_id": metadata.ID,
+	})
+}
+
+// quarantinedFile loads the file named by :id and writes a 404 unless it is quarantined
+func quarantinedFile(c *gin.Context) (models.FileMetadata, bool) {
+	metadata, exists := query.GetFileMetadata(c.Param("id"))
+	if !exists || metadata.QuarantinedAt == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quarantined file not found"})
+		return models.FileMetadata{}, false
+	}
+	return metadata, true
+}
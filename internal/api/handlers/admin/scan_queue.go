@@ -0,0 +1,19 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/util"
+	"github.com/gin-gonic/gin"
+)
+
+// GetScanQueue reports this replica's scan workers and the backlog of the
+// scan consumers, e.g. for autoscaling decisions.
+func GetScanQueue(c *gin.Context) {
+	status, running := util.GetScanPoolStatus()
+	if !running {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Scan workers are not running"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
@@ -1,10 +1,10 @@
 package handlers
 
 import (
-	"fmt"
+	"log"
 	"net/http"
 
-	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
 	"github.com/File-Sharing-BondBridg/File-Service/internal/services/command"
 	"github.com/File-Sharing-BondBridg/File-Service/internal/services/query"
 	"github.com/gin-gonic/gin"
@@ -26,39 +26,35 @@ func DeleteFile(c *gin.Context) {
 		return
 	}
 
-	metadata, exists := query.GetFileMetadataForUser(fileID, userID)
+	metadata, exists := query.GetFileMetadataForUser(c.Request.Context(), fileID, userID)
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
 		return
 	}
 
-	// Get MinIO service
-	minioService := services.GetMinioService()
-	if minioService == nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Storage service not available"})
+	// The objects are removed by the storage cleanup consumer once
+	// files.deleted is published
+	deleteEvent, err := events.NewOutboxMessage(c.Request.Context(), events.NewFileDeleted(metadata, events.DeleteReasonUser))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode delete event"})
 		return
 	}
 
-	// Delete from MinIO
-	if err := minioService.DeleteFile(metadata.FilePath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file from storage: " + err.Error()})
+	// Delete metadata from PostgreSQL; files.deleted is published through the outbox
+	deleted, err := command.DeleteFileMetadata(fileID, userID, deleteEvent)
+	if err != nil {
+		log.Printf("Error deleting file metadata of %s: %v", fileID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file metadata"})
 		return
 	}
-
-	// Delete preview from MinIO if it exists
-	if metadata.PreviewPath != "" {
-		if err := minioService.DeleteFile(metadata.PreviewPath); err != nil {
-			fmt.Printf("Warning: Failed to delete preview from storage: %v\n", err)
-		}
+	if !deleted {
+		// Deleted by a concurrent request
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
 	}
 
-	// Delete metadata from PostgreSQL
-	if command.DeleteFileMetadata(fileID, userID) {
-		c.JSON(http.StatusOK, gin.H{
-			"message": "File deleted successfully",
-			"file_id": fileID,
-		})
-	} else {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file metadata"})
-	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "File deleted successfully",
+		"file_id": fileID,
+	})
 }
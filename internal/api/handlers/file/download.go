@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"fmt"
+	"mime"
 	"net/http"
 	"os"
 
+	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/util"
 	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
 	"github.com/File-Sharing-BondBridg/File-Service/internal/services/query"
 	"github.com/gin-gonic/gin"
@@ -24,6 +26,9 @@ func DownloadFile(c *gin.Context) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
 		return
 	}
+	if !util.EnforceScanPolicy(c, metadata, userID.(string)).Allowed {
+		return
+	}
 
 	// Get MinIO service
 	minioService := services.GetMinioService()
@@ -47,9 +52,10 @@ func DownloadFile(c *gin.Context) {
 
 	// Set appropriate headers for download
 	c.Header("Content-Description", "File Transfer")
-	c.Header("Content-Disposition", "attachment; filename="+metadata.OriginalName)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": metadata.OriginalName}))
 	c.Header("Content-Type", "application/octet-stream")
 	c.Header("Content-Transfer-Encoding", "binary")
+	c.Header("X-Content-Type-Options", "nosniff")
 
 	c.File(tempPath)
 }
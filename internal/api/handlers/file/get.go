@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 
+	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/util"
 	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
 	"github.com/File-Sharing-BondBridg/File-Service/internal/services/query"
 	"github.com/gin-gonic/gin"
@@ -20,11 +21,14 @@ func GetFile(c *gin.Context) {
 		return
 	}
 
-	metadata, exists := query.GetFileMetadataForUser(id, userID)
+	metadata, exists := query.GetFileMetadataForUser(c.Request.Context(), id, userID)
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
 		return
 	}
+	if !util.EnforceScanPolicy(c, metadata, userID).Allowed {
+		return
+	}
 
 	minioService := services.GetMinioService()
 	if minioService == nil {
@@ -41,6 +45,8 @@ func GetFile(c *gin.Context) {
 		return
 	}
 
+	// Never let the browser sniff uploaded content into an active type
+	c.Header("X-Content-Type-Options", "nosniff")
 	c.File(tempPath)
 }
 
@@ -102,7 +108,7 @@ func GetFileInfo(c *gin.Context) {
 		return
 	}
 
-	metadata, exists := query.GetFileMetadataForUser(id, userID)
+	metadata, exists := query.GetFileMetadataForUser(c.Request.Context(), id, userID)
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
 		return
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/util"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/query"
+	"github.com/gin-gonic/gin"
+)
+
+// previewCSP keeps anything rendered inline from running scripts, loading
+// external resources or being framed by other origins.
+const previewCSP = "default-src 'none'; img-src 'self'; media-src 'self'; style-src 'unsafe-inline'; frame-ancestors 'self'; sandbox"
+
+// pdfCSP leaves out sandbox, since Chromium's built-in viewer refuses to
+// render sandboxed PDFs. The viewer runs no scripts of the document.
+const pdfCSP = "default-src 'none'; object-src 'self'; frame-ancestors 'self'"
+
+// inlineContentTypes are the passive types that are safe to render in the browser.
+// Anything else (HTML, SVG, XML, scripts, ...) is forced to download.
+var inlineContentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"image/bmp":       true,
+	"application/pdf": true,
+	"text/plain":      true,
+	"audio/mpeg":      true,
+	"audio/wav":       true,
+	"audio/ogg":       true,
+	"video/mp4":       true,
+	"video/quicktime": true,
+	"video/webm":      true,
+}
+
+// PreviewFile serves a file inline when its type is safe to render, and as an
+// attachment otherwise. With ?size=... the generated thumbnail is served instead.
+func PreviewFile(c *gin.Context) {
+	id := c.Param("id")
+
+	userID, exists := userIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	metadata, exists := query.GetFileMetadataForUser(c.Request.Context(), id, userID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if !util.EnforceScanPolicy(c, metadata, userID).Allowed {
+		return
+	}
+
+	objectName := metadata.FilePath
+	fileName := metadata.OriginalName
+	if c.Query("size") != "" {
+		if metadata.PreviewPath == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Preview not available"})
+			return
+		}
+		objectName = metadata.PreviewPath
+		fileName = metadata.Name + filepath.Ext(metadata.PreviewPath)
+	}
+
+	minioService := services.GetMinioService()
+	if minioService == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Storage service not available"})
+		return
+	}
+
+	obj, info, err := minioService.GetObject(c.Request.Context(), objectName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file from storage"})
+		return
+	}
+	defer obj.Close()
+
+	setPreviewHeaders(c, objectName, fileName)
+
+	// ServeContent handles Range requests so audio and video can seek
+	http.ServeContent(c.Writer, c.Request, fileName, info.LastModified, obj)
+}
+
+// setPreviewHeaders describes the object for the browser: safe types inline
+// under a CSP that fits them, anything else as a download
+func setPreviewHeaders(c *gin.Context, objectName, fileName string) {
+	contentType := services.GetContentType(strings.ToLower(filepath.Ext(objectName)))
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	disposition := "inline"
+	csp := previewCSP
+	switch {
+	case !inlineContentTypes[mediaType]:
+		contentType = "application/octet-stream"
+		disposition = "attachment"
+	case mediaType == "application/pdf":
+		csp = pdfCSP
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": fileName}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", csp)
+	c.Header("Cache-Control", "private, max-age=300")
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPreviewHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		object      string
+		contentType string
+		disposition string
+		csp         string
+	}{
+		{"photo.JPG", "image/jpeg", "inline", previewCSP},
+		{"report.pdf", "application/pdf", "inline", pdfCSP},
+		{"notes.txt", "text/plain; charset=utf-8", "inline", previewCSP},
+		{"song.mp3", "audio/mpeg", "inline", previewCSP},
+		{"clip.webm", "video/webm", "inline", previewCSP},
+		{"page.html", "application/octet-stream", "attachment", previewCSP},
+		{"logo.svg", "application/octet-stream", "attachment", previewCSP},
+		{"archive.zip", "application/octet-stream", "attachment", previewCSP},
+	}
+	for _, tt := range tests {
+		t.Run(tt.object, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			setPreviewHeaders(c, "users/u1/"+tt.object, "my "+tt.object)
+
+			header := w.Header()
+			if got := header.Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type %q, want %q", got, tt.contentType)
+			}
+			if got, want := header.Get("Content-Disposition"), tt.disposition+`; filename="my `+tt.object+`"`; got != want {
+				t.Errorf("Content-Disposition %q, want %q", got, want)
+			}
+			if got := header.Get("Content-Security-Policy"); got != tt.csp {
+				t.Errorf("Content-Security-Policy %q, want %q", got, tt.csp)
+			}
+			if got := header.Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("X-Content-Type-Options %q", got)
+			}
+		})
+	}
+}
@@ -1,7 +1,7 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
 	"mime/multipart"
@@ -9,13 +9,14 @@ import (
 	"strings"
 	"time"
 
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
 	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
 	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
 	"github.com/File-Sharing-BondBridg/File-Service/internal/services/command"
 	"github.com/google/uuid"
 )
 
-func processSingleFile(fileHeader *multipart.FileHeader, userID string) (models.FileMetadata, error) {
+func processSingleFile(ctx context.Context, fileHeader *multipart.FileHeader, userID string) (models.FileMetadata, error) {
 
 	// Generate file identifiers
 	fileID := uuid.New().String()
@@ -50,7 +51,7 @@ func processSingleFile(fileHeader *multipart.FileHeader, userID string) (models.
 	contentType := services.GetContentType(ext)
 
 	// Upload to MinIO
-	if err := minioService.UploadFile(file, fileHeader.Size, objectName, contentType); err != nil {
+	if err := minioService.UploadFile(ctx, file, fileHeader.Size, objectName, contentType); err != nil {
 		return models.FileMetadata{}, fmt.Errorf("failed to upload to storage: %w", err)
 	}
 
@@ -68,8 +69,22 @@ func processSingleFile(fileHeader *multipart.FileHeader, userID string) (models.
 		UserID:       userID,
 	}
 
+	// files.uploaded goes through the outbox, so it is published if and only
+	// if the metadata is saved
+	outboxEvent, err := events.NewOutboxMessage(ctx, events.FileUploaded{
+		FileID:     fileMetadata.ID,
+		UserID:     fileMetadata.UserID,
+		ObjectName: objectName,
+		FileType:   fileType,
+		Size:       fileMetadata.Size,
+		UploadedAt: fileMetadata.UploadedAt.UTC(),
+	})
+	if err != nil {
+		return models.FileMetadata{}, fmt.Errorf("failed to encode files.uploaded event: %w", err)
+	}
+
 	// Save metadata
-	if err := command.SaveFileMetadata(fileMetadata); err != nil {
+	if err := command.SaveFileMetadata(fileMetadata, outboxEvent); err != nil {
 		// cleanup MinIO object
 		if delErr := minioService.DeleteFile(objectName); delErr != nil {
 			log.Printf("warning: failed to cleanup object after metadata save failure: %v", delErr)
@@ -77,40 +92,17 @@ func processSingleFile(fileHeader *multipart.FileHeader, userID string) (models.
 		return models.FileMetadata{}, fmt.Errorf("failed to save file metadata: %w", err)
 	}
 
-	// Publish event: "files.uploaded"
-	uploadEvent := map[string]interface{}{
-		"action":      "uploaded",
-		"file_id":     fileMetadata.ID,
-		"object_name": objectName,
-		"file_type":   fileType,
-		"size":        fileMetadata.Size,
-		"user_id":     fileMetadata.UserID,
-		"uploaded_at": fileMetadata.UploadedAt.UTC().Format(time.RFC3339),
-	}
-
-	if err := services.PublishEvent("files.uploaded", uploadEvent); err != nil {
-		log.Printf("warning: failed to publish files.uploaded event: %v", err)
-	}
-
 	// Publish virus scan event
-	scanEvent := map[string]interface{}{
-		"file_id":      fileID,
-		"object_name":  objectName,
-		"user_id":      userID,
-		"requested_at": time.Now().UTC().Format(time.RFC3339),
+	scanEvent := events.ScanRequested{
+		FileID:      fileID,
+		UserID:      userID,
+		ObjectName:  objectName,
+		RequestedAt: time.Now().UTC(),
 	}
 
-	if err := services.PublishPlain("files.scan.requested", mustJSON(scanEvent)); err != nil {
+	if err := events.PublishPlain(ctx, scanEvent); err != nil {
 		log.Printf("warning: failed to publish files.scan.requested command: %v", err)
 	}
 
 	return fileMetadata, nil
 }
-
-func mustJSON(v interface{}) []byte {
-	b, err := json.Marshal(v)
-	if err != nil {
-		panic(err)
-	}
-	return b
-}
@@ -73,7 +73,7 @@ func UploadFile(c *gin.Context) {
 	results := make([]UploadResult, 0, len(files))
 
 	for _, fh := range files {
-		meta, err := processSingleFile(fh, userID)
+		meta, err := processSingleFile(c.Request.Context(), fh, userID)
 		if err != nil {
 			results = append(results, UploadResult{
 				Success: false,
@@ -0,0 +1,111 @@
+package share
+
+import (
+	"context"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/util"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/command"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/query"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// DownloadSharedFile serves a file through its public share token. Every
+// request that resolves to a share is recorded, whether it succeeds or not.
+func DownloadSharedFile(c *gin.Context) {
+	token := c.Param("token")
+
+	share, exists := query.GetShareByToken(token)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share not found"})
+		return
+	}
+
+	access := models.ShareAccess{
+		ID:         uuid.New().String(),
+		ShareID:    share.ID,
+		AccessedAt: time.Now(),
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+	defer func() { recordAccess(c.Request.Context(), share, access) }()
+
+	if reason := share.DenialReason(access.AccessedAt); reason != "" {
+		access.DenialReason = reason
+		c.JSON(http.StatusGone, gin.H{"error": "Share is no longer available", "reason": reason})
+		return
+	}
+
+	metadata, exists := query.GetFileMetadataForUser(c.Request.Context(), share.FileID, share.UserID)
+	if !exists {
+		access.DenialReason = "file_not_found"
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	// Share links are anonymous, so owner-only mode never applies here
+	if decision := util.EnforceScanPolicy(c, metadata, ""); !decision.Allowed {
+		access.DenialReason = decision.Code
+		return
+	}
+
+	minioService := services.GetMinioService()
+	if minioService == nil {
+		access.DenialReason = "storage_unavailable"
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Storage service not available"})
+		return
+	}
+
+	obj, info, err := minioService.GetObject(c.Request.Context(), metadata.FilePath)
+	if err != nil {
+		access.DenialReason = "storage_error"
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file from storage"})
+		return
+	}
+	defer obj.Close()
+
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": metadata.OriginalName}))
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Length", strconv.FormatInt(info.Size, 10))
+	c.Status(http.StatusOK)
+
+	n, err := io.Copy(c.Writer, obj)
+	access.BytesServed = n
+	if err != nil {
+		log.Printf("[SHARE] transfer of share %s aborted after %d bytes: %v", share.ID, n, err)
+		access.DenialReason = "transfer_aborted"
+		return
+	}
+	access.Success = true
+}
+
+func recordAccess(ctx context.Context, share models.Share, access models.ShareAccess) {
+	if err := command.RecordShareAccess(share.UserID, access); err != nil {
+		log.Printf("[SHARE] failed to record access for share %s: %v", share.ID, err)
+	}
+
+	accessEvent := events.ShareAccessed{
+		ShareID:      share.ID,
+		FileID:       share.FileID,
+		UserID:       share.UserID,
+		AccessedAt:   access.AccessedAt.UTC(),
+		IP:           access.IP,
+		UserAgent:    access.UserAgent,
+		BytesServed:  access.BytesServed,
+		Success:      access.Success,
+		DenialReason: access.DenialReason,
+	}
+
+	if err := events.Publish(ctx, accessEvent); err != nil {
+		log.Printf("warning: failed to publish files.share.accessed event: %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package share
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/command"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/query"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type createShareRequest struct {
+	ExpiresInHours int `json:"expires_in_hours"`
+}
+
+// CreateShare creates a public share link for a file owned by the caller.
+func CreateShare(c *gin.Context) {
+	userID, exists := userIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	fileID := c.Param("id")
+	if _, exists := query.GetFileMetadataForUser(c.Request.Context(), fileID, userID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	var req createShareRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil || req.ExpiresInHours < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share token"})
+		return
+	}
+
+	share := models.Share{
+		ID:        uuid.New().String(),
+		FileID:    fileID,
+		UserID:    userID,
+		Token:     token,
+		CreatedAt: time.Now(),
+	}
+	if req.ExpiresInHours > 0 {
+		expiresAt := share.CreatedAt.Add(time.Duration(req.ExpiresInHours) * time.Hour)
+		share.ExpiresAt = &expiresAt
+	}
+
+	if err := command.CreateShare(share); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create share"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"share": share,
+		"url":   "/public/shares/" + share.Token,
+	})
+}
+
+// RevokeShare disables a share link; later accesses are recorded as denied.
+func RevokeShare(c *gin.Context) {
+	userID, exists := userIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	shareID := c.Param("id")
+	if !command.RevokeShare(shareID, userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Share revoked", "share_id": shareID})
+}
+
+// GetShareAccesses lists recorded accesses of a share together with aggregate counts.
+func GetShareAccesses(c *gin.Context) {
+	userID, exists := userIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	shareID := c.Param("id")
+	if _, exists := query.GetShareForUser(shareID, userID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share not found"})
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "50"))
+	if err != nil || pageSize < 1 {
+		pageSize = 50
+	}
+	if pageSize > 500 {
+		pageSize = 500
+	}
+
+	accesses, err := query.GetShareAccessPage(shareID, userID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch share accesses"})
+		return
+	}
+	stats, err := query.GetShareAccessStats(shareID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch share access stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"accesses": accesses,
+		"stats":    stats,
+		"page":     page,
+		"pageSize": pageSize,
+	})
+}
+
+func newShareToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func userIDFromContext(c *gin.Context) (string, bool) {
+	id, exists := c.Get("user_id")
+	if !exists {
+		return "", false
+	}
+	return id.(string), true
+}
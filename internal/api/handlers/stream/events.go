@@ -0,0 +1,49 @@
+package stream
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// keepAliveInterval keeps proxies from closing idle streams
+const keepAliveInterval = 25 * time.Second
+
+// Events streams the authenticated user's file events (uploads, scan results,
+// deletions) as Server-Sent Events until the client disconnects.
+func Events(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	events := defaultHub.subscribe(userID)
+	defer defaultHub.unsubscribe(userID, events)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Disable response buffering in nginx
+	c.Header("X-Accel-Buffering", "no")
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	c.SSEvent("ready", gin.H{"user_id": userID})
+	c.Writer.Flush()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event := <-events:
+			c.SSEvent(event.Name, string(event.Data))
+		case <-keepAlive.C:
+			_, _ = io.WriteString(w, ": keep-alive\n\n")
+		}
+		return true
+	})
+}
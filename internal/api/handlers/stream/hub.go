@@ -0,0 +1,98 @@
+package stream
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	"github.com/nats-io/nats.go"
+)
+
+// streamedSubjects maps the NATS subjects forwarded to browsers to their SSE
+// event names
+var streamedSubjects = map[string]string{
+	events.SubjectFileUploaded:  "file.uploaded",
+	events.SubjectScanCompleted: "file.scan.completed",
+	events.SubjectFileDeleted:   "file.deleted",
+	events.SubjectFileUpdated:   "file.updated",
+}
+
+// clientBuffer is how many events a slow client may lag behind before
+// events are dropped for it
+const clientBuffer = 32
+
+// Event is one message for a connected client.
+type Event struct {
+	Name string
+	Data json.RawMessage
+}
+
+type hub struct {
+	mu      sync.RWMutex
+	clients map[string]map[chan Event]struct{}
+}
+
+var defaultHub = &hub{clients: make(map[string]map[chan Event]struct{})}
+
+// StartHub subscribes this replica to the streamed subjects with plain NATS
+// subscriptions, so every replica sees every event and forwards it to the
+// clients connected to it.
+func StartHub() error {
+	for subject, name := range streamedSubjects {
+		if _, err := services.SubscribePlain(subject, defaultHub.forward(name)); err != nil {
+			return err
+		}
+	}
+	log.Printf("[SSE] forwarding %d subjects to connected clients", len(streamedSubjects))
+	return nil
+}
+
+func (h *hub) forward(name string) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		// Clients receive the whole envelope; only its payload names the owner
+		_, payload, _ := events.Unwrap(msg.Data)
+		var owner struct {
+			UserID string `json:"user_id"`
+		}
+		if err := json.Unmarshal(payload, &owner); err != nil || owner.UserID == "" {
+			return
+		}
+		h.publish(owner.UserID, Event{Name: name, Data: msg.Data})
+	}
+}
+
+func (h *hub) publish(userID string, event Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for ch := range h.clients[userID] {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("[SSE] client of %s is too slow, dropped %s", userID, event.Name)
+		}
+	}
+}
+
+func (h *hub) subscribe(userID string) chan Event {
+	ch := make(chan Event, clientBuffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients[userID] == nil {
+		h.clients[userID] = make(map[chan Event]struct{})
+	}
+	h.clients[userID][ch] = struct{}{}
+	return ch
+}
+
+func (h *hub) unsubscribe(userID string, ch chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients[userID], ch)
+	if len(h.clients[userID]) == 0 {
+		delete(h.clients, userID)
+	}
+}
@@ -0,0 +1,47 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/nats-io/nats.go"
+)
+
+func TestHubForwardsOnlyToOwner(t *testing.T) {
+	h := &hub{clients: make(map[string]map[chan Event]struct{})}
+	alice := h.subscribe("alice")
+	bob := h.subscribe("bob")
+	defer h.unsubscribe("alice", alice)
+	defer h.unsubscribe("bob", bob)
+
+	h.forward("file.scan.completed")(&nats.Msg{Data: []byte(`{"user_id":"alice","file_id":"f1","status":"clean"}`)})
+	h.forward("file.deleted")(&nats.Msg{Data: []byte(`not json`)})
+
+	select {
+	case event := <-alice:
+		if event.Name != "file.scan.completed" {
+			t.Fatalf("got %s", event.Name)
+		}
+	default:
+		t.Fatal("alice got no event")
+	}
+	if len(bob) != 0 || len(alice) != 0 {
+		t.Fatalf("unexpected events: alice=%d bob=%d", len(alice), len(bob))
+	}
+}
+
+func TestHubDropsEventsForSlowClients(t *testing.T) {
+	h := &hub{clients: make(map[string]map[chan Event]struct{})}
+	ch := h.subscribe("alice")
+
+	for i := 0; i < clientBuffer+5; i++ {
+		h.publish("alice", Event{Name: "file.uploaded"})
+	}
+	if len(ch) != clientBuffer {
+		t.Fatalf("buffered %d events", len(ch))
+	}
+
+	h.unsubscribe("alice", ch)
+	if len(h.clients) != 0 {
+		t.Fatal("client not removed")
+	}
+}
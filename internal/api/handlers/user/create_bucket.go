@@ -2,28 +2,23 @@ package user
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
 
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
 	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/tracing"
 	"github.com/minio/minio-go/v7"
 )
 
-func HandleUserSynced(ctx context.Context, data []byte) error {
-	var event struct {
-		EventType string `json:"eventType"`
-		UserID    string `json:"userId"`
-	}
-
-	if err := json.Unmarshal(data, &event); err != nil {
-		return err
-	}
-
-	if event.EventType != "UserSynced" {
+// HandleUserSynced creates the placeholder object of a new or updated user
+func HandleUserSynced(ctx context.Context, event events.UserSynced, _ events.Envelope) (err error) {
+	if event.EventType != events.UserSyncedType {
 		return nil
 	}
+	span, ctx := tracing.StartSpan(ctx, "user.sync", event.UserID)
+	defer tracing.Finish(span, &err)
 
 	minioSvc := services.GetMinioService()
 	if minioSvc == nil {
@@ -32,7 +27,8 @@ func HandleUserSynced(ctx context.Context, data []byte) error {
 
 	objectName := fmt.Sprintf("users/%s/.init", event.UserID)
 
-	_, err := minioSvc.Client.PutObject(
+	minioSpan, ctx := tracing.StartMinioSpan(ctx, "PutObject", minioSvc.BucketName)
+	_, err = minioSvc.Client.PutObject(
 		ctx,
 		minioSvc.BucketName,
 		objectName,
@@ -40,6 +36,7 @@ func HandleUserSynced(ctx context.Context, data []byte) error {
 		0,
 		minio.PutObjectOptions{},
 	)
+	tracing.Finish(minioSpan, &err)
 
 	return err
 }
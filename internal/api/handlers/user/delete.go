@@ -1,83 +1,70 @@
 package user
 
 import (
-	"encoding/json"
+	"context"
+	"fmt"
 	"log"
+	"time"
 
-	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
 	"github.com/File-Sharing-BondBridg/File-Service/internal/services/command"
-	"github.com/File-Sharing-BondBridg/File-Service/internal/services/query"
-	"github.com/nats-io/nats.go"
 )
 
-type UserDeletedPayload struct {
-	UserID string `json:"user_id"`
-}
+// deletedFilesPerEvent caps the size of a files.deleted.bulk message
+const deletedFilesPerEvent = 500
 
-func HandleUserDeleted(msg *nats.Msg) {
-	var payload UserDeletedPayload
-	if err := json.Unmarshal(msg.Data, &payload); err != nil {
-		log.Printf("[NATS] users.deleted: invalid JSON: %v", err)
-		nak(msg)
-		return
-	}
+// CleanupConsumer is the durable consumer of users.deleted
+const CleanupConsumer = "file_service_user_cleanup"
 
-	userID := payload.UserID
-	if userID == "" {
-		log.Printf("[NATS] users.deleted: missing user_id")
-		nak(msg)
-		return
-	}
+// HandleUserDeleted starts the deletion job of a user deleted by the account
+// service and runs it as far as the message's time allows; the deletion
+// runner finishes it otherwise. A user is cleaned up once, however often the
+// event is delivered or published.
+var HandleUserDeleted = events.Once(CleanupConsumer, userDeletedKey, handleUserDeleted)
 
+func userDeletedKey(event events.UserDeleted, _ events.Envelope) string {
+	return events.SubjectUserDeleted + ":" + event.UserID
+}
+
+func handleUserDeleted(ctx context.Context, event events.UserDeleted, _ events.Envelope) error {
+	userID := event.UserID
 	log.Printf("[NATS] Processing users.deleted for user_id: %s", userID)
 
-	// 1. Get all file paths from DB
-	filePaths, err := query.GetFilePathsForUser(userID)
+	// Once the job is recorded the deletion survives any failure below
+	job, err := command.StartUserDeletion(ctx, userID)
 	if err != nil {
-		log.Printf("[NATS] Failed to get file paths: %v", err)
-		nak(msg)
-		return
+		return fmt.Errorf("failed to start deletion of user %s: %w", userID, err)
 	}
-
-	if len(filePaths) == 0 {
-		log.Printf("[NATS] No files found for user %s", userID)
-	} else {
-		log.Printf("[NATS] Found %d files to delete: %v", len(filePaths), filePaths)
+	rememberDeletion(job)
+	if job.Status == models.DeletionCompleted {
+		return nil
 	}
 
-	// 2. Delete from MinIO
-	minioSvc := services.GetMinioService()
-	if minioSvc == nil {
-		log.Printf("[NATS] MinIO service not available")
-	} else {
-		for _, path := range filePaths {
-			if err := minioSvc.DeleteFile(path); err != nil {
-				log.Printf("[NATS] Failed to delete MinIO object %s: %v", path, err)
-				nak(msg)
-				return
-			}
-		}
-		log.Printf("[NATS] Deleted %d MinIO objects", len(filePaths))
+	if err := RunDeletion(ctx, userID); err != nil {
+		log.Printf("[Deletion] user %s paused: %v; the runner resumes it", userID, err)
 	}
-
-	// 3. Delete from PostgreSQL
-	deletedCount := command.DeleteAllFilesForUser(userID)
-	log.Printf("[NATS] Deleted %d file records from DB", deletedCount)
-
-	log.Printf("[NATS] Successfully cleaned up user %s", userID)
-	ack(msg)
+	return nil
 }
 
-// ack safely acknowledges the message
-func ack(msg *nats.Msg) {
-	if err := msg.Ack(); err != nil {
-		log.Printf("[NATS] Failed to ack message: %v", err)
-	}
-}
+// bulkDeleteEvents describes deleted rows in files.deleted.bulk messages of at
+// most deletedFilesPerEvent files
+func bulkDeleteEvents(ctx context.Context, userID, reason string, deleted []models.FileMetadata) ([]models.OutboxMessage, error) {
+	var messages []models.OutboxMessage
+	now := time.Now().UTC()
+	for start := 0; start < len(deleted); start += deletedFilesPerEvent {
+		end := min(start+deletedFilesPerEvent, len(deleted))
 
-// nak negatively acknowledges (retry)
-func nak(msg *nats.Msg) {
-	if err := msg.Nak(); err != nil {
-		log.Printf("[NATS] Failed to nak message: %v", err)
+		batch := events.FilesDeleted{UserID: userID, Reason: reason, DeletedAt: now}
+		for _, metadata := range deleted[start:end] {
+			batch.Files = append(batch.Files, events.DeletedFileOf(metadata))
+		}
+
+		msg, err := events.NewOutboxMessage(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
 	}
+	return messages, nil
 }
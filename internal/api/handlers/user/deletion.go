@@ -0,0 +1,332 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/util"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/metrics"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/tracing"
+	"github.com/gin-gonic/gin"
+)
+
+// DeletionConfig tunes user deletion jobs.
+type DeletionConfig struct {
+	// BatchSize files are handled per checkpoint
+	BatchSize int
+	// Lease is how long a run owns a job without checkpointing
+	Lease time.Duration
+	// RunTimeout bounds one run; an unfinished job is resumed later
+	RunTimeout time.Duration
+	// Interval is how often the runner looks for unfinished jobs
+	Interval time.Duration
+	// Failed runs are retried after BaseDelay, doubling up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+var deletionCfg = DeletionConfig{
+	BatchSize:  500,
+	Lease:      2 * time.Minute,
+	RunTimeout: 10 * time.Minute,
+	Interval:   30 * time.Second,
+	BaseDelay:  30 * time.Second,
+	MaxDelay:   30 * time.Minute,
+}
+
+// ConfigureDeletion replaces the default deletion settings
+func ConfigureDeletion(cfg DeletionConfig) {
+	deletionCfg = cfg
+}
+
+// RunDeletion claims the deletion job of a user and runs it from its last
+// checkpoint. It returns nil without doing anything when the job is finished
+// or another run owns it.
+func RunDeletion(ctx context.Context, userID string) error {
+	job, ok, err := deletions.ClaimUserDeletion(ctx, userID, deletionCfg.Lease)
+	if err != nil || !ok {
+		return err
+	}
+	return runDeletion(ctx, job)
+}
+
+// StartDeletionRunner resumes deletion jobs that were interrupted or failed,
+// every Interval.
+func StartDeletionRunner(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(deletionCfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			jobs, err := deletions.ClaimDueUserDeletions(ctx, 10, deletionCfg.Lease)
+			if err != nil {
+				log.Printf("[Deletion] failed to claim jobs: %v", err)
+			}
+			for _, job := range jobs {
+				if err := runDeletion(ctx, job); err != nil {
+					log.Printf("[Deletion] user %s paused in %s: %v", job.UserID, job.Phase, err)
+				}
+			}
+		}
+	}()
+	log.Printf("[Deletion] resuming unfinished jobs every %s", deletionCfg.Interval)
+}
+
+func runDeletion(ctx context.Context, job models.UserDeletion) (err error) {
+	span, ctx := tracing.StartSpan(ctx, "user.deletion", job.UserID)
+	span.SetTag("deletion.phase", job.Phase)
+	defer tracing.Finish(span, &err)
+
+	// The outcome is recorded even when the run was cut short
+	recordCtx := context.WithoutCancel(ctx)
+	ctx, cancel := context.WithTimeout(ctx, deletionCfg.RunTimeout)
+	defer cancel()
+
+	err = runPhases(ctx, &job)
+	switch {
+	case err == nil:
+		metrics.Count("user_deletion.completed", 1)
+		metrics.Distribution("user_deletion.duration", time.Since(job.StartedAt).Seconds())
+		log.Printf("[Deletion] user %s purged: %d files, %d objects", job.UserID, job.FilesDeleted, job.ObjectsDeleted)
+		return nil
+	case ctx.Err() != nil:
+		// Out of time rather than failed; the next run continues at the checkpoint
+		if rerr := deletions.ReleaseUserDeletion(recordCtx, job.UserID); rerr != nil {
+			log.Printf("[Deletion] failed to release job of %s: %v", job.UserID, rerr)
+		}
+		return err
+	}
+
+	backoff := util.Backoff{BaseDelay: deletionCfg.BaseDelay, MaxDelay: deletionCfg.MaxDelay}
+	retryAt := time.Now().Add(backoff.Delay(uint64(job.Attempts + 1)))
+	if ferr := deletions.FailUserDeletion(recordCtx, job.UserID, err.Error(), retryAt); ferr != nil {
+		log.Printf("[Deletion] failed to record failure of %s: %v", job.UserID, ferr)
+	}
+	metrics.Count("user_deletion.failed", 1, "phase:"+job.Phase)
+	return err
+}
+
+// runPhases runs the remaining phases of job, checkpointing after each
+// batch. Every phase tolerates being repeated from its last checkpoint.
+func runPhases(ctx context.Context, job *models.UserDeletion) error {
+	for job.Phase != models.DeletionDone {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := runPhase(ctx, job); err != nil {
+			return fmt.Errorf("%s: %w", job.Phase, err)
+		}
+	}
+	return nil
+}
+
+// runPhase runs the current phase of job in its own span
+func runPhase(ctx context.Context, job *models.UserDeletion) (err error) {
+	span, ctx := tracing.StartSpan(ctx, "user.deletion.phase", job.Phase)
+	defer tracing.Finish(span, &err)
+
+	switch job.Phase {
+	case models.DeletionBlockAccess:
+		return blockAccess(ctx, job)
+	case models.DeletionDeleteObjects:
+		return deleteObjects(ctx, job)
+	case models.DeletionDeleteRows:
+		return deleteRows(ctx, job)
+	case models.DeletionDeleteRelated:
+		return deleteRelated(ctx, job)
+	case models.DeletionEmitPurged:
+		return emitPurged(ctx, job)
+	}
+	return fmt.Errorf("unknown phase %q", job.Phase)
+}
+
+func advance(ctx context.Context, job *models.UserDeletion, phase string) error {
+	job.Phase = phase
+	job.Cursor = ""
+	return deletions.CheckpointUserDeletion(ctx, *job, deletionCfg.Lease)
+}
+
+// blockAccess revokes the user's share links. The API already rejects the
+// user, since the job exists.
+func blockAccess(ctx context.Context, job *models.UserDeletion) error {
+	revoked, err := deletions.RevokeAllSharesForUser(ctx, job.UserID)
+	if err != nil {
+		return err
+	}
+	log.Printf("[Deletion] user %s blocked, %d share links revoked", job.UserID, revoked)
+	return advance(ctx, job, models.DeletionDeleteObjects)
+}
+
+// deleteObjects removes the objects and previews of the user's files in
+// batches ordered by file ID; the cursor is the last file handled
+func deleteObjects(ctx context.Context, job *models.UserDeletion) error {
+	for {
+		files, err := deletions.ListUserFilesAfter(ctx, job.UserID, job.Cursor, deletionCfg.BatchSize)
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			return advance(ctx, job, models.DeletionDeleteRows)
+		}
+
+		byBucket := map[string][]string{}
+		for _, metadata := range files {
+			deleted := events.DeletedFileOf(metadata)
+			for _, objectName := range []string{deleted.ObjectName, deleted.PreviewPath} {
+				if objectName != "" {
+					byBucket[deleted.Bucket] = append(byBucket[deleted.Bucket], objectName)
+				}
+			}
+		}
+		for bucket, objectNames := range byBucket {
+			if err := deletions.RemoveObjects(ctx, bucket, objectNames); err != nil {
+				return err
+			}
+			job.ObjectsDeleted += len(objectNames)
+		}
+
+		job.Cursor = files[len(files)-1].ID
+		if err := deletions.CheckpointUserDeletion(ctx, *job, deletionCfg.Lease); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// deleteRows deletes the file rows in batches. Each batch is described by
+// files.deleted.bulk events, so consumers learn about the files and objects
+// of uploads that raced the block are removed by the storage cleanup.
+func deleteRows(ctx context.Context, job *models.UserDeletion) error {
+	for {
+		deleted, err := deletions.DeleteUserFilesBatch(ctx, job.UserID, deletionCfg.BatchSize, func(rows []models.FileMetadata) ([]models.OutboxMessage, error) {
+			return bulkDeleteEvents(ctx, job.UserID, events.DeleteReasonAccountDeletion, rows)
+		})
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return advance(ctx, job, models.DeletionDeleteRelated)
+		}
+
+		job.FilesDeleted += deleted
+		if err := deletions.CheckpointUserDeletion(ctx, *job, deletionCfg.Lease); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// deleteRelated removes the statistics, share links, webhooks and the
+// users/<id>/ folder of the user
+func deleteRelated(ctx context.Context, job *models.UserDeletion) error {
+	if err := deletions.DeleteUserFileStats(ctx, job.UserID); err != nil {
+		return fmt.Errorf("stats: %w", err)
+	}
+	if err := deletions.DeleteSharesForUser(ctx, job.UserID); err != nil {
+		return fmt.Errorf("shares: %w", err)
+	}
+	if err := deletions.DeleteWebhooksForUser(ctx, job.UserID); err != nil {
+		return fmt.Errorf("webhooks: %w", err)
+	}
+	if err := deletions.DeleteObjectsByPrefix(ctx, userFolder(job.UserID)); err != nil {
+		return fmt.Errorf("folder: %w", err)
+	}
+	return advance(ctx, job, models.DeletionEmitPurged)
+}
+
+// emitPurged completes the job and stores users.files.purged in the same
+// transaction
+func emitPurged(ctx context.Context, job *models.UserDeletion) error {
+	msg, err := events.NewOutboxMessage(ctx, events.UserFilesPurged{
+		UserID:         job.UserID,
+		FilesDeleted:   job.FilesDeleted,
+		ObjectsDeleted: job.ObjectsDeleted,
+		StartedAt:      job.StartedAt.UTC(),
+		CompletedAt:    time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := deletions.CompleteUserDeletion(ctx, job.UserID, msg); err != nil {
+		return err
+	}
+	job.Phase = models.DeletionDone
+	job.Status = models.DeletionCompleted
+	return nil
+}
+
+// userFolder is the prefix of the objects kept per user, e.g. users/<id>/.init
+func userFolder(userID string) string {
+	return "users/" + userID + "/"
+}
+
+// accountRecheck is how long a checked account status is trusted. A deletion
+// started on another replica blocks the user after at most this long; the
+// phases tolerate uploads that race the block.
+const accountRecheck = 30 * time.Second
+
+type checkedAccount struct {
+	deleted bool
+	status  string
+	at      time.Time
+}
+
+// checkedAccounts caches the account status per user on this replica
+var checkedAccounts sync.Map
+
+// rememberDeletion blocks the user of job on this replica right away
+func rememberDeletion(job models.UserDeletion) {
+	checkedAccounts.Store(job.UserID, checkedAccount{deleted: true, status: job.Status, at: time.Now()})
+}
+
+// RejectDeletedUsers answers 410 to users whose deletion started. It must run
+// after RequireAuth. The status is looked up at most every accountRecheck per
+// user; when the lookup fails the last known status applies, and a user never
+// checked is let through, since the handlers need the same database.
+func RejectDeletedUsers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.Next()
+			return
+		}
+
+		var account checkedAccount
+		cached, ok := checkedAccounts.Load(userID)
+		if ok {
+			account = cached.(checkedAccount)
+		}
+		if !ok || time.Since(account.at) >= accountRecheck {
+			job, exists, err := deletions.GetUserDeletion(c.Request.Context(), userID)
+			if err != nil {
+				log.Printf("[Deletion] failed to check user %s: %v", userID, err)
+			} else {
+				account = checkedAccount{deleted: exists, status: job.Status, at: time.Now()}
+				checkedAccounts.Store(userID, account)
+			}
+		}
+
+		if account.deleted {
+			c.AbortWithStatusJSON(http.StatusGone, gin.H{"error": "account deleted", "deletion_status": account.status})
+			return
+		}
+		c.Next()
+	}
+}
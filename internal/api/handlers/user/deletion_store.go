@@ -0,0 +1,107 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/command"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/query"
+)
+
+// deletionStore holds the deletion jobs and the data they remove. Tests
+// replace it to interrupt and resume runs without a database.
+type deletionStore interface {
+	GetUserDeletion(ctx context.Context, userID string) (models.UserDeletion, bool, error)
+	ClaimUserDeletion(ctx context.Context, userID string, lease time.Duration) (models.UserDeletion, bool, error)
+	ClaimDueUserDeletions(ctx context.Context, limit int, lease time.Duration) ([]models.UserDeletion, error)
+	CheckpointUserDeletion(ctx context.Context, job models.UserDeletion, lease time.Duration) error
+	FailUserDeletion(ctx context.Context, userID, reason string, retryAt time.Time) error
+	ReleaseUserDeletion(ctx context.Context, userID string) error
+	CompleteUserDeletion(ctx context.Context, userID string, events ...models.OutboxMessage) error
+
+	RevokeAllSharesForUser(ctx context.Context, userID string) (int64, error)
+	ListUserFilesAfter(ctx context.Context, userID, after string, limit int) ([]models.FileMetadata, error)
+	DeleteUserFilesBatch(ctx context.Context, userID string, limit int, events func(deleted []models.FileMetadata) ([]models.OutboxMessage, error)) (int, error)
+	DeleteUserFileStats(ctx context.Context, userID string) error
+	DeleteSharesForUser(ctx context.Context, userID string) error
+	DeleteWebhooksForUser(ctx context.Context, userID string) error
+
+	RemoveObjects(ctx context.Context, bucket string, objectNames []string) error
+	DeleteObjectsByPrefix(ctx context.Context, prefix string) error
+}
+
+var deletions deletionStore = sharedStore{}
+
+// sharedStore is the sharded database and the MinIO service
+type sharedStore struct{}
+
+func (sharedStore) GetUserDeletion(ctx context.Context, userID string) (models.UserDeletion, bool, error) {
+	return query.GetUserDeletion(ctx, userID)
+}
+
+func (sharedStore) ClaimUserDeletion(ctx context.Context, userID string, lease time.Duration) (models.UserDeletion, bool, error) {
+	return command.ClaimUserDeletion(ctx, userID, lease)
+}
+
+func (sharedStore) ClaimDueUserDeletions(ctx context.Context, limit int, lease time.Duration) ([]models.UserDeletion, error) {
+	return command.ClaimDueUserDeletions(ctx, limit, lease)
+}
+
+func (sharedStore) CheckpointUserDeletion(ctx context.Context, job models.UserDeletion, lease time.Duration) error {
+	return command.CheckpointUserDeletion(ctx, job, lease)
+}
+
+func (sharedStore) FailUserDeletion(ctx context.Context, userID, reason string, retryAt time.Time) error {
+	return command.FailUserDeletion(ctx, userID, reason, retryAt)
+}
+
+func (sharedStore) ReleaseUserDeletion(ctx context.Context, userID string) error {
+	return command.ReleaseUserDeletion(ctx, userID)
+}
+
+func (sharedStore) CompleteUserDeletion(ctx context.Context, userID string, events ...models.OutboxMessage) error {
+	return command.CompleteUserDeletion(ctx, userID, events...)
+}
+
+func (sharedStore) RevokeAllSharesForUser(ctx context.Context, userID string) (int64, error) {
+	return command.RevokeAllSharesForUser(ctx, userID)
+}
+
+func (sharedStore) ListUserFilesAfter(ctx context.Context, userID, after string, limit int) ([]models.FileMetadata, error) {
+	return query.ListUserFilesAfter(ctx, userID, after, limit)
+}
+
+func (sharedStore) DeleteUserFilesBatch(ctx context.Context, userID string, limit int, events func(deleted []models.FileMetadata) ([]models.OutboxMessage, error)) (int, error) {
+	return command.DeleteUserFilesBatch(ctx, userID, limit, events)
+}
+
+func (sharedStore) DeleteUserFileStats(ctx context.Context, userID string) error {
+	return command.DeleteUserFileStats(ctx, userID)
+}
+
+func (sharedStore) DeleteSharesForUser(ctx context.Context, userID string) error {
+	return command.DeleteSharesForUser(ctx, userID)
+}
+
+func (sharedStore) DeleteWebhooksForUser(ctx context.Context, userID string) error {
+	return command.DeleteWebhooksForUser(ctx, userID)
+}
+
+func (sharedStore) RemoveObjects(ctx context.Context, bucket string, objectNames []string) error {
+	minioService := services.GetMinioService()
+	if minioService == nil {
+		return errors.New("storage service not available")
+	}
+	return minioService.RemoveObjects(ctx, bucket, objectNames)
+}
+
+func (sharedStore) DeleteObjectsByPrefix(ctx context.Context, prefix string) error {
+	minioService := services.GetMinioService()
+	if minioService == nil {
+		return errors.New("storage service not available")
+	}
+	return minioService.DeleteObjectsByPrefix(ctx, prefix)
+}
@@ -0,0 +1,294 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRunPhasesStopsWithoutStorage(t *testing.T) {
+	done := models.UserDeletion{UserID: "u1", Phase: models.DeletionDone}
+	if err := runPhases(context.Background(), &done); err != nil {
+		t.Fatalf("finished job: %v", err)
+	}
+
+	unknown := models.UserDeletion{UserID: "u1", Phase: "shred"}
+	if err := runPhases(context.Background(), &unknown); err == nil || !strings.Contains(err.Error(), "unknown phase") {
+		t.Fatalf("unknown phase: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	interrupted := models.UserDeletion{UserID: "u1", Phase: models.DeletionDeleteObjects}
+	if err := runPhases(ctx, &interrupted); err != context.Canceled || interrupted.Phase != models.DeletionDeleteObjects {
+		t.Fatalf("cancelled run: %v in %s", err, interrupted.Phase)
+	}
+}
+
+func TestInterruptedDeletionResumesAtCheckpoint(t *testing.T) {
+	store := useMemStore(t, 5)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store.onCheckpoint = func(job models.UserDeletion) {
+		if job.Phase == models.DeletionDeleteObjects && job.Cursor == "f4" {
+			cancel()
+		}
+	}
+
+	if err := RunDeletion(ctx, "u1"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("interrupted run: %v", err)
+	}
+	stored := store.job
+	if stored.Phase != models.DeletionDeleteObjects || stored.Cursor != "f4" || stored.ObjectsDeleted != 4 {
+		t.Fatalf("checkpoint %s at %q with %d objects", stored.Phase, stored.Cursor, stored.ObjectsDeleted)
+	}
+	if !store.lockedUntil.IsZero() {
+		t.Fatal("interrupted run kept its lease")
+	}
+
+	store.onCheckpoint = nil
+	if err := RunDeletion(context.Background(), "u1"); err != nil {
+		t.Fatalf("resumed run: %v", err)
+	}
+	if store.job.Status != models.DeletionCompleted || store.job.FilesDeleted != 5 || store.job.ObjectsDeleted != 5 {
+		t.Fatalf("job %+v", store.job)
+	}
+	for name, n := range store.removed {
+		if n != 1 {
+			t.Fatalf("%s removed %d times", name, n)
+		}
+	}
+	if len(store.removed) != 5 || len(store.files) != 0 {
+		t.Fatalf("removed %d objects, %d rows left", len(store.removed), len(store.files))
+	}
+}
+
+func TestDeletionLeasedByAnotherRunner(t *testing.T) {
+	store := useMemStore(t, 3)
+	store.lockedUntil = time.Now().Add(time.Minute)
+
+	if err := RunDeletion(context.Background(), "u1"); err != nil {
+		t.Fatalf("leased job: %v", err)
+	}
+	if store.checkpoints != 0 || len(store.removed) != 0 || store.job.Phase != models.DeletionBlockAccess {
+		t.Fatalf("ran a leased job: %d checkpoints, %d objects removed, phase %s", store.checkpoints, len(store.removed), store.job.Phase)
+	}
+
+	// The other runner stopped without releasing the job
+	store.lockedUntil = time.Now().Add(-time.Second)
+	if err := RunDeletion(context.Background(), "u1"); err != nil {
+		t.Fatalf("expired lease: %v", err)
+	}
+	if store.job.Status != models.DeletionCompleted {
+		t.Fatalf("job %s in %s", store.job.Status, store.job.Phase)
+	}
+}
+
+func TestRejectDeletedUsersCachesStatus(t *testing.T) {
+	store := useMemStore(t, 0)
+	t.Cleanup(checkedAccounts.Clear)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-User")) }, RejectDeletedUsers())
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+	get := func(userID string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-User", userID)
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for range 3 {
+		if status := get("u1"); status != http.StatusGone {
+			t.Fatalf("deleted user: %d", status)
+		}
+		if status := get("u2"); status != http.StatusOK {
+			t.Fatalf("active user: %d", status)
+		}
+	}
+	if store.lookups != 2 {
+		t.Fatalf("%d lookups for two users", store.lookups)
+	}
+
+	// Once the cached status is stale a failed lookup keeps it
+	store.lookupErr = errors.New("connection refused")
+	for _, userID := range []string{"u1", "u2"} {
+		cached, _ := checkedAccounts.Load(userID)
+		account := cached.(checkedAccount)
+		account.at = time.Now().Add(-accountRecheck)
+		checkedAccounts.Store(userID, account)
+	}
+	if status := get("u1"); status != http.StatusGone {
+		t.Fatalf("deleted user during an outage: %d", status)
+	}
+	if status := get("u2"); status != http.StatusOK {
+		t.Fatalf("active user during an outage: %d", status)
+	}
+	if status := get("u3"); status != http.StatusOK {
+		t.Fatalf("unchecked user during an outage: %d", status)
+	}
+	if store.lookups != 5 {
+		t.Fatalf("%d lookups, want a retry per request while stale", store.lookups)
+	}
+}
+
+// memStore keeps the deletion job of u1 and the files of u1 in memory, with
+// the lease semantics of the database
+type memStore struct {
+	mu          sync.Mutex
+	job         models.UserDeletion
+	lockedUntil time.Time
+	files       []models.FileMetadata
+	// removed counts the removals per object
+	removed      map[string]int
+	checkpoints  int
+	onCheckpoint func(job models.UserDeletion)
+	lookups      int
+	lookupErr    error
+}
+
+// useMemStore replaces the store with a running job of u1 owning files
+// f1 to fN, handled two per batch
+func useMemStore(t *testing.T, files int) *memStore {
+	store := &memStore{
+		job: models.UserDeletion{
+			UserID:    "u1",
+			Status:    models.DeletionRunning,
+			Phase:     models.DeletionBlockAccess,
+			StartedAt: time.Now(),
+		},
+		removed: map[string]int{},
+	}
+	for i := 1; i <= files; i++ {
+		id := fmt.Sprintf("f%d", i)
+		store.files = append(store.files, models.FileMetadata{ID: id, UserID: "u1", FilePath: "users/u1/" + id})
+	}
+
+	previousStore, previousCfg := deletions, deletionCfg
+	deletions = store
+	deletionCfg = DeletionConfig{BatchSize: 2, Lease: time.Minute, RunTimeout: time.Minute, BaseDelay: time.Second, MaxDelay: time.Second}
+	t.Cleanup(func() { deletions, deletionCfg = previousStore, previousCfg })
+	return store
+}
+
+func (s *memStore) GetUserDeletion(_ context.Context, userID string) (models.UserDeletion, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lookups++
+	if s.lookupErr != nil {
+		return models.UserDeletion{}, false, s.lookupErr
+	}
+	return s.job, userID == s.job.UserID, nil
+}
+
+func (s *memStore) ClaimUserDeletion(_ context.Context, userID string, lease time.Duration) (models.UserDeletion, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if userID != s.job.UserID || s.job.Status != models.DeletionRunning || s.lockedUntil.After(time.Now()) {
+		return models.UserDeletion{}, false, nil
+	}
+	s.lockedUntil = time.Now().Add(lease)
+	return s.job, true, nil
+}
+
+func (s *memStore) ClaimDueUserDeletions(ctx context.Context, _ int, lease time.Duration) ([]models.UserDeletion, error) {
+	job, ok, err := s.ClaimUserDeletion(ctx, s.job.UserID, lease)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return []models.UserDeletion{job}, nil
+}
+
+func (s *memStore) CheckpointUserDeletion(_ context.Context, job models.UserDeletion, lease time.Duration) error {
+	s.mu.Lock()
+	s.job.Phase, s.job.Cursor = job.Phase, job.Cursor
+	s.job.FilesDeleted, s.job.ObjectsDeleted = job.FilesDeleted, job.ObjectsDeleted
+	s.lockedUntil = time.Now().Add(lease)
+	s.checkpoints++
+	onCheckpoint := s.onCheckpoint
+	s.mu.Unlock()
+
+	if onCheckpoint != nil {
+		onCheckpoint(job)
+	}
+	return nil
+}
+
+func (s *memStore) FailUserDeletion(_ context.Context, _, reason string, _ time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.job.Attempts++
+	s.job.LastError = reason
+	s.lockedUntil = time.Time{}
+	return nil
+}
+
+func (s *memStore) ReleaseUserDeletion(context.Context, string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lockedUntil = time.Time{}
+	return nil
+}
+
+func (s *memStore) CompleteUserDeletion(context.Context, string, ...models.OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.job.Status, s.job.Phase = models.DeletionCompleted, models.DeletionDone
+	s.lockedUntil = time.Time{}
+	return nil
+}
+
+func (s *memStore) RevokeAllSharesForUser(context.Context, string) (int64, error) {
+	return 0, nil
+}
+
+func (s *memStore) ListUserFilesAfter(_ context.Context, _, after string, limit int) ([]models.FileMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var page []models.FileMetadata
+	for _, metadata := range s.files {
+		if metadata.ID > after && len(page) < limit {
+			page = append(page, metadata)
+		}
+	}
+	return page, nil
+}
+
+func (s *memStore) DeleteUserFilesBatch(_ context.Context, _ string, limit int, events func(deleted []models.FileMetadata) ([]models.OutboxMessage, error)) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch := s.files[:min(limit, len(s.files))]
+	if _, err := events(batch); err != nil {
+		return 0, err
+	}
+	s.files = s.files[len(batch):]
+	return len(batch), nil
+}
+
+func (s *memStore) DeleteUserFileStats(context.Context, string) error   { return nil }
+func (s *memStore) DeleteSharesForUser(context.Context, string) error   { return nil }
+func (s *memStore) DeleteWebhooksForUser(context.Context, string) error { return nil }
+
+func (s *memStore) RemoveObjects(_ context.Context, _ string, objectNames []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range objectNames {
+		s.removed[name]++
+	}
+	return nil
+}
+
+func (s *memStore) DeleteObjectsByPrefix(context.Context, string) error {
+	return nil
+}
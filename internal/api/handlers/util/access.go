@@ -0,0 +1,29 @@
+package util
+
+import (
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/policy"
+	"github.com/gin-gonic/gin"
+)
+
+// EnforceScanPolicy must run before any handler serves file bytes. A rejected
+// request has already been answered when the returned decision is not Allowed.
+func EnforceScanPolicy(c *gin.Context, file models.FileMetadata, requesterID string) policy.Decision {
+	decision := policy.Evaluate(policy.CurrentMode(), file, requesterID)
+
+	if !decision.Allowed {
+		c.AbortWithStatusJSON(decision.Status, gin.H{
+			"error":       decision.Message,
+			"code":        decision.Code,
+			"file_id":     file.ID,
+			"scan_status": file.ScanStatus,
+		})
+		return decision
+	}
+
+	c.Header("X-File-Scan-Status", file.ScanStatus)
+	if decision.Warning != "" {
+		c.Header("Warning", `199 file-service "`+decision.Warning+`"`)
+	}
+	return decision
+}
@@ -0,0 +1,21 @@
+package util
+
+import "time"
+
+// Backoff doubles a retry delay from BaseDelay up to MaxDelay
+type Backoff struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// Delay returns the delay after the given (1-based) attempt
+func (b Backoff) Delay(attempt uint64) time.Duration {
+	delay := b.BaseDelay
+	for i := uint64(1); i < attempt && delay < b.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > b.MaxDelay {
+		delay = b.MaxDelay
+	}
+	return delay
+}
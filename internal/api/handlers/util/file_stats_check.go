@@ -0,0 +1,67 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/metrics"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/projection"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/infrastructure"
+)
+
+// FileStatsCheckConfig controls the periodic comparison of user_file_stats
+// with the files table.
+type FileStatsCheckConfig struct {
+	Interval time.Duration
+	// Repair corrects the drift found; otherwise it is only reported
+	Repair    bool
+	BatchSize int
+	Pause     time.Duration
+}
+
+// StartFileStatsCheck checks every shard for drifted file counts every
+// Interval and reports them as metrics.
+func StartFileStatsCheck(ctx context.Context, cfg FileStatsCheckConfig) {
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			checkFileStats(ctx, cfg)
+		}
+	}()
+	log.Printf("[Projections] checking file stats every %s (repair %t)", cfg.Interval, cfg.Repair)
+}
+
+func checkFileStats(ctx context.Context, cfg FileStatsCheckConfig) {
+	for shard := 0; shard < infrastructure.ShardCount(); shard++ {
+		report, err := projection.RebuildFileStats(ctx, projection.FileStatsOptions{
+			Shard:     &shard,
+			Source:    projection.SourceFiles,
+			DryRun:    !cfg.Repair,
+			BatchSize: cfg.BatchSize,
+			Pause:     cfg.Pause,
+		})
+		if err != nil {
+			log.Printf("[Projections] file stats check of shard %d failed: %v", shard, err)
+			continue
+		}
+
+		tag := fmt.Sprintf("shard:%d", shard)
+		metrics.Gauge("file_stats.drifted_users", float64(report.Drifted), tag)
+		if report.Repaired > 0 {
+			metrics.Count("file_stats.repaired", int64(report.Repaired), tag)
+		}
+		if report.Drifted > 0 {
+			log.Printf("[Projections] shard %d: %d of %d users had a wrong file count, %d repaired (e.g. %+v)",
+				shard, report.Drifted, report.UsersChecked, report.Repaired, report.Differences[0])
+		}
+	}
+}
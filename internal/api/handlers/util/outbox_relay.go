@@ -0,0 +1,104 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/metrics"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/command"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/query"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/tracing"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// OutboxRelayConfig controls how outbox messages are moved to JetStream.
+type OutboxRelayConfig struct {
+	Interval  time.Duration
+	BatchSize int
+	// Failed publishes are retried after BaseDelay, doubling up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Published messages are kept for Retention, then purged
+	Retention time.Duration
+}
+
+// StartOutboxRelay publishes outbox messages of every shard every Interval
+// and reports the backlog as metrics.
+func StartOutboxRelay(ctx context.Context, cfg OutboxRelayConfig) {
+	backoff := Backoff{BaseDelay: cfg.BaseDelay, MaxDelay: cfg.MaxDelay}
+
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		lastPurge := time.Now()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			relayOutbox(cfg.BatchSize, func(attempts int) time.Duration {
+				return backoff.Delay(uint64(attempts))
+			})
+			reportOutboxLag()
+
+			if time.Since(lastPurge) > time.Hour {
+				lastPurge = time.Now()
+				if n, err := command.PurgePublishedOutbox(time.Now().Add(-cfg.Retention)); err != nil {
+					log.Printf("[Outbox] purge failed: %v", err)
+				} else if n > 0 {
+					log.Printf("[Outbox] purged %d published messages", n)
+				}
+			}
+		}
+	}()
+	log.Printf("[Outbox] relaying every %s", cfg.Interval)
+}
+
+// relayOutbox drains due messages until a round leaves the batches short
+func relayOutbox(batchSize int, backoff func(attempts int) time.Duration) {
+	for {
+		published, failed, err := command.RelayOutbox(batchSize, publishOutboxMessage, backoff)
+		if published > 0 {
+			metrics.Count("outbox.published", int64(published))
+		}
+		if failed > 0 {
+			metrics.Count("outbox.failed", int64(failed))
+			log.Printf("[Outbox] %d messages failed to publish, retrying with backoff", failed)
+		}
+		if err != nil {
+			log.Printf("[Outbox] relay failed: %v", err)
+			return
+		}
+		if published < batchSize || failed > 0 {
+			return
+		}
+	}
+}
+
+// publishOutboxMessage publishes msg within the trace of the change that
+// stored it
+func publishOutboxMessage(msg models.OutboxMessage) (err error) {
+	span, ctx := tracing.StartFromCarrier(context.Background(), "outbox.relay", msg.TraceContext, tracer.ResourceName(msg.Subject))
+	defer tracing.Finish(span, &err)
+	return services.PublishRaw(ctx, msg.Subject, msg.Payload, msg.ID)
+}
+
+func reportOutboxLag() {
+	lags, err := query.GetOutboxLag()
+	if err != nil {
+		log.Printf("[Outbox] failed to read lag: %v", err)
+		return
+	}
+	for shard, lag := range lags {
+		tag := fmt.Sprintf("shard:%d", shard)
+		metrics.Gauge("outbox.pending", float64(lag.Pending), tag)
+		metrics.Gauge("outbox.oldest_age_seconds", lag.OldestAge.Seconds(), tag)
+	}
+}
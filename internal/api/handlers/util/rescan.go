@@ -0,0 +1,108 @@
+package util
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/scanner"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/command"
+)
+
+// RescanPolicy decides which clean files are rescanned after a signature update.
+type RescanPolicy struct {
+	CheckInterval time.Duration
+	// Files scanned within MaxAge are always rescanned; at-risk extensions
+	// (executables, macro documents, archives) within AtRiskMaxAge
+	MaxAge           time.Duration
+	AtRiskMaxAge     time.Duration
+	AtRiskExtensions []string
+	// Rate caps requeued files per second so a signature update does not
+	// flood the scanners; BatchSize is claimed per shard per round
+	Rate      int
+	BatchSize int
+}
+
+// ParseExtensions turns ".exe, DOCM,zip" into [".exe" ".docm" ".zip"]
+func ParseExtensions(list string) []string {
+	var extensions []string
+	for _, ext := range strings.Split(list, ",") {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		extensions = append(extensions, ext)
+	}
+	return extensions
+}
+
+// StartSignatureWatcher polls the engine's signature version and requeues
+// recently clean files whenever it changes. Engines without a version are not
+// watched.
+func StartSignatureWatcher(ctx context.Context, engine scanner.Scanner, policy RescanPolicy) {
+	versioned, ok := engine.(scanner.Versioned)
+	if !ok {
+		log.Printf("[Rescan] %s does not report signature versions, rescans disabled", engine.Name())
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(policy.CheckInterval)
+		defer ticker.Stop()
+
+		var last string
+		for {
+			_, signatures, err := versioned.Version(ctx)
+			if err != nil {
+				log.Printf("[Rescan] failed to read signature version: %v", err)
+			} else {
+				if last != "" && signatures != last {
+					log.Printf("[Rescan] signatures updated from %s to %s", last, signatures)
+				}
+				last = signatures
+				// Also catches up on files left over from an earlier update or restart
+				requeueOutdatedScans(ctx, signatures, policy)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Printf("[Rescan] watching %s signatures every %s", engine.Name(), policy.CheckInterval)
+}
+
+func requeueOutdatedScans(ctx context.Context, signatureVersion string, policy RescanPolicy) {
+	interval := time.Second / time.Duration(max(policy.Rate, 1))
+	total := 0
+	for {
+		now := time.Now()
+		files, err := command.ClaimFilesForRescan(signatureVersion, now.Add(-policy.MaxAge), now.Add(-policy.AtRiskMaxAge), policy.AtRiskExtensions, policy.BatchSize)
+		if err != nil {
+			log.Printf("[Rescan] failed to claim files: %v", err)
+			return
+		}
+		if len(files) == 0 {
+			break
+		}
+
+		for _, file := range files {
+			RequeueScan(file.ID, file.UserID, file.FilePath, file.Size, "signature_update")
+			total++
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}
+	if total > 0 {
+		log.Printf("[Rescan] requeued %d files for signatures %s", total, signatureVersion)
+	}
+}
@@ -1,54 +1,227 @@
 package util
 
 import (
-	"fmt"
+	"context"
+	"io"
 	"log"
-	"os"
+	"strings"
 	"time"
 
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/scanner"
 	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
 	"github.com/File-Sharing-BondBridg/File-Service/internal/services/command"
-	clamd "github.com/dutchcoders/go-clamd"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/query"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/tracing"
+	"github.com/minio/minio-go/v7"
 )
 
-func ScanFile(fileID, userID, objectName, clamAvUrl string) {
+// ScanError describes why a scan did not produce a verdict. Transient errors
+// are worth retrying; permanent ones are recorded as scan_error right away.
+type ScanError struct {
+	Reason    string
+	Permanent bool
+	Err       error
+}
+
+func (e *ScanError) Error() string {
+	if e.Err != nil {
+		return e.Reason + ": " + e.Err.Error()
+	}
+	return e.Reason
+}
+
+func (e *ScanError) Unwrap() error { return e.Err }
+
+// ScanFile streams an uploaded object through the configured scanner engines
+// and records the verdict on the file row. Archives are checked against the
+// inspector's limits first, when one is given. ctx bounds the whole scan.
+func ScanFile(ctx context.Context, engine scanner.Scanner, inspector *scanner.ArchiveInspector, fileID, userID, objectName string) (err error) {
+	span, ctx := tracing.StartSpan(ctx, "scan.file", fileID)
+	defer tracing.Finish(span, &err)
+
 	minioService := services.GetMinioService()
-	tempPath := fmt.Sprintf("/tmp/%s", objectName)
+	if minioService == nil {
+		return &ScanError{Reason: "storage not initialized"}
+	}
 
-	// Download from MinIO for scanning
-	if err := minioService.DownloadFile(objectName, tempPath); err != nil {
-		log.Println("Failed to download for scanning:", err)
-		return
+	previous, exists := query.GetFileMetadataForUser(ctx, fileID, userID)
+	if !exists {
+		return &ScanError{Reason: "file not found", Permanent: true}
 	}
-	defer os.Remove(tempPath)
 
-	// Connect to ClamAV
-	c := clamd.NewClamd(clamAvUrl)
-	response, err := c.ScanFile(tempPath)
+	// Stream straight from MinIO into the engines; nothing touches the local disk
+	obj, info, err := minioService.GetObject(ctx, objectName)
+	quarantined := false
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		// An earlier delivery may have quarantined the object and failed to
+		// record it; scan it where it is and finish the job
+		obj, info, err = minioService.GetQuarantinedObject(ctx, objectName)
+		quarantined = err == nil
+	}
 	if err != nil {
-		log.Println("Scan failed:", err)
-		return
-	}
-
-	status := "clean"
-	for res := range response {
-		if res.Status == clamd.RES_FOUND {
-			log.Printf("Virus detected in %s: %s", fileID, res.Description)
-			status = "infected"
-
-			// delete infected file
-			err := minioService.DeleteFile(objectName)
-			if err != nil {
-				log.Println("Failed to delete infected file:", err)
-				return
-			}
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return &ScanError{Reason: "object not found", Permanent: true, Err: err}
+		}
+		return &ScanError{Reason: "failed to open object", Err: err}
+	}
+	defer obj.Close()
+
+	verdict := scanner.Verdict{Status: scanner.StatusClean}
+	if inspector != nil {
+		verdict = inspector.Inspect(ctx, obj, info.Size)
+		if verdict.Detail != "" {
+			log.Printf("Archive inspection of %s: %s", fileID, verdict.Detail)
+		}
+		// The inspector reads at random offsets; the engines stream from the start
+		if _, err := obj.Seek(0, io.SeekStart); err != nil {
+			return &ScanError{Reason: "failed to rewind object", Err: err}
+		}
+	}
+	if verdict.Status == scanner.StatusClean {
+		verdict = engine.Scan(ctx, obj, info.Size)
+	}
+	if ctx.Err() != nil {
+		return &ScanError{Reason: "scan timed out", Err: ctx.Err()}
+	}
+
+	result := models.ScanResult{
+		ScannedAt:        time.Now(),
+		Engine:           verdict.EngineVersion,
+		SignatureVersion: verdict.SignatureVersion,
+	}
+	if result.Engine == "" {
+		result.Engine = verdict.Engine
+	}
+
+	switch verdict.Status {
+	case scanner.StatusInfected:
+		log.Printf("Virus detected in %s by %s: %v", fileID, verdict.Engine, verdict.Signatures)
+		result.Status = models.ScanStatusInfected
+		result.Signature = strings.Join(verdict.Signatures, ", ")
+		if err := quarantineFile(ctx, fileID, userID, objectName, result); err != nil {
+			return err
+		}
+		if previous.ScanStatus == models.ScanStatusClean {
+			publishReclassified(ctx, previous, result)
+		}
+		PublishScanCompleted(ctx, fileID, userID, result, "")
+		return nil
+	case scanner.StatusRejected:
+		log.Printf("Archive %s rejected: %s (%s)", fileID, verdict.Reason, verdict.Detail)
+		result.Status = archiveRejectionStatus(verdict.Reason)
+		result.Signature = verdict.Detail
+	case scanner.StatusError:
+		return &ScanError{Reason: verdict.Engine + " failed: " + verdict.Reason}
+	case scanner.StatusSkipped:
+		log.Printf("File %s (%d bytes) not scanned by %s: %s", fileID, info.Size, verdict.Engine, verdict.Reason)
+		result.Status = models.ScanStatusSkipped
+		if strings.Contains(verdict.Reason, scanner.ReasonTooLarge) {
+			result.Status = models.ScanStatusTooLarge
+		}
+	default:
+		result.Status = models.ScanStatusClean
+	}
+
+	if quarantined {
+		if err := minioService.ReleaseObject(ctx, objectName); err != nil {
+			return &ScanError{Reason: "failed to release object", Err: err}
 		}
 	}
 
 	// Update metadata
-	if err := command.UpdateFileScanStatus(fileID, userID, status, time.Now()); err != nil {
-		log.Println("Failed to update scan status:", err)
-	} else {
-		log.Printf("Scan finished for %s: %s", fileID, status)
+	if err := command.UpdateFileScanStatus(ctx, fileID, userID, result); err != nil {
+		return &ScanError{Reason: "failed to update scan status", Err: err}
+	}
+	log.Printf("Scan finished for %s: %s (%s %s)", fileID, result.Status, result.Engine, result.SignatureVersion)
+	PublishScanCompleted(ctx, fileID, userID, result, "")
+	return nil
+}
+
+// PublishScanCompleted announces a final scan result. reason is set when the
+// scan gave up with scan_error.
+func PublishScanCompleted(ctx context.Context, fileID, userID string, result models.ScanResult, reason string) {
+	completedEvent := events.ScanCompleted{
+		FileID:           fileID,
+		UserID:           userID,
+		Status:           result.Status,
+		Signature:        result.Signature,
+		Engine:           result.Engine,
+		SignatureVersion: result.SignatureVersion,
+		Error:            reason,
+		ScannedAt:        result.ScannedAt.UTC(),
+	}
+
+	if err := events.Publish(ctx, completedEvent); err != nil {
+		log.Printf("warning: failed to publish files.scan.completed event: %v", err)
+	}
+}
+
+// archiveRejectionStatus maps an inspector reason to the status stored on the file
+func archiveRejectionStatus(reason string) string {
+	switch reason {
+	case scanner.ReasonArchiveTooLarge:
+		return models.ScanStatusArchiveTooLarge
+	case scanner.ReasonArchiveRatio:
+		return models.ScanStatusArchiveRatio
+	case scanner.ReasonArchiveEntries:
+		return models.ScanStatusArchiveEntries
+	case scanner.ReasonArchiveDepth:
+		return models.ScanStatusArchiveDepth
+	case scanner.ReasonArchiveEncrypted:
+		return models.ScanStatusArchiveEncrypted
+	default:
+		return models.ScanStatusSkipped
+	}
+}
+
+// quarantineFile moves an infected object out of the files bucket and records
+// the matched signature, so the row never points at a missing object. The move
+// is idempotent, so a redelivery after a failed write only updates the row.
+func quarantineFile(ctx context.Context, fileID, userID, objectName string, result models.ScanResult) error {
+	minioService := services.GetMinioService()
+
+	if err := minioService.QuarantineObject(ctx, objectName); err != nil {
+		return &ScanError{Reason: "failed to quarantine infected file", Err: err}
+	}
+
+	if err := command.QuarantineFile(ctx, fileID, userID, minioService.QuarantineBucket, result); err != nil {
+		return &ScanError{Reason: "failed to record quarantine", Err: err}
+	}
+	log.Printf("File %s quarantined (%s)", fileID, result.Signature)
+
+	quarantineEvent := events.FileQuarantined{
+		FileID:     fileID,
+		UserID:     userID,
+		ObjectName: objectName,
+		Bucket:     minioService.QuarantineBucket,
+		Signature:  result.Signature,
+		ScannedAt:  result.ScannedAt.UTC(),
+	}
+
+	if err := events.Publish(ctx, quarantineEvent); err != nil {
+		log.Printf("warning: failed to publish files.quarantined event: %v", err)
+	}
+	return nil
+}
+
+// publishReclassified tells the owner that a file previously scanned clean
+// matched a newer signature
+func publishReclassified(ctx context.Context, previous models.FileMetadata, result models.ScanResult) {
+	reclassifiedEvent := events.ScanReclassified{
+		FileID:                   previous.ID,
+		UserID:                   previous.UserID,
+		FileName:                 previous.OriginalName,
+		PreviousStatus:           previous.ScanStatus,
+		PreviousSignatureVersion: previous.SignatureVersion,
+		Status:                   result.Status,
+		Signature:                result.Signature,
+		SignatureVersion:         result.SignatureVersion,
+		ScannedAt:                result.ScannedAt.UTC(),
+	}
+
+	if err := events.Publish(ctx, reclassifiedEvent); err != nil {
+		log.Printf("warning: failed to publish files.scan.reclassified event: %v", err)
 	}
 }
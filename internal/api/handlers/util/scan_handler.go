@@ -0,0 +1,122 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/scanner"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/command"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/tracing"
+	"github.com/nats-io/nats.go"
+)
+
+// ScanRetryPolicy bounds a single scan and how often a failed one is
+// retried; redeliveries are delayed by the embedded Backoff
+type ScanRetryPolicy struct {
+	Backoff
+	Timeout    time.Duration
+	MaxDeliver int
+}
+
+// ScanConsumer names the scan consumers in the processed-message ledger
+const ScanConsumer = "file_service_scan"
+
+type scanRequest struct {
+	FileID     string
+	UserID     string
+	ObjectName string
+	Size       int64
+	// Key identifies the request in the processed-message ledger: an upload
+	// is scanned once, every requeue is a new request
+	Key string
+}
+
+// decodeScanRequest reads a files.uploaded or files.scan.requeued message
+func decodeScanRequest(msg *nats.Msg) (scanRequest, error) {
+	if services.OriginalSubject(msg) == events.SubjectScanRequeued {
+		e, env, err := events.Decode[events.ScanRequeued](msg.Data)
+		return scanRequest{e.FileID, e.UserID, e.ObjectName, e.Size, env.ID}, err
+	}
+	e, _, err := events.Decode[events.FileUploaded](msg.Data)
+	return scanRequest{e.FileID, e.UserID, e.ObjectName, e.Size, events.SubjectFileUploaded + ":" + e.FileID}, err
+}
+
+// NewScanHandler handles files.uploaded and files.scan.requeued messages.
+// Transient failures are redelivered with exponential backoff until
+// MaxDeliver is reached; then, or on a permanent failure, the file is marked
+// scan_error with the reason. Requests that ran out of retries and malformed
+// ones are moved to the dead-letter stream. inspector may be nil to skip
+// archive checks.
+func NewScanHandler(engine scanner.Scanner, inspector *scanner.ArchiveInspector, retry ScanRetryPolicy) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		log.Printf("[JetStream] %s message: %s", msg.Subject, string(msg.Data))
+
+		req, err := decodeScanRequest(msg)
+		if err != nil {
+			// Redelivery cannot fix a malformed request
+			log.Printf("[JetStream] invalid scan request on %s: %v", msg.Subject, err)
+			_ = services.DeadLetter(msg, err.Error())
+			return
+		}
+
+		if events.AlreadyProcessed(ScanConsumer, req.Key) {
+			log.Printf("[JetStream] %s of %s already scanned, skipping", msg.Subject, req.FileID)
+			ack(msg)
+			return
+		}
+
+		attempt := uint64(1)
+		if meta, err := msg.Metadata(); err == nil {
+			attempt = meta.NumDelivered
+		}
+
+		// The pool bypasses the router, so the consumer span starts here
+		span, spanCtx := tracing.StartConsumerSpan(context.Background(), msg, ScanConsumer)
+		defer tracing.Finish(span, &err)
+
+		ctx, cancel := context.WithTimeout(spanCtx, retry.Timeout)
+		err = ScanFile(ctx, engine, inspector, req.FileID, req.UserID, req.ObjectName)
+		cancel()
+
+		if err == nil {
+			events.MarkProcessed(ScanConsumer, req.Key)
+			ack(msg)
+			return
+		}
+
+		var scanErr *ScanError
+		permanent := errors.As(err, &scanErr) && scanErr.Permanent
+		final := permanent || (retry.MaxDeliver > 0 && attempt >= uint64(retry.MaxDeliver))
+
+		log.Printf("[JetStream] scan of %s failed (attempt %d, final=%t): %v", req.FileID, attempt, final, err)
+		if rerr := command.RecordScanFailure(spanCtx, req.FileID, req.UserID, err.Error(), final); rerr != nil {
+			log.Printf("[JetStream] failed to record scan failure for %s: %v", req.FileID, rerr)
+		}
+
+		if final {
+			PublishScanCompleted(spanCtx, req.FileID, req.UserID, models.ScanResult{Status: models.ScanStatusError, ScannedAt: time.Now()}, err.Error())
+			if permanent {
+				ack(msg)
+				return
+			}
+			// Out of retries; keep the request so it can be replayed once
+			// the scanner is healthy again
+			_ = services.DeadLetter(msg, err.Error())
+			return
+		}
+		if nerr := msg.NakWithDelay(retry.Delay(attempt)); nerr != nil {
+			log.Printf("[JetStream] nak failed: %v", nerr)
+		}
+	}
+}
+
+func ack(msg *nats.Msg) {
+	if err := msg.Ack(); err != nil {
+		log.Printf("[JetStream] ack failed: %v", err)
+	}
+}
@@ -0,0 +1,291 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/metrics"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	"github.com/nats-io/nats.go"
+)
+
+// ScanPoolConfig sizes the scan worker pool of one replica.
+type ScanPoolConfig struct {
+	Workers int
+	// Buffer is how many fetched messages may wait for a worker; the pool
+	// picks the smallest file among them
+	Buffer int
+	// AckWait is the consumer's AckWait; held messages are marked in progress
+	// well before it runs out
+	AckWait time.Duration
+	// MaxPriorityWait stops small files from starving large ones: a message
+	// buffered for longer is handled before any smaller file
+	MaxPriorityWait time.Duration
+}
+
+// ScanPoolStatus is a snapshot of the pool and its consumers' backlog.
+type ScanPoolStatus struct {
+	Workers   int                    `json:"workers"`
+	Busy      int                    `json:"busy"`
+	Buffered  int                    `json:"buffered"`
+	Consumers []services.ConsumerLag `json:"consumers"`
+}
+
+type pooledMsg struct {
+	msg        *nats.Msg
+	size       int64
+	receivedAt time.Time
+}
+
+// ScanPool pulls scan requests from JetStream pull consumers and runs them on
+// a fixed number of workers, smallest file first.
+type ScanPool struct {
+	cfg       ScanPoolConfig
+	handler   nats.MsgHandler
+	durables  []string
+	slots     chan struct{}
+	available chan struct{}
+
+	mu       sync.Mutex
+	buffered []pooledMsg
+	inFlight map[*nats.Msg]struct{}
+	busy     int
+}
+
+var activeScanPool *ScanPool
+
+// minHeartbeatInterval bounds how often held messages are marked in progress
+const minHeartbeatInterval = 100 * time.Millisecond
+
+func NewScanPool(handler nats.MsgHandler, cfg ScanPoolConfig) *ScanPool {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.Buffer < cfg.Workers {
+		cfg.Buffer = cfg.Workers
+	}
+	if cfg.AckWait <= 0 {
+		cfg.AckWait = time.Minute
+	}
+	return &ScanPool{
+		cfg:       cfg,
+		handler:   handler,
+		slots:     make(chan struct{}, cfg.Buffer),
+		available: make(chan struct{}, cfg.Buffer),
+		inFlight:  make(map[*nats.Msg]struct{}),
+	}
+}
+
+// Start runs the pool until ctx is done. Each subscription must be a pull
+// subscription on a durable consumer.
+func (p *ScanPool) Start(ctx context.Context, subs map[string]*nats.Subscription) {
+	for durable, sub := range subs {
+		p.durables = append(p.durables, durable)
+		go p.fetch(ctx, durable, sub)
+	}
+	for i := 0; i < p.cfg.Workers; i++ {
+		go p.work(ctx)
+	}
+	go p.heartbeat(ctx)
+
+	activeScanPool = p
+	log.Printf("[ScanPool] %d workers, %d buffered messages", p.cfg.Workers, p.cfg.Buffer)
+}
+
+// PullReplays feeds dead letters replayed to the pool's consumers to the same
+// workers. Each subscription must be a pull subscription on the replay
+// consumer of the durable it is keyed by.
+func (p *ScanPool) PullReplays(ctx context.Context, subs map[string]*nats.Subscription) {
+	for durable, sub := range subs {
+		go p.fetch(ctx, durable+" replays", sub)
+	}
+}
+
+// fetch pulls as many messages as there are free buffer slots
+func (p *ScanPool) fetch(ctx context.Context, durable string, sub *nats.Subscription) {
+	for {
+		// Block for one slot, then grab whatever else is free
+		select {
+		case <-ctx.Done():
+			return
+		case p.slots <- struct{}{}:
+		}
+		batch := 1
+	grab:
+		for batch < p.cfg.Buffer {
+			select {
+			case p.slots <- struct{}{}:
+				batch++
+			default:
+				break grab
+			}
+		}
+
+		msgs, err := sub.Fetch(batch, nats.MaxWait(5*time.Second))
+		if err != nil && !errors.Is(err, nats.ErrTimeout) && !errors.Is(err, context.DeadlineExceeded) {
+			log.Printf("[ScanPool] fetch from %s failed: %v", durable, err)
+			time.Sleep(time.Second)
+		}
+		for i := len(msgs); i < batch; i++ {
+			<-p.slots
+		}
+
+		now := time.Now()
+		p.mu.Lock()
+		for _, msg := range msgs {
+			p.buffered = append(p.buffered, pooledMsg{msg: msg, size: scanRequestSize(msg), receivedAt: now})
+			p.inFlight[msg] = struct{}{}
+		}
+		p.mu.Unlock()
+		for range msgs {
+			p.available <- struct{}{}
+		}
+	}
+}
+
+func (p *ScanPool) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.available:
+		}
+
+		msg := p.next()
+		start := time.Now()
+		p.handler(msg)
+		metrics.Distribution("scan.duration", time.Since(start).Seconds())
+
+		p.mu.Lock()
+		delete(p.inFlight, msg)
+		p.busy--
+		p.mu.Unlock()
+		<-p.slots
+	}
+}
+
+// next takes the message to handle: the oldest one that waited longer than
+// MaxPriorityWait, otherwise the smallest file
+func (p *ScanPool) next() *nats.Msg {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pick := 0
+	for i, m := range p.buffered {
+		best := p.buffered[pick]
+		if p.overdue(best) {
+			if p.overdue(m) && m.receivedAt.Before(best.receivedAt) {
+				pick = i
+			}
+			continue
+		}
+		if p.overdue(m) || m.size < best.size {
+			pick = i
+		}
+	}
+
+	m := p.buffered[pick]
+	p.buffered = append(p.buffered[:pick], p.buffered[pick+1:]...)
+	p.busy++
+	return m.msg
+}
+
+func (p *ScanPool) overdue(m pooledMsg) bool {
+	return p.cfg.MaxPriorityWait > 0 && time.Since(m.receivedAt) > p.cfg.MaxPriorityWait
+}
+
+// heartbeat keeps JetStream from redelivering messages that are buffered or
+// still being scanned
+func (p *ScanPool) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(p.heartbeatInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		p.mu.Lock()
+		msgs := make([]*nats.Msg, 0, len(p.inFlight))
+		for msg := range p.inFlight {
+			msgs = append(msgs, msg)
+		}
+		p.mu.Unlock()
+
+		for _, msg := range msgs {
+			if err := msg.InProgress(); err != nil {
+				log.Printf("[ScanPool] in-progress ack failed: %v", err)
+			}
+		}
+	}
+}
+
+// heartbeatInterval marks held messages in progress three times per AckWait
+func (p *ScanPool) heartbeatInterval() time.Duration {
+	return max(p.cfg.AckWait/3, minHeartbeatInterval)
+}
+
+// Status reports the pool's load and the JetStream backlog of its consumers
+func (p *ScanPool) Status() ScanPoolStatus {
+	p.mu.Lock()
+	status := ScanPoolStatus{Workers: p.cfg.Workers, Busy: p.busy, Buffered: len(p.buffered)}
+	p.mu.Unlock()
+
+	for _, durable := range p.durables {
+		lag, err := services.GetConsumerLag(durable)
+		if err != nil {
+			log.Printf("[ScanPool] failed to read lag of %s: %v", durable, err)
+			continue
+		}
+		status.Consumers = append(status.Consumers, lag)
+	}
+	return status
+}
+
+// StartScanQueueReporter publishes the pool status as gauges so the scan
+// workers can be autoscaled on queue depth.
+func (p *ScanPool) StartScanQueueReporter(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			status := p.Status()
+			metrics.Gauge("scan.workers", float64(status.Workers))
+			metrics.Gauge("scan.workers_busy", float64(status.Busy))
+			metrics.Gauge("scan.buffered", float64(status.Buffered))
+			for _, lag := range status.Consumers {
+				tag := "consumer:" + lag.Consumer
+				metrics.Gauge("scan.queue.pending", float64(lag.Pending), tag)
+				metrics.Gauge("scan.queue.ack_pending", float64(lag.AckPending), tag)
+				metrics.Gauge("scan.queue.redelivered", float64(lag.Redelivered), tag)
+			}
+		}
+	}()
+}
+
+// GetScanPoolStatus returns the status of the running pool, if any
+func GetScanPoolStatus() (ScanPoolStatus, bool) {
+	if activeScanPool == nil {
+		return ScanPoolStatus{}, false
+	}
+	return activeScanPool.Status(), true
+}
+
+// scanRequestSize reads the size of a scan request; invalid requests sort
+// first so they are terminated right away
+func scanRequestSize(msg *nats.Msg) int64 {
+	req, _ := decodeScanRequest(msg)
+	return req.Size
+}
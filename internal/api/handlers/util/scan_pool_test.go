@@ -0,0 +1,149 @@
+package util
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestScanPoolPicksSmallestThenOverdue(t *testing.T) {
+	pool := NewScanPool(nil, ScanPoolConfig{Workers: 1, Buffer: 4, AckWait: time.Minute, MaxPriorityWait: time.Minute})
+
+	now := time.Now()
+	large := &nats.Msg{Subject: "large"}
+	small := &nats.Msg{Subject: "small"}
+	medium := &nats.Msg{Subject: "medium"}
+	stale := &nats.Msg{Subject: "stale"}
+	pool.buffered = []pooledMsg{
+		{msg: large, size: 1 << 30, receivedAt: now},
+		{msg: small, size: 1 << 10, receivedAt: now},
+		{msg: medium, size: 1 << 20, receivedAt: now},
+		{msg: stale, size: 2 << 30, receivedAt: now.Add(-2 * time.Minute)},
+	}
+
+	for _, want := range []*nats.Msg{stale, small, medium, large} {
+		if got := pool.next(); got != want {
+			t.Fatalf("got %s, want %s", got.Subject, want.Subject)
+		}
+	}
+	if pool.busy != 4 || len(pool.buffered) != 0 {
+		t.Fatalf("busy=%d buffered=%d", pool.busy, len(pool.buffered))
+	}
+}
+
+func TestScanPoolHeartbeatInterval(t *testing.T) {
+	for _, tt := range []struct {
+		ackWait time.Duration
+		want    time.Duration
+	}{
+		{time.Minute, 20 * time.Second},
+		{0, 20 * time.Second},
+		{-time.Second, 20 * time.Second},
+		{2 * time.Nanosecond, minHeartbeatInterval},
+	} {
+		pool := NewScanPool(nil, ScanPoolConfig{AckWait: tt.ackWait})
+		if got := pool.heartbeatInterval(); got != tt.want {
+			t.Errorf("AckWait %s: heartbeat every %s, want %s", tt.ackWait, got, tt.want)
+		}
+	}
+}
+
+// Messages that are scanned or buffered for longer than AckWait must not be
+// redelivered
+func TestScanPoolHeartbeatKeepsMessagesInProgress(t *testing.T) {
+	js := runJetStream(t)
+	const ackWait = 500 * time.Millisecond
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "SCANS", Subjects: []string{"scan.>"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := js.AddConsumer("SCANS", &nats.ConsumerConfig{
+		Durable:    "scanner",
+		AckPolicy:  nats.AckExplicitPolicy,
+		AckWait:    ackWait,
+		MaxDeliver: 5,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := js.PullSubscribe("scan.>", "scanner", nats.Bind("SCANS", "scanner"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	handled := map[string]int{}
+	done := make(chan struct{}, 2)
+	pool := NewScanPool(func(msg *nats.Msg) {
+		time.Sleep(3 * ackWait)
+		mu.Lock()
+		handled[string(msg.Data)]++
+		mu.Unlock()
+		_ = msg.Ack()
+		done <- struct{}{}
+	}, ScanPoolConfig{Workers: 1, Buffer: 4, AckWait: ackWait})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool.Start(ctx, map[string]*nats.Subscription{"scanner": sub})
+
+	for _, data := range []string{"a", "b"} {
+		if _, err := js.Publish("scan.request", []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 2 {
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("messages not handled")
+		}
+	}
+	// Give a redelivery the chance to show up
+	time.Sleep(2 * ackWait)
+
+	info, err := js.ConsumerInfo("SCANS", "scanner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if handled["a"] != 1 || handled["b"] != 1 || info.Delivered.Consumer != 2 || info.NumAckPending != 0 {
+		t.Fatalf("handled %v, %d deliveries, %d pending", handled, info.Delivered.Consumer, info.NumAckPending)
+	}
+}
+
+func runJetStream(t *testing.T) nats.JetStreamContext {
+	t.Helper()
+	srv, err := natsserver.NewServer(&natsserver.Options{
+		Host:      "127.0.0.1",
+		Port:      natsserver.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start()
+	t.Cleanup(func() {
+		srv.Shutdown()
+		srv.WaitForShutdown()
+	})
+	if !srv.ReadyForConnections(10 * time.Second) {
+		t.Fatal("nats server did not start")
+	}
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return js
+}
@@ -0,0 +1,52 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/metrics"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+)
+
+// HandleFileDeleted removes the objects of a deleted file
+func HandleFileDeleted(_ context.Context, event events.FileDeleted, _ events.Envelope) error {
+	return removeObjects(event.Reason, []events.DeletedFile{event.Objects()})
+}
+
+// HandleFilesDeleted removes the objects of a batch of deleted files
+func HandleFilesDeleted(_ context.Context, event events.FilesDeleted, _ events.Envelope) error {
+	return removeObjects(event.Reason, event.Files)
+}
+
+// removeObjects deletes the object and the derived preview of each file.
+// Removing a missing object succeeds, so a redelivered event only repeats
+// the deletes that did not happen yet.
+func removeObjects(reason string, files []events.DeletedFile) error {
+	minioService := services.GetMinioService()
+	if minioService == nil {
+		return errors.New("storage service not available")
+	}
+
+	removed := 0
+	for _, file := range files {
+		for _, objectName := range []string{file.ObjectName, file.PreviewPath} {
+			if objectName == "" {
+				continue
+			}
+			if err := minioService.RemoveObject(file.Bucket, objectName); err != nil {
+				return fmt.Errorf("remove %s of %s: %w", objectName, file.FileID, err)
+			}
+			removed++
+		}
+	}
+
+	if reason == "" {
+		reason = events.DeleteReasonUser
+	}
+	metrics.Count("storage_cleanup.objects_removed", int64(removed), "reason:"+reason)
+	log.Printf("[Cleanup] removed %d objects of %d deleted files (%s)", removed, len(files), reason)
+	return nil
+}
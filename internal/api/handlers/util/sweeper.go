@@ -0,0 +1,66 @@
+package util
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/command"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/query"
+)
+
+// StartPendingScanSweeper periodically requeues files that have been pending
+// for longer than stuckAfter, e.g. because their files.uploaded message was lost.
+func StartPendingScanSweeper(ctx context.Context, interval, stuckAfter time.Duration, batchSize int) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sweepPendingScans(stuckAfter, batchSize)
+			}
+		}
+	}()
+	log.Printf("[Sweeper] requeuing files pending longer than %s every %s", stuckAfter, interval)
+}
+
+func sweepPendingScans(stuckAfter time.Duration, batchSize int) {
+	files, err := query.ListStalePendingFiles(time.Now().Add(-stuckAfter), batchSize)
+	if err != nil {
+		log.Printf("[Sweeper] failed to list stale pending files: %v", err)
+		return
+	}
+
+	for _, file := range files {
+		RequeueScan(file.ID, file.UserID, file.FilePath, file.Size, "stuck_pending")
+	}
+	if len(files) > 0 {
+		log.Printf("[Sweeper] requeued %d stuck files", len(files))
+	}
+}
+
+// RequeueScan publishes a scan request for an already stored file. size lets
+// the scan pool put small files first.
+func RequeueScan(fileID, userID, objectName string, size int64, reason string) {
+	requeueEvent := events.ScanRequeued{
+		FileID:     fileID,
+		UserID:     userID,
+		ObjectName: objectName,
+		Size:       size,
+		Reason:     reason,
+		RequeuedAt: time.Now().UTC(),
+	}
+
+	if err := events.Publish(context.Background(), requeueEvent); err != nil {
+		log.Printf("[Sweeper] failed to requeue scan of %s: %v", fileID, err)
+		return
+	}
+	if err := command.MarkScanRequeued(fileID, userID); err != nil {
+		log.Printf("[Sweeper] failed to mark %s as requeued: %v", fileID, err)
+	}
+}
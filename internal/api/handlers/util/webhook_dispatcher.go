@@ -0,0 +1,187 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/metrics"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/command"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/query"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/webhook"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+)
+
+// WebhookConsumer is the durable consumer that queues webhook deliveries
+const WebhookConsumer = "file_service_webhooks"
+
+// HandleWebhookEvent queues a delivery of a file event for every enabled
+// subscription of its user, or of the user's organizations, that asked for
+// the event type. Deliveries are unique per subscription and event, so a
+// redelivered message queues nothing new.
+func HandleWebhookEvent(_ context.Context, msg *nats.Msg) error {
+	env, payload, ok := events.Unwrap(msg.Data)
+	if !ok {
+		// Bare payloads carry no event ID to deduplicate deliveries on
+		log.Printf("[Webhooks] skipped %s without envelope", msg.Subject)
+		return nil
+	}
+	if !slices.Contains(webhook.EventTypes, env.Type) {
+		return nil
+	}
+
+	var owner struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.Unmarshal(payload, &owner); err != nil || owner.UserID == "" {
+		return fmt.Errorf("%w: %s without user_id", events.ErrInvalidEvent, env.Type)
+	}
+
+	subs, err := query.MatchWebhookSubscriptions(owner.UserID, env.Type)
+	if err != nil {
+		return fmt.Errorf("failed to match webhook subscriptions: %w", err)
+	}
+	for _, sub := range subs {
+		delivery := models.WebhookDelivery{
+			ID:             uuid.New().String(),
+			SubscriptionID: sub.ID,
+			EventID:        env.ID,
+			EventType:      env.Type,
+			Payload:        msg.Data,
+		}
+		if err := command.EnqueueWebhookDeliveries(sub, []models.WebhookDelivery{delivery}); err != nil {
+			return fmt.Errorf("failed to queue webhook delivery for %s: %w", sub.ID, err)
+		}
+	}
+	if len(subs) > 0 {
+		metrics.Count("webhook.queued", int64(len(subs)), "event_type:"+env.Type)
+	}
+	return nil
+}
+
+// WebhookDispatcherConfig controls how queued deliveries are sent.
+type WebhookDispatcherConfig struct {
+	Interval    time.Duration
+	BatchSize   int
+	Concurrency int
+	// A failed delivery is retried after BaseDelay, doubling up to MaxDelay,
+	// until MaxAttempts attempts were made
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// DisableAfter consecutive failed attempts disable a subscription
+	DisableAfter int
+	// Finished deliveries are kept in the log for Retention
+	Retention time.Duration
+	// Lease is how long a claimed delivery is hidden from other replicas;
+	// it must exceed the sender's timeout
+	Lease time.Duration
+}
+
+// StartWebhookDispatcher sends due deliveries of every shard every Interval.
+func StartWebhookDispatcher(ctx context.Context, cfg WebhookDispatcherConfig, sender *webhook.Sender) {
+	backoff := Backoff{BaseDelay: cfg.BaseDelay, MaxDelay: cfg.MaxDelay}
+
+	go func() {
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		lastPurge := time.Now()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			dispatchWebhooks(ctx, cfg, sender, backoff)
+
+			if time.Since(lastPurge) > time.Hour {
+				lastPurge = time.Now()
+				if n, err := command.PurgeWebhookDeliveries(time.Now().Add(-cfg.Retention)); err != nil {
+					log.Printf("[Webhooks] purge failed: %v", err)
+				} else if n > 0 {
+					log.Printf("[Webhooks] purged %d deliveries", n)
+				}
+			}
+		}
+	}()
+	log.Printf("[Webhooks] dispatching every %s", cfg.Interval)
+}
+
+// dispatchWebhooks sends batches until a round leaves them short
+func dispatchWebhooks(ctx context.Context, cfg WebhookDispatcherConfig, sender *webhook.Sender, backoff Backoff) {
+	send := func(deliveries []models.WebhookDelivery) []models.WebhookAttempt {
+		return sendWebhooks(ctx, sender, deliveries, cfg.Concurrency, func(d models.WebhookDelivery, result webhook.Result) models.WebhookAttempt {
+			return webhookAttempt(d, result, cfg.MaxAttempts, backoff, time.Now())
+		})
+	}
+
+	for {
+		sent, disabled, err := command.DispatchWebhooks(cfg.BatchSize, cfg.Lease, cfg.DisableAfter, send)
+		for _, id := range disabled {
+			log.Printf("[Webhooks] disabled subscription %s after %d consecutive failures", id, cfg.DisableAfter)
+			metrics.Count("webhook.disabled", 1)
+		}
+		if err != nil {
+			log.Printf("[Webhooks] dispatch failed: %v", err)
+			return
+		}
+		if sent < cfg.BatchSize || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// sendWebhooks sends deliveries with up to concurrency requests in flight
+// and returns the attempts in the order of deliveries
+func sendWebhooks(ctx context.Context, sender *webhook.Sender, deliveries []models.WebhookDelivery, concurrency int, outcome func(models.WebhookDelivery, webhook.Result) models.WebhookAttempt) []models.WebhookAttempt {
+	attempts := make([]models.WebhookAttempt, len(deliveries))
+	sem := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+
+	for i, d := range deliveries {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			result := sender.Send(ctx, d.URL, d.Secret, d.EventID, d.EventType, d.Payload)
+			status := "delivered"
+			if !result.OK() {
+				status = "failed"
+			}
+			metrics.Distribution("webhook.duration", float64(result.Duration.Milliseconds()), "event_type:"+d.EventType, "outcome:"+status)
+			metrics.Count("webhook.attempts", 1, "event_type:"+d.EventType, "outcome:"+status)
+			attempts[i] = outcome(d, result)
+		}()
+	}
+	wg.Wait()
+	return attempts
+}
+
+// webhookAttempt decides what happens after sending d: failed attempts are
+// retried with backoff until maxAttempts were made
+func webhookAttempt(d models.WebhookDelivery, result webhook.Result, maxAttempts int, backoff Backoff, now time.Time) models.WebhookAttempt {
+	attempt := models.WebhookAttempt{Delivered: result.OK(), StatusCode: result.StatusCode}
+	if attempt.Delivered {
+		return attempt
+	}
+
+	attempt.Error = result.Err.Error()
+	if made := d.Attempts + 1; made < maxAttempts {
+		retryAt := now.Add(backoff.Delay(uint64(made)))
+		attempt.RetryAt = &retryAt
+	}
+	return attempt
+}
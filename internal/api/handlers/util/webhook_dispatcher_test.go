@@ -0,0 +1,88 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/webhook"
+)
+
+func TestWebhookAttemptBacksOffUntilMaxAttempts(t *testing.T) {
+	backoff := Backoff{BaseDelay: time.Minute, MaxDelay: 10 * time.Minute}
+	now := time.Now()
+	failure := webhook.Result{StatusCode: 500, Err: errors.New("status 500")}
+
+	for _, tc := range []struct {
+		attempts int
+		retryIn  time.Duration
+	}{
+		{0, time.Minute},
+		{1, 2 * time.Minute},
+		{3, 8 * time.Minute},
+		{4, 10 * time.Minute},
+		{5, 0}, // the sixth attempt was the last
+	} {
+		attempt := webhookAttempt(models.WebhookDelivery{Attempts: tc.attempts}, failure, 6, backoff, now)
+		if attempt.Delivered || attempt.Error != "status 500" || attempt.StatusCode != 500 {
+			t.Fatalf("attempt %+v", attempt)
+		}
+		switch {
+		case tc.retryIn == 0 && attempt.RetryAt != nil:
+			t.Fatalf("after %d attempts: retry at %v, want none", tc.attempts+1, attempt.RetryAt)
+		case tc.retryIn != 0 && (attempt.RetryAt == nil || attempt.RetryAt.Sub(now) != tc.retryIn):
+			t.Fatalf("after %d attempts: retry at %v, want in %v", tc.attempts+1, attempt.RetryAt, tc.retryIn)
+		}
+	}
+
+	if attempt := webhookAttempt(models.WebhookDelivery{Attempts: 2}, webhook.Result{StatusCode: 200}, 6, backoff, now); !attempt.Delivered || attempt.RetryAt != nil {
+		t.Fatalf("success %+v", attempt)
+	}
+}
+
+func TestSendWebhooksKeepsOrder(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+		}
+	}))
+	defer receiver.Close()
+
+	var deliveries []models.WebhookDelivery
+	for i := 0; i < 6; i++ {
+		path := "/ok"
+		if i%3 == 2 {
+			path = "/gone"
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{ID: path, URL: receiver.URL + path, Secret: "whsec_x", EventID: "evt", EventType: "files.uploaded", Payload: []byte(`{}`)})
+	}
+
+	attempts := sendWebhooks(context.Background(), webhook.NewSender(time.Second, true), deliveries, 2, func(_ models.WebhookDelivery, result webhook.Result) models.WebhookAttempt {
+		return models.WebhookAttempt{Delivered: result.OK(), StatusCode: result.StatusCode}
+	})
+
+	for i, attempt := range attempts {
+		want := deliveries[i].ID == "/ok"
+		if attempt.Delivered != want {
+			t.Fatalf("delivery %d (%s): delivered %t, status %d", i, deliveries[i].ID, attempt.Delivered, attempt.StatusCode)
+		}
+	}
+	if peak.Load() > 2 {
+		t.Fatalf("%d requests in flight, limit 2", peak.Load())
+	}
+}
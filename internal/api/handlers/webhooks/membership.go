@@ -0,0 +1,53 @@
+package webhooks
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/cmd/middleware"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/command"
+	"github.com/gin-gonic/gin"
+)
+
+// membershipRefresh bounds how often the memberships of one user are written
+const membershipRefresh = time.Hour
+
+type seenMemberships struct {
+	organizations string
+	at            time.Time
+}
+
+// recorded caches the memberships last written per user on this replica
+var recorded sync.Map
+
+// TrackOrganizations records the organizations in the caller's token, so
+// events of the caller reach the webhooks of those organizations. Events
+// carry only a user ID, and tokens are the only source of memberships.
+func TrackOrganizations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := userIDFromContext(c)
+		if !exists {
+			c.Next()
+			return
+		}
+
+		organizations := middleware.Organizations(c)
+		key := strings.Join(organizations, ",")
+		if seen, ok := recorded.Load(userID); ok {
+			last := seen.(seenMemberships)
+			if last.organizations == key && time.Since(last.at) < membershipRefresh {
+				c.Next()
+				return
+			}
+		}
+
+		if err := command.SetOrganizationMemberships(userID, organizations); err != nil {
+			log.Printf("[Webhooks] failed to record organizations of %s: %v", userID, err)
+		} else {
+			recorded.Store(userID, seenMemberships{organizations: key, at: time.Now()})
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,321 @@
+package webhooks
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/cmd/middleware"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/command"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/query"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/webhook"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+var (
+	sender        = webhook.NewSender(10*time.Second, false)
+	allowInsecure bool
+	allowPrivate  bool
+)
+
+// Configure sets the sender used for test events and whether plain http
+// receiver URLs and receivers on private networks are accepted
+func Configure(s *webhook.Sender, allowHTTP, allowPrivateNetworks bool) {
+	sender = s
+	allowInsecure = allowHTTP
+	allowPrivate = allowPrivateNetworks
+}
+
+type createWebhookRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	// Organization makes the subscription receive events of every member
+	Organization string `json:"organization"`
+	// Secret is generated when empty
+	Secret string `json:"secret"`
+}
+
+// CreateWebhook subscribes a URL to file events of the caller or of one of
+// the caller's organizations. The secret is only returned here.
+func CreateWebhook(c *gin.Context) {
+	userID, exists := userIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	var req createWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	if err := webhook.ValidateURL(req.URL, allowInsecure, allowPrivate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := webhook.ValidateEventTypes(req.EventTypes); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Organization != "" && !slices.Contains(middleware.Organizations(c), req.Organization) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "not a member of the organization"})
+		return
+	}
+	if req.Secret != "" && len(req.Secret) < 16 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "secret must have at least 16 characters"})
+		return
+	}
+
+	if req.Secret == "" {
+		secret, err := webhook.NewSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create secret"})
+			return
+		}
+		req.Secret = secret
+	}
+
+	sub := models.WebhookSubscription{
+		ID:           uuid.New().String(),
+		UserID:       userID,
+		Organization: req.Organization,
+		URL:          req.URL,
+		EventTypes:   req.EventTypes,
+		Secret:       req.Secret,
+		CreatedAt:    time.Now(),
+	}
+	if err := command.CreateWebhookSubscription(sub); err != nil {
+		log.Printf("Error creating webhook subscription: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create webhook"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"webhook": sub})
+}
+
+// ListWebhooks lists the caller's subscriptions and those of the caller's
+// organizations.
+func ListWebhooks(c *gin.Context) {
+	userID, exists := userIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	subs := []models.WebhookSubscription{}
+	for _, organization := range append([]string{""}, middleware.Organizations(c)...) {
+		found, err := query.ListWebhookSubscriptions(userID, organization)
+		if err != nil {
+			log.Printf("Error listing webhook subscriptions: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list webhooks"})
+			return
+		}
+		subs = append(subs, found...)
+	}
+	for i := range subs {
+		subs[i].Secret = ""
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhooks": subs})
+}
+
+func GetWebhook(c *gin.Context) {
+	sub, ok := webhookFromRequest(c)
+	if !ok {
+		return
+	}
+	sub.Secret = ""
+	c.JSON(http.StatusOK, gin.H{"webhook": sub})
+}
+
+type updateWebhookRequest struct {
+	URL        *string  `json:"url"`
+	EventTypes []string `json:"event_types"`
+	// Enabled re-enables a subscription disabled after failures
+	Enabled *bool `json:"enabled"`
+}
+
+// UpdateWebhook changes the URL or event types of a subscription, or
+// re-enables it.
+func UpdateWebhook(c *gin.Context) {
+	sub, ok := webhookFromRequest(c)
+	if !ok {
+		return
+	}
+
+	var req updateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+		return
+	}
+	if req.Enabled != nil && !*req.Enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "delete the webhook to stop deliveries"})
+		return
+	}
+	if req.URL != nil {
+		if err := webhook.ValidateURL(*req.URL, allowInsecure, allowPrivate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		sub.URL = *req.URL
+	}
+	if req.EventTypes != nil {
+		if err := webhook.ValidateEventTypes(req.EventTypes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		sub.EventTypes = req.EventTypes
+	}
+
+	enable := req.Enabled != nil && *req.Enabled
+	if err := command.UpdateWebhookSubscription(sub, enable); err != nil {
+		log.Printf("Error updating webhook subscription: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update webhook"})
+		return
+	}
+	if enable {
+		sub.DisabledAt, sub.DisabledReason, sub.ConsecutiveFailures = nil, "", 0
+	}
+
+	sub.Secret = ""
+	c.JSON(http.StatusOK, gin.H{"webhook": sub})
+}
+
+// DeleteWebhook removes a subscription together with its delivery log.
+func DeleteWebhook(c *gin.Context) {
+	sub, ok := webhookFromRequest(c)
+	if !ok {
+		return
+	}
+	if err := command.DeleteWebhookSubscription(sub); err != nil {
+		log.Printf("Error deleting webhook subscription: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete webhook"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted", "webhook_id": sub.ID})
+}
+
+// ListWebhookDeliveries pages through the delivery log of a subscription,
+// newest first. ?status= filters by pending, delivered or failed.
+func ListWebhookDeliveries(c *gin.Context) {
+	sub, ok := webhookFromRequest(c)
+	if !ok {
+		return
+	}
+
+	status := c.Query("status")
+	switch status {
+	case "", models.WebhookPending, models.WebhookDelivered, models.WebhookFailed:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, delivered or failed"})
+		return
+	}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "50"))
+	if err != nil || pageSize < 1 {
+		pageSize = 50
+	}
+	if pageSize > 500 {
+		pageSize = 500
+	}
+
+	deliveries, err := query.GetWebhookDeliveryPage(sub, status, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Printf("Error fetching webhook deliveries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"page":       page,
+		"pageSize":   pageSize,
+	})
+}
+
+// SendTestWebhook sends a webhook.test event to the subscription right away
+// and reports whether the receiver accepted it. Nothing of the receiver's
+// response is returned, so the endpoint cannot be used to read other hosts.
+// The attempt is logged but neither retried nor counted towards disabling
+// the subscription.
+func SendTestWebhook(c *gin.Context) {
+	sub, ok := webhookFromRequest(c)
+	if !ok {
+		return
+	}
+
+	env, body, err := events.Marshal(webhook.TestEvent{SubscriptionID: sub.ID, UserID: sub.UserID, SentAt: time.Now().UTC()})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build test event"})
+		return
+	}
+
+	result := sender.Send(c.Request.Context(), sub.URL, sub.Secret, env.ID, env.Type, body)
+
+	now := time.Now()
+	delivery := models.WebhookDelivery{
+		ID:             uuid.New().String(),
+		SubscriptionID: sub.ID,
+		EventID:        env.ID,
+		EventType:      env.Type,
+		Payload:        body,
+		Status:         models.WebhookDelivered,
+		Attempts:       1,
+		LastStatusCode: result.StatusCode,
+		CreatedAt:      now,
+		LastAttemptAt:  &now,
+	}
+	if result.OK() {
+		delivery.DeliveredAt = &now
+	} else {
+		delivery.Status = models.WebhookFailed
+		delivery.LastError = result.Err.Error()
+	}
+	if err := command.LogWebhookDelivery(sub, delivery); err != nil {
+		log.Printf("Error logging webhook test delivery: %v", err)
+	}
+
+	answer := gin.H{
+		"delivered":   result.OK(),
+		"delivery_id": delivery.ID,
+		"duration_ms": result.Duration.Milliseconds(),
+	}
+	if !result.OK() {
+		answer["error"] = "the receiver did not accept the test event"
+	}
+	c.JSON(http.StatusOK, answer)
+}
+
+// webhookFromRequest loads the subscription named by :id if the caller owns
+// it or belongs to its organization; otherwise it writes the error response.
+func webhookFromRequest(c *gin.Context) (models.WebhookSubscription, bool) {
+	userID, exists := userIDFromContext(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return models.WebhookSubscription{}, false
+	}
+
+	sub, found := query.GetWebhookSubscription(c.Param("id"), userID, middleware.Organizations(c))
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook not found"})
+		return models.WebhookSubscription{}, false
+	}
+	return sub, true
+}
+
+func userIDFromContext(c *gin.Context) (string, bool) {
+	id, exists := c.Get("user_id")
+	if !exists {
+		return "", false
+	}
+	return id.(string), true
+}
@@ -2,8 +2,16 @@ package api
 
 import (
 	"github.com/File-Sharing-BondBridg/File-Service/cmd/middleware"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/admin"
 	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/file"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/share"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/stream"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/user"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/webhooks"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/infrastructure"
 	"github.com/gin-gonic/gin"
+	gintrace "gopkg.in/DataDog/dd-trace-go.v1/contrib/gin-gonic/gin"
 )
 
 func corsMiddleware() gin.HandlerFunc {
@@ -22,20 +30,120 @@ func corsMiddleware() gin.HandlerFunc {
 func RegisterRoutes(r *gin.RouterGroup) {
 	// Enable CORS for preflight requests
 	r.Use(corsMiddleware())
+
+	// Live file events; registered before RequireAuth as EventSource cannot send headers
+	r.GET("/events", middleware.RequireStreamAuth(), user.RejectDeletedUsers(), stream.Events)
+
 	r.Use(middleware.RequireAuth())
+	r.Use(user.RejectDeletedUsers())
+	r.Use(webhooks.TrackOrganizations())
 
 	r.GET("/files/health", handlers.HealthCheck)
 
 	// File endpoints
 	r.POST("/files/upload", handlers.UploadFile) // upload a file
 
-	r.GET("/files", handlers.ListFiles)            // list all uploaded files
-	r.GET("/files/:id", handlers.GetFile)          // Get single file
-	r.GET("/files/:id/info", handlers.GetFileInfo) // Get file metadata
+	r.GET("/files", handlers.ListFiles)               // list all uploaded files
+	r.GET("/files/:id", handlers.GetFile)             // Get single file
+	r.GET("/files/:id/info", handlers.GetFileInfo)    // Get file metadata
+	r.GET("/files/:id/preview", handlers.PreviewFile) // Inline preview (?size=... for the thumbnail)
 
 	// Download a specific file
 	r.GET("/files/:id/download", handlers.DownloadFile) // Download file
 	r.DELETE("/files/:id/delete", handlers.DeleteFile)  // Delete file
 
 	r.GET("/files/stats", handlers.GetMyFileStats)
+
+	// Share links
+	r.POST("/files/:id/shares", share.CreateShare)        // Create a public share link
+	r.DELETE("/shares/:id", share.RevokeShare)            // Revoke a share link
+	r.GET("/shares/:id/accesses", share.GetShareAccesses) // Access log and aggregate counts
+
+	// Webhooks
+	r.POST("/webhooks", webhooks.CreateWebhook) // Returns the signing secret once
+	r.GET("/webhooks", webhooks.ListWebhooks)
+	r.GET("/webhooks/:id", webhooks.GetWebhook)
+	r.PATCH("/webhooks/:id", webhooks.UpdateWebhook) // Change URL or event types, or re-enable
+	r.DELETE("/webhooks/:id", webhooks.DeleteWebhook)
+	r.GET("/webhooks/:id/deliveries", webhooks.ListWebhookDeliveries) // Delivery log
+	r.POST("/webhooks/:id/test", webhooks.SendTestWebhook)            // Send a webhook.test event now
+
+	// Admin endpoints
+	adminGroup := r.Group("/admin", middleware.RequireRole("admin"))
+	adminGroup.GET("/quarantine", admin.ListQuarantinedFiles)
+	adminGroup.GET("/quarantine/:id/download", admin.DownloadQuarantinedFile) // For analysis only
+	adminGroup.POST("/quarantine/:id/release", admin.ReleaseQuarantinedFile)
+	adminGroup.DELETE("/quarantine/:id", admin.DeleteQuarantinedFile) // Permanent
+	adminGroup.PUT("/files/:id/scan-override", admin.SetScanOverride) // Bypass the scan access policy
+	adminGroup.GET("/scan-queue", admin.GetScanQueue)                 // Scan backlog and worker load
+	adminGroup.GET("/dlq", admin.ListDeadLetters)                     // Messages consumers gave up on
+	adminGroup.GET("/dlq/:seq", admin.GetDeadLetter)
+	adminGroup.PUT("/dlq/:seq", admin.EditDeadLetter) // Fix the payload before a replay
+	adminGroup.POST("/dlq/:seq/replay", admin.ReplayDeadLetter)
+	adminGroup.DELETE("/dlq/:seq", admin.DiscardDeadLetter)
+	adminGroup.GET("/users/:id/deletion", admin.GetUserDeletion)    // Progress of an account deletion
+	adminGroup.POST("/users/:id/deletion", admin.StartUserDeletion) // Start, or resume now
+	adminGroup.POST("/projections/file-stats/rebuild", admin.RebuildFileStats)
+}
+
+// RegisterPublicRoutes registers endpoints that are reachable without a token.
+func RegisterPublicRoutes(r *gin.RouterGroup) {
+	r.Use(corsMiddleware())
+
+	r.GET("/shares/:token", share.DownloadSharedFile) // Download through a share link
+}
+
+// NewRouter builds the HTTP server: tracing, CORS, the health check and the
+// /api and /public routes. The access log redacts tokens in query strings.
+func NewRouter() *gin.Engine {
+	r := gin.New()
+	r.Use(middleware.Logger(), gin.Recovery())
+
+	r.Use(gintrace.Middleware("file-service"))
+	r.Use(func(c *gin.Context) {
+		c.Header("Access-Control-Allow-Origin", "*")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+		if c.Request.Method == "OPTIONS" {
+			c.AbortWithStatus(204)
+			return
+		}
+
+		c.Next()
+	})
+
+	r.GET("/health", func(c *gin.Context) {
+		stats := infrastructure.GetStats()
+		minioService := services.GetMinioService()
+		var minioStatus string
+
+		if minioService != nil {
+			// Test MinIO connection
+			if err := minioService.CheckConnection(); err == nil {
+				minioStatus = "connected"
+			} else {
+				minioStatus = "degraded"
+			}
+		} else {
+			minioStatus = "failed"
+		}
+
+		c.JSON(200, gin.H{
+			"status": "ok",
+			"storage": gin.H{
+				"postgres": "connected",
+				"minio":    minioStatus,
+			},
+			"stats": stats,
+		})
+	})
+
+	apiGroup := r.Group("/api")
+	RegisterRoutes(apiGroup)
+
+	publicGroup := r.Group("/public")
+	RegisterPublicRoutes(publicGroup)
+
+	return r
 }
@@ -0,0 +1,161 @@
+// Package app wires the parts of the service that main and the test
+// harness start alike.
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/cmd/middleware"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/stream"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/user"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/util"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/configuration"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
+	natsclient "github.com/File-Sharing-BondBridg/File-Service/internal/nats"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/rpc"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/scanner"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	"github.com/nats-io/nats.go"
+)
+
+// SetupNATS connects to NATS and starts the event consumers of this replica:
+// the scan pool, the event router, the live event hub and, when enabled, the
+// request-reply API. Only a failed connection is an error; consumers that
+// fail to start are logged.
+func SetupNATS(natsURL string, engine scanner.Scanner, scanCfg configuration.ScanConfig, consumerCfg configuration.ConsumerConfig, rpcCfg configuration.RPCConfig, webhookCfg configuration.WebhookConfig) error {
+	nc, js, err := services.ConnectNATS(natsURL)
+	if err != nil {
+		return fmt.Errorf("connect to NATS/JetStream: %w", err)
+	}
+
+	if err := services.EnsureDeadLetterStream(consumerCfg.DeadLetterMaxAge); err != nil {
+		log.Printf("Failed to ensure dead-letter stream: %v", err)
+	}
+
+	// Redelivered messages are skipped once recorded in the ledger
+	if ledger, err := services.NewKVLedger(consumerCfg.LedgerTTL); err != nil {
+		log.Printf("Processed-message ledger disabled: %v", err)
+	} else {
+		events.UseLedger(ledger)
+	}
+
+	var inspector *scanner.ArchiveInspector
+	if scanCfg.Archive.Enabled {
+		inspector = scanner.NewArchiveInspector(scanner.ArchiveLimits{
+			MaxDecompressedSize: scanCfg.Archive.MaxDecompressedSize,
+			MaxRatio:            float64(scanCfg.Archive.MaxRatio),
+			MaxEntries:          scanCfg.Archive.MaxEntries,
+			MaxDepth:            scanCfg.Archive.MaxDepth,
+			RejectEncrypted:     scanCfg.Archive.RejectEncrypted,
+		})
+	}
+
+	// Scan requests: new uploads and files requeued by the sweeper or after a
+	// signature update. They are pulled by a worker pool instead of running
+	// one at a time in a push callback.
+	scanHandler := util.NewScanHandler(engine, inspector, util.ScanRetryPolicy{
+		Backoff:    util.Backoff{BaseDelay: scanCfg.RetryBaseDelay, MaxDelay: scanCfg.RetryMaxDelay},
+		Timeout:    scanCfg.Timeout,
+		MaxDeliver: scanCfg.MaxDeliver,
+	})
+
+	scanSubs := map[string]*nats.Subscription{}
+	replaySubs := map[string]*nats.Subscription{}
+	for _, consumer := range []struct{ subject, durable, replaces string }{
+		{events.SubjectFileUploaded, "file_service_scan", "file_service_preview"},
+		{events.SubjectScanRequeued, "file_service_scan_requeued", "file_service_rescan"},
+	} {
+		// Continues where the old push consumer stopped instead of replaying the stream
+		if err := services.EnsurePullConsumer(consumer.subject, consumer.durable, consumer.replaces, scanCfg.MaxDeliver, scanCfg.AckWait); err != nil {
+			log.Printf("Failed to create consumer %s: %v", consumer.durable, err)
+			continue
+		}
+
+		sub, err := services.PullSubscribeEvent(consumer.subject, consumer.durable)
+		if err != nil {
+			log.Printf("Failed to subscribe to %s: %v", consumer.subject, err)
+			continue
+		}
+		scanSubs[consumer.durable] = sub
+		log.Printf("Subscribed to %s (durable scan pull consumer %s)", consumer.subject, consumer.durable)
+
+		if err := services.EnsureReplayConsumer(consumer.durable, scanCfg.MaxDeliver, scanCfg.AckWait); err != nil {
+			log.Printf("Failed to create replay consumer %s: %v", consumer.durable, err)
+			continue
+		}
+		if replays, err := services.PullSubscribeReplays(consumer.durable); err != nil {
+			log.Printf("Failed to subscribe to replays of %s: %v", consumer.durable, err)
+		} else {
+			replaySubs[consumer.durable] = replays
+		}
+	}
+
+	pool := util.NewScanPool(scanHandler, util.ScanPoolConfig{
+		Workers:         scanCfg.Workers,
+		Buffer:          scanCfg.Buffer,
+		AckWait:         scanCfg.AckWait,
+		MaxPriorityWait: scanCfg.PriorityMaxWait,
+	})
+	pool.Start(context.Background(), scanSubs)
+	pool.PullReplays(context.Background(), replaySubs)
+	pool.StartScanQueueReporter(context.Background(), 15*time.Second)
+
+	router := natsclient.NewRouter(&natsclient.Client{Conn: nc, JS: js})
+	router.Use(
+		natsclient.Recover(),
+		natsclient.Tracing(),
+		natsclient.Logging(slog.Default()),
+		natsclient.Metrics(),
+		natsclient.Timeout(),
+	)
+	route := func(subject, durable string, handler natsclient.Handler, opts ...nats.SubOpt) natsclient.Route {
+		return natsclient.Route{
+			Subject:    subject,
+			Durable:    durable,
+			Handler:    handler,
+			MaxDeliver: consumerCfg.MaxDeliverFor(durable),
+			AckWait:    consumerCfg.AckWait,
+			Options:    opts,
+		}
+	}
+
+	// Storage cleanup after deletes; objects of files deleted before this
+	// consumer existed were removed synchronously, so only new events matter
+	router.Handle(route(events.SubjectFileDeleted, "file_service_storage_cleanup", natsclient.Typed(util.HandleFileDeleted), nats.DeliverNew()))
+	router.Handle(route(events.SubjectFilesDeleted, "file_service_storage_cleanup_bulk", natsclient.Typed(util.HandleFilesDeleted), nats.DeliverNew()))
+	router.Handle(route(events.SubjectUserDeleted, user.CleanupConsumer, natsclient.Typed(user.HandleUserDeleted)))
+	userInit := route(events.SubjectUserSynced, "file_service_user_init", natsclient.Typed(user.HandleUserSynced))
+	userInit.Timeout = 5 * time.Second
+	router.Handle(userInit)
+	if webhookCfg.Enabled {
+		// Events published before the consumer existed are not sent
+		router.Handle(route("files.>", util.WebhookConsumer, util.HandleWebhookEvent, nats.DeliverNew()))
+	}
+	if err := router.Start(); err != nil {
+		log.Printf("Some event consumers are not running: %v", err)
+	}
+
+	// Fan out file events to Server-Sent Events clients on this replica
+	if err := stream.StartHub(); err != nil {
+		log.Printf("Failed to start event stream hub: %v", err)
+	}
+
+	// Request-reply API for other services, load balanced over all replicas
+	if rpcCfg.Enabled {
+		if _, err := rpc.Start(nc, rpc.Config{
+			QueueGroup: rpcCfg.QueueGroup,
+			Timeout:    rpcCfg.Timeout,
+			ACL:        rpc.ParseACL(rpcCfg.AllowedClients),
+			Verify:     middleware.VerifyServiceToken,
+		}); err != nil {
+			log.Printf("Failed to start RPC service: %v", err)
+		}
+	}
+
+	log.Println("NATS/JetStream setup completed")
+	return nil
+}
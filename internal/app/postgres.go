@@ -0,0 +1,35 @@
+package app
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/configuration"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/infrastructure"
+)
+
+// SetupPostgres connects the configured shards and routes users to them with
+// the configured resolver
+func SetupPostgres(cfg configuration.DatabaseConfig) error {
+	shards, err := cfg.Shards()
+	if err != nil {
+		return fmt.Errorf("invalid shard configuration: %w", err)
+	}
+
+	connections := make([]string, len(shards))
+	weights := make([]int, len(shards))
+	for i, shard := range shards {
+		connections[i] = shard.URL
+		weights[i] = shard.Weight
+	}
+	resolver, err := infrastructure.NewResolver(cfg.Resolver, weights, cfg.VirtualNodes)
+	if err != nil {
+		return fmt.Errorf("invalid shard resolver: %w", err)
+	}
+
+	if err := infrastructure.InitializePostgresShards(connections, resolver); err != nil {
+		return err
+	}
+	log.Printf("PostgreSQL initialized with %d shards, resolver %s", len(shards), resolver)
+	return nil
+}
@@ -0,0 +1,21 @@
+package configuration
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateRejectsNonPositiveAckWait(t *testing.T) {
+	valid := Config{Scan: ScanConfig{AckWait: time.Minute}, Consumers: ConsumerConfig{AckWait: 30 * time.Second}}
+	if err := valid.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, ackWait := range []time.Duration{0, -time.Second} {
+		scan, consumers := valid, valid
+		scan.Scan.AckWait = ackWait
+		consumers.Consumers.AckWait = ackWait
+		if scan.Validate() == nil || consumers.Validate() == nil {
+			t.Fatalf("AckWait %s accepted", ackWait)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package configuration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ShardConfig is one database of the shard topology
+type ShardConfig struct {
+	ID  int    `json:"id"`
+	URL string `json:"url"`
+	// Weight scales the share of users of the shard under the ring
+	// resolver; it defaults to 1
+	Weight int `json:"weight,omitempty"`
+}
+
+// shardFile is the format of PG_SHARDS_FILE:
+//
+//	{"shards": [{"id": 0, "url": "postgres://..."}, {"id": 1, "url": "postgres://...", "weight": 2}]}
+type shardFile struct {
+	Shards []ShardConfig `json:"shards"`
+}
+
+// Shards returns the configured shards ordered by ID. The shards come from
+// PG_SHARDS_FILE or PG_SHARDS, falling back to PG_SHARD_0 and PG_SHARD_1. The
+// IDs must be 0 to N-1; a single shard is fine.
+func (c DatabaseConfig) Shards() ([]ShardConfig, error) {
+	shards, err := c.shardList()
+	if err != nil {
+		return nil, err
+	}
+	if len(shards) == 0 {
+		return nil, errors.New("no database shards configured")
+	}
+
+	sort.Slice(shards, func(i, j int) bool { return shards[i].ID < shards[j].ID })
+	for i, shard := range shards {
+		if i > 0 && shard.ID == shards[i-1].ID {
+			return nil, fmt.Errorf("shard %d is configured twice", shard.ID)
+		}
+		if shard.ID != i {
+			return nil, fmt.Errorf("shard IDs must be 0 to %d, got %d", len(shards)-1, shard.ID)
+		}
+		if shard.URL == "" {
+			return nil, fmt.Errorf("shard %d has no connection string", shard.ID)
+		}
+		if shard.Weight < 0 {
+			return nil, fmt.Errorf("shard %d has a negative weight", shard.ID)
+		}
+		if shard.Weight == 0 {
+			shards[i].Weight = 1
+		}
+	}
+	return shards, nil
+}
+
+func (c DatabaseConfig) shardList() ([]ShardConfig, error) {
+	switch {
+	case c.ShardFile != "" && c.ShardList != "":
+		return nil, errors.New("set PG_SHARDS_FILE or PG_SHARDS, not both")
+	case c.ShardFile != "":
+		data, err := os.ReadFile(c.ShardFile)
+		if err != nil {
+			return nil, fmt.Errorf("read shard file: %w", err)
+		}
+		var file shardFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("parse shard file %s: %w", c.ShardFile, err)
+		}
+		return file.Shards, nil
+	case c.ShardList != "":
+		return parseShardList(c.ShardList)
+	}
+
+	var shards []ShardConfig
+	for id, url := range []string{c.Shard0, c.Shard1} {
+		if url != "" {
+			shards = append(shards, ShardConfig{ID: id, URL: url})
+		}
+	}
+	return shards, nil
+}
+
+// parseShardList parses PG_SHARDS, e.g.
+// "0=postgres://db0/files,1=postgres://db1/files"
+func parseShardList(list string) ([]ShardConfig, error) {
+	var shards []ShardConfig
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, url, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("shard entry %q is not id=url", entry)
+		}
+		parsed, err := strconv.Atoi(strings.TrimSpace(id))
+		if err != nil {
+			return nil, fmt.Errorf("shard entry %q: invalid ID", entry)
+		}
+		shards = append(shards, ShardConfig{ID: parsed, URL: strings.TrimSpace(url)})
+	}
+	return shards, nil
+}
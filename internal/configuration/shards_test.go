@@ -0,0 +1,70 @@
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestShards(t *testing.T) {
+	file := writeFile(t, `{"shards": [{"id": 1, "url": "postgres://b"}, {"id": 0, "url": "postgres://a", "weight": 2}]}`)
+
+	tests := []struct {
+		name   string
+		config DatabaseConfig
+		want   []string
+	}{
+		{"legacy", DatabaseConfig{Shard0: "postgres://a", Shard1: "postgres://b"}, []string{"postgres://a", "postgres://b"}},
+		{"single shard", DatabaseConfig{ShardList: "0=postgres://a?sslmode=disable"}, []string{"postgres://a?sslmode=disable"}},
+		{"list in any order", DatabaseConfig{ShardList: "2=postgres://c, 0=postgres://a,1=postgres://b", Shard0: "ignored"}, []string{"postgres://a", "postgres://b", "postgres://c"}},
+		{"file", DatabaseConfig{ShardFile: file}, []string{"postgres://a", "postgres://b"}},
+		{"none", DatabaseConfig{}, nil},
+		{"negative weight", DatabaseConfig{ShardFile: writeFile(t, `{"shards": [{"id": 0, "url": "postgres://a", "weight": -1}]}`)}, nil},
+		{"gap", DatabaseConfig{ShardList: "0=postgres://a,2=postgres://c"}, nil},
+		{"duplicate", DatabaseConfig{ShardList: "0=postgres://a,0=postgres://b"}, nil},
+		{"no url", DatabaseConfig{ShardList: "0="}, nil},
+		{"no id", DatabaseConfig{ShardList: "postgres://a"}, nil},
+		{"file and list", DatabaseConfig{ShardFile: file, ShardList: "0=postgres://a"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.Shards()
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("want an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var urls []string
+			for _, shard := range got {
+				urls = append(urls, shard.URL)
+			}
+			if !slices.Equal(urls, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShardWeights(t *testing.T) {
+	shards, err := DatabaseConfig{ShardFile: writeFile(t, `{"shards": [{"id": 1, "url": "postgres://b"}, {"id": 0, "url": "postgres://a", "weight": 2}]}`)}.Shards()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shards[0].Weight != 2 || shards[1].Weight != 1 {
+		t.Fatalf("weights %d and %d, want 2 and 1", shards[0].Weight, shards[1].Weight)
+	}
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "shards.json")
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
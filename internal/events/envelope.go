@@ -0,0 +1,140 @@
+// Package events defines the contracts of the events this service publishes
+// and consumes. Every event is a typed struct sent inside a CloudEvents-style
+// envelope; the envelope's type is the NATS subject and its dataschema
+// carries the payload version.
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SpecVersion = "1.0"
+	Source      = "file-service"
+	// schemaPrefix is followed by "<subject>:v<version>"
+	schemaPrefix = "urn:bondbridg:events:"
+)
+
+// Event is implemented by every event payload.
+type Event interface {
+	// Subject is the NATS subject and the envelope type, e.g. "files.uploaded"
+	Subject() string
+	// Version is the payload schema version; bump it on breaking changes
+	Version() int
+	Validate() error
+}
+
+// Envelope wraps an event payload with CloudEvents context attributes.
+type Envelope struct {
+	ID              string          `json:"id"`
+	Type            string          `json:"type"`
+	Source          string          `json:"source"`
+	SpecVersion     string          `json:"specversion"`
+	Time            time.Time       `json:"time"`
+	DataSchema      string          `json:"dataschema"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// ErrInvalidEvent wraps every decoding and validation failure. Redelivering
+// such a message cannot help.
+var ErrInvalidEvent = errors.New("invalid event")
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidEvent, fmt.Sprintf(format, args...))
+}
+
+// DataSchema returns the dataschema URN of e
+func DataSchema(e Event) string {
+	return fmt.Sprintf("%s%s:v%d", schemaPrefix, e.Subject(), e.Version())
+}
+
+// Wrap validates e and puts it in a new envelope
+func Wrap(e Event) (Envelope, error) {
+	return wrap(e, uuid.New().String(), time.Now().UTC())
+}
+
+func wrap(e Event, id string, at time.Time) (Envelope, error) {
+	if err := e.Validate(); err != nil {
+		return Envelope{}, fmt.Errorf("%s: %w", e.Subject(), err)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		ID:              id,
+		Type:            e.Subject(),
+		Source:          Source,
+		SpecVersion:     SpecVersion,
+		Time:            at,
+		DataSchema:      DataSchema(e),
+		DataContentType: "application/json",
+		Data:            data,
+	}, nil
+}
+
+// Unwrap splits a message into its envelope and payload. Messages published
+// before envelopes were introduced, or by services that do not use them, are
+// returned as the payload with ok set to false.
+func Unwrap(data []byte) (env Envelope, payload json.RawMessage, ok bool) {
+	var probe struct {
+		SpecVersion string `json:"specversion"`
+	}
+	if json.Unmarshal(data, &probe) != nil || probe.SpecVersion == "" {
+		return Envelope{}, data, false
+	}
+	if err := json.Unmarshal(data, &env); err != nil {
+		return Envelope{}, data, false
+	}
+	return env, env.Data, true
+}
+
+// Decode parses and validates an event of type T. Envelopes must carry T's
+// type and a schema version no newer than T's; bare legacy payloads are
+// accepted as is.
+func Decode[T Event](data []byte) (T, Envelope, error) {
+	var event T
+	env, payload, wrapped := Unwrap(data)
+	if wrapped {
+		if env.Type != event.Subject() {
+			return event, env, invalid("type %q, expected %q", env.Type, event.Subject())
+		}
+		version, err := schemaVersion(env.DataSchema)
+		if err != nil {
+			return event, env, err
+		}
+		if version > event.Version() {
+			return event, env, invalid("%s schema v%d is newer than supported v%d", env.Type, version, event.Version())
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	if err := dec.Decode(&event); err != nil {
+		return event, env, invalid("%s: %v", event.Subject(), err)
+	}
+	if err := event.Validate(); err != nil {
+		return event, env, invalid("%s: %v", event.Subject(), err)
+	}
+	return event, env, nil
+}
+
+func schemaVersion(dataSchema string) (int, error) {
+	i := strings.LastIndex(dataSchema, ":v")
+	if i < 0 {
+		return 0, invalid("dataschema %q has no version", dataSchema)
+	}
+	version, err := strconv.Atoi(dataSchema[i+2:])
+	if err != nil {
+		return 0, invalid("dataschema %q: %v", dataSchema, err)
+	}
+	return version, nil
+}
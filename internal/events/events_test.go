@@ -0,0 +1,199 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var (
+	sampleTime = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	sampleID   = "6f1c2b1e-8a4f-4c1e-9b0a-2d3e4f5a6b7c"
+	fileID     = "0d9f3c52-4a57-4f43-8d3c-1b2a3c4d5e6f"
+	userID     = "9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d"
+)
+
+// samples holds one fully populated event per subject. Adding a subject
+// without a sample fails TestEverySubjectHasAContract.
+var samples = []Event{
+	FileUploaded{FileID: fileID, UserID: userID, ObjectName: fileID + ".pdf", FileType: "document", Size: 52341, UploadedAt: sampleTime},
+	FileDeleted{FileID: fileID, UserID: userID, ObjectName: fileID + ".pdf", PreviewPath: fileID + "_preview.jpg", Reason: DeleteReasonUser, DeletedAt: sampleTime},
+	FilesDeleted{UserID: userID, Reason: DeleteReasonAccountDeletion, Files: []DeletedFile{
+		{FileID: fileID, ObjectName: fileID + ".pdf"},
+		{FileID: sampleID, ObjectName: sampleID + ".exe", Bucket: "files-quarantine"},
+	}, DeletedAt: sampleTime},
+	FileUpdated{FileID: fileID, UserID: userID, Changed: []string{FieldScanOverride}, ScanStatus: "infected", ScanOverride: true, Bucket: "files-quarantine", UpdatedAt: sampleTime},
+	FileQuarantined{FileID: fileID, UserID: userID, ObjectName: fileID + ".exe", Bucket: "files-quarantine", Signature: "Eicar-Test-Signature", ScannedAt: sampleTime},
+	ScanRequested{FileID: fileID, UserID: userID, ObjectName: fileID + ".pdf", RequestedAt: sampleTime},
+	ScanRequeued{FileID: fileID, UserID: userID, ObjectName: fileID + ".pdf", Size: 52341, Reason: "stuck_pending", RequeuedAt: sampleTime},
+	ScanCompleted{FileID: fileID, UserID: userID, Status: "clean", Engine: "ClamAV 1.0.1", SignatureVersion: "26789", ScannedAt: sampleTime},
+	ScanReclassified{FileID: fileID, UserID: userID, FileName: "invoice.pdf", PreviousStatus: "clean", PreviousSignatureVersion: "26788", Status: "infected", Signature: "Pdf.Exploit.Agent", SignatureVersion: "26789", ScannedAt: sampleTime},
+	ShareAccessed{ShareID: sampleID, FileID: fileID, UserID: userID, AccessedAt: sampleTime, IP: "203.0.113.7", UserAgent: "curl/8.4.0", BytesServed: 52341, Success: true},
+	UserDeleted{UserID: userID},
+	UserSynced{UserID: userID, EventType: UserSyncedType},
+	UserFilesPurged{UserID: userID, FilesDeleted: 1204, ObjectsDeleted: 2311, StartedAt: sampleTime, CompletedAt: sampleTime.Add(3 * time.Minute)},
+}
+
+func goldenPath(subject string) string {
+	return filepath.Join("testdata", subject+".json")
+}
+
+func TestContracts(t *testing.T) {
+	for _, sample := range samples {
+		t.Run(sample.Subject(), func(t *testing.T) {
+			env, err := wrap(sample, sampleID, sampleTime)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.MarshalIndent(env, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			path := goldenPath(sample.Subject())
+			if *update {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("missing contract, run go test ./internal/events -update: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("%s no longer matches its contract; bump Version() for breaking changes and run with -update.\ngot:\n%s\nwant:\n%s", path, got, want)
+			}
+		})
+	}
+}
+
+func TestGoldenFilesDecode(t *testing.T) {
+	for _, sample := range samples {
+		t.Run(sample.Subject(), func(t *testing.T) {
+			data, err := os.ReadFile(goldenPath(sample.Subject()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decoded, env := decodeAs(t, sample, data)
+			if env.ID != sampleID || env.Source != Source || env.SpecVersion != SpecVersion || env.DataSchema != DataSchema(sample) {
+				t.Fatalf("unexpected envelope %+v", env)
+			}
+			if !reflect.DeepEqual(decoded, sample) {
+				t.Fatalf("got %+v, want %+v", decoded, sample)
+			}
+		})
+	}
+}
+
+func TestEverySubjectHasAContract(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(samples) {
+		t.Fatalf("%d golden files for %d samples", len(files), len(samples))
+	}
+}
+
+// decodeAs decodes data with the Decode instantiation matching sample's type
+func decodeAs(t *testing.T, sample Event, data []byte) (Event, Envelope) {
+	t.Helper()
+	var (
+		event Event
+		env   Envelope
+		err   error
+	)
+	switch sample.(type) {
+	case FileUploaded:
+		event, env, err = Decode[FileUploaded](data)
+	case FileDeleted:
+		event, env, err = Decode[FileDeleted](data)
+	case FilesDeleted:
+		event, env, err = Decode[FilesDeleted](data)
+	case FileUpdated:
+		event, env, err = Decode[FileUpdated](data)
+	case FileQuarantined:
+		event, env, err = Decode[FileQuarantined](data)
+	case ScanRequested:
+		event, env, err = Decode[ScanRequested](data)
+	case ScanRequeued:
+		event, env, err = Decode[ScanRequeued](data)
+	case ScanCompleted:
+		event, env, err = Decode[ScanCompleted](data)
+	case ScanReclassified:
+		event, env, err = Decode[ScanReclassified](data)
+	case ShareAccessed:
+		event, env, err = Decode[ShareAccessed](data)
+	case UserDeleted:
+		event, env, err = Decode[UserDeleted](data)
+	case UserSynced:
+		event, env, err = Decode[UserSynced](data)
+	case UserFilesPurged:
+		event, env, err = Decode[UserFilesPurged](data)
+	default:
+		t.Fatalf("no decoder for %T", sample)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event, env
+}
+
+func TestLegacyPayloads(t *testing.T) {
+	// users.synced from the account service: bare and camelCase
+	synced, _, err := Decode[UserSynced]([]byte(`{"userId":"` + userID + `","eventType":"UserSynced"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if synced.UserID != userID || synced.EventType != UserSyncedType {
+		t.Fatalf("got %+v", synced)
+	}
+
+	// files.uploaded published before envelopes were introduced
+	uploaded, env, err := Decode[FileUploaded]([]byte(`{"action":"uploaded","file_id":"f","user_id":"u","object_name":"f.pdf","size":3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploaded.ObjectName != "f.pdf" || uploaded.Size != 3 || env.ID != "" {
+		t.Fatalf("got %+v %+v", uploaded, env)
+	}
+}
+
+func TestDecodeRejectsInvalidEvents(t *testing.T) {
+	newer, _ := wrap(FileDeleted{FileID: fileID, UserID: userID}, sampleID, sampleTime)
+	newer.DataSchema = schemaPrefix + SubjectFileDeleted + ":v2"
+	newerData, _ := json.Marshal(newer)
+
+	wrongType, _ := wrap(FileUploaded{FileID: fileID, UserID: userID, ObjectName: "x"}, sampleID, sampleTime)
+	wrongTypeData, _ := json.Marshal(wrongType)
+
+	for name, data := range map[string][]byte{
+		"not json":       []byte("{"),
+		"missing field":  []byte(`{"file_id":"f"}`),
+		"unknown reason": []byte(`{"file_id":"f","user_id":"u","reason":"bored"}`),
+		"newer schema":   newerData,
+		"different type": wrongTypeData,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := Decode[FileDeleted](data); !errors.Is(err, ErrInvalidEvent) {
+				t.Fatalf("got %v", err)
+			}
+		})
+	}
+}
+
+func TestWrapValidates(t *testing.T) {
+	if _, err := Wrap(FileUploaded{FileID: fileID}); err == nil {
+		t.Fatal("expected validation error")
+	}
+}
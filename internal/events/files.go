@@ -0,0 +1,289 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+)
+
+// Subjects of the events published by this service
+const (
+	SubjectFileUploaded     = "files.uploaded"
+	SubjectFileDeleted      = "files.deleted"
+	SubjectFilesDeleted     = "files.deleted.bulk"
+	SubjectFileUpdated      = "files.updated"
+	SubjectFileQuarantined  = "files.quarantined"
+	SubjectScanRequested    = "files.scan.requested"
+	SubjectScanRequeued     = "files.scan.requeued"
+	SubjectScanCompleted    = "files.scan.completed"
+	SubjectScanReclassified = "files.scan.reclassified"
+	SubjectShareAccessed    = "files.share.accessed"
+)
+
+// required returns an error naming the first empty field; pairs are name, value
+func required(pairs ...string) error {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] == "" {
+			return errors.New(pairs[i] + " is required")
+		}
+	}
+	return nil
+}
+
+// FileUploaded is published once the object and its metadata are stored.
+type FileUploaded struct {
+	FileID     string    `json:"file_id"`
+	UserID     string    `json:"user_id"`
+	ObjectName string    `json:"object_name"`
+	FileType   string    `json:"file_type"`
+	Size       int64     `json:"size"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+func (FileUploaded) Subject() string { return SubjectFileUploaded }
+func (FileUploaded) Version() int    { return 1 }
+func (e FileUploaded) Validate() error {
+	return required("file_id", e.FileID, "user_id", e.UserID, "object_name", e.ObjectName)
+}
+
+// Why a file was deleted, carried by files.deleted and files.deleted.bulk
+const (
+	DeleteReasonUser            = "user"
+	DeleteReasonTrashPurge      = "trash_purge"
+	DeleteReasonInfected        = "infected"
+	DeleteReasonAccountDeletion = "account_deletion"
+)
+
+func validReason(reason string) error {
+	switch reason {
+	case "", DeleteReasonUser, DeleteReasonTrashPurge, DeleteReasonInfected, DeleteReasonAccountDeletion:
+		return nil
+	}
+	return fmt.Errorf("unknown reason %q", reason)
+}
+
+// DeletedFile names the objects left behind by a deleted file row. Bucket is
+// empty for the files bucket.
+type DeletedFile struct {
+	FileID      string `json:"file_id"`
+	ObjectName  string `json:"object_name,omitempty"`
+	PreviewPath string `json:"preview_path,omitempty"`
+	Bucket      string `json:"bucket,omitempty"`
+}
+
+// DeletedFileOf lists the objects of a file row. bucket_name of files outside
+// quarantine is a label rather than the MinIO bucket, so Bucket is only set
+// for quarantined files.
+func DeletedFileOf(metadata models.FileMetadata) DeletedFile {
+	deleted := DeletedFile{FileID: metadata.ID, ObjectName: metadata.FilePath, PreviewPath: metadata.PreviewPath}
+	if metadata.QuarantinedAt != nil {
+		deleted.Bucket = metadata.BucketName
+	}
+	return deleted
+}
+
+// NewFileDeleted builds the files.deleted event of a file row
+func NewFileDeleted(metadata models.FileMetadata, reason string) FileDeleted {
+	deleted := DeletedFileOf(metadata)
+	return FileDeleted{
+		FileID:      metadata.ID,
+		UserID:      metadata.UserID,
+		ObjectName:  deleted.ObjectName,
+		PreviewPath: deleted.PreviewPath,
+		Bucket:      deleted.Bucket,
+		Reason:      reason,
+		DeletedAt:   time.Now().UTC(),
+	}
+}
+
+// FileDeleted is published after a file's metadata was deleted. Its objects
+// are removed afterwards by the storage cleanup consumer. Events published
+// before the reason was added carry no objects and an empty reason.
+type FileDeleted struct {
+	FileID      string    `json:"file_id"`
+	UserID      string    `json:"user_id"`
+	ObjectName  string    `json:"object_name,omitempty"`
+	PreviewPath string    `json:"preview_path,omitempty"`
+	Bucket      string    `json:"bucket,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	DeletedAt   time.Time `json:"deleted_at"`
+}
+
+func (FileDeleted) Subject() string { return SubjectFileDeleted }
+func (FileDeleted) Version() int    { return 1 }
+func (e FileDeleted) Validate() error {
+	if err := required("file_id", e.FileID, "user_id", e.UserID); err != nil {
+		return err
+	}
+	return validReason(e.Reason)
+}
+
+// Objects returns the file as a DeletedFile
+func (e FileDeleted) Objects() DeletedFile {
+	return DeletedFile{FileID: e.FileID, ObjectName: e.ObjectName, PreviewPath: e.PreviewPath, Bucket: e.Bucket}
+}
+
+// FilesDeleted is published once per batch when many files of a user are
+// deleted at once, e.g. when the account is deleted.
+type FilesDeleted struct {
+	UserID    string        `json:"user_id"`
+	Reason    string        `json:"reason"`
+	Files     []DeletedFile `json:"files"`
+	DeletedAt time.Time     `json:"deleted_at"`
+}
+
+func (FilesDeleted) Subject() string { return SubjectFilesDeleted }
+func (FilesDeleted) Version() int    { return 1 }
+func (e FilesDeleted) Validate() error {
+	if err := required("user_id", e.UserID, "reason", e.Reason); err != nil {
+		return err
+	}
+	if len(e.Files) == 0 {
+		return errors.New("files is required")
+	}
+	for _, f := range e.Files {
+		if f.FileID == "" {
+			return errors.New("files[].file_id is required")
+		}
+	}
+	return validReason(e.Reason)
+}
+
+// Fields named in FileUpdated.Changed
+const (
+	FieldScanStatus   = "scan_status"
+	FieldScanOverride = "scan_override"
+	FieldBucket       = "bucket"
+)
+
+// FileUpdated is published when stored file information other than the scan
+// verdict changes. Changed names the fields that differ; the other fields
+// hold their current values.
+type FileUpdated struct {
+	FileID       string    `json:"file_id"`
+	UserID       string    `json:"user_id"`
+	Changed      []string  `json:"changed"`
+	ScanStatus   string    `json:"scan_status,omitempty"`
+	ScanOverride bool      `json:"scan_override"`
+	Bucket       string    `json:"bucket,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func (FileUpdated) Subject() string { return SubjectFileUpdated }
+func (FileUpdated) Version() int    { return 1 }
+func (e FileUpdated) Validate() error {
+	if err := required("file_id", e.FileID, "user_id", e.UserID); err != nil {
+		return err
+	}
+	if len(e.Changed) == 0 {
+		return errors.New("changed is required")
+	}
+	return nil
+}
+
+// FileQuarantined is published when an infected object was moved to the
+// quarantine bucket.
+type FileQuarantined struct {
+	FileID     string    `json:"file_id"`
+	UserID     string    `json:"user_id"`
+	ObjectName string    `json:"object_name"`
+	Bucket     string    `json:"bucket"`
+	Signature  string    `json:"signature"`
+	ScannedAt  time.Time `json:"scanned_at"`
+}
+
+func (FileQuarantined) Subject() string { return SubjectFileQuarantined }
+func (FileQuarantined) Version() int    { return 1 }
+func (e FileQuarantined) Validate() error {
+	return required("file_id", e.FileID, "user_id", e.UserID, "bucket", e.Bucket)
+}
+
+// ScanRequested asks an external scanner to scan a new upload.
+type ScanRequested struct {
+	FileID      string    `json:"file_id"`
+	UserID      string    `json:"user_id"`
+	ObjectName  string    `json:"object_name"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+func (ScanRequested) Subject() string { return SubjectScanRequested }
+func (ScanRequested) Version() int    { return 1 }
+func (e ScanRequested) Validate() error {
+	return required("file_id", e.FileID, "user_id", e.UserID, "object_name", e.ObjectName)
+}
+
+// ScanRequeued asks the scan workers to scan an already stored file again.
+type ScanRequeued struct {
+	FileID     string    `json:"file_id"`
+	UserID     string    `json:"user_id"`
+	ObjectName string    `json:"object_name"`
+	Size       int64     `json:"size"`
+	Reason     string    `json:"reason"`
+	RequeuedAt time.Time `json:"requeued_at"`
+}
+
+func (ScanRequeued) Subject() string { return SubjectScanRequeued }
+func (ScanRequeued) Version() int    { return 1 }
+func (e ScanRequeued) Validate() error {
+	return required("file_id", e.FileID, "user_id", e.UserID, "object_name", e.ObjectName, "reason", e.Reason)
+}
+
+// ScanCompleted carries the final verdict of a scan. Error is set when the
+// scan gave up with status scan_error.
+type ScanCompleted struct {
+	FileID           string    `json:"file_id"`
+	UserID           string    `json:"user_id"`
+	Status           string    `json:"status"`
+	Signature        string    `json:"signature,omitempty"`
+	Engine           string    `json:"engine,omitempty"`
+	SignatureVersion string    `json:"signature_version,omitempty"`
+	Error            string    `json:"error,omitempty"`
+	ScannedAt        time.Time `json:"scanned_at"`
+}
+
+func (ScanCompleted) Subject() string { return SubjectScanCompleted }
+func (ScanCompleted) Version() int    { return 1 }
+func (e ScanCompleted) Validate() error {
+	return required("file_id", e.FileID, "user_id", e.UserID, "status", e.Status)
+}
+
+// ScanReclassified is published when a file that was clean matches a newer
+// signature.
+type ScanReclassified struct {
+	FileID                   string    `json:"file_id"`
+	UserID                   string    `json:"user_id"`
+	FileName                 string    `json:"file_name"`
+	PreviousStatus           string    `json:"previous_status"`
+	PreviousSignatureVersion string    `json:"previous_signature_version,omitempty"`
+	Status                   string    `json:"status"`
+	Signature                string    `json:"signature"`
+	SignatureVersion         string    `json:"signature_version,omitempty"`
+	ScannedAt                time.Time `json:"scanned_at"`
+}
+
+func (ScanReclassified) Subject() string { return SubjectScanReclassified }
+func (ScanReclassified) Version() int    { return 1 }
+func (e ScanReclassified) Validate() error {
+	return required("file_id", e.FileID, "user_id", e.UserID, "status", e.Status)
+}
+
+// ShareAccessed records every download attempt through a share link.
+type ShareAccessed struct {
+	ShareID      string    `json:"share_id"`
+	FileID       string    `json:"file_id"`
+	UserID       string    `json:"user_id"`
+	AccessedAt   time.Time `json:"accessed_at"`
+	IP           string    `json:"ip"`
+	UserAgent    string    `json:"user_agent"`
+	BytesServed  int64     `json:"bytes_served"`
+	Success      bool      `json:"success"`
+	DenialReason string    `json:"denial_reason,omitempty"`
+}
+
+func (ShareAccessed) Subject() string { return SubjectShareAccessed }
+func (ShareAccessed) Version() int    { return 1 }
+func (e ShareAccessed) Validate() error {
+	return required("share_id", e.ShareID, "file_id", e.FileID, "user_id", e.UserID)
+}
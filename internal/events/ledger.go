@@ -0,0 +1,84 @@
+package events
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+)
+
+// Ledger records which messages a consumer has processed, so a redelivered
+// message is not handled twice. Keys are namespaced by consumer.
+type Ledger interface {
+	Processed(consumer, key string) (bool, error)
+	Record(consumer, key string) error
+}
+
+// ledger is nil until UseLedger is called; then nothing is deduplicated
+var ledger Ledger
+
+// UseLedger sets the ledger consulted by Once and AlreadyProcessed
+func UseLedger(l Ledger) {
+	ledger = l
+}
+
+// KeyFunc derives the idempotency key of an event. Two messages with the
+// same key are treated as the same piece of work.
+type KeyFunc[T Event] func(event T, env Envelope) string
+
+// ByEnvelopeID keys an event by its envelope ID, i.e. it only deduplicates
+// redeliveries of the same message. Bare legacy payloads have no ID and are
+// never deduplicated.
+func ByEnvelopeID[T Event](_ T, env Envelope) string {
+	return env.ID
+}
+
+// Once wraps fn so that an event whose key consumer already processed is
+// skipped. The key is recorded only after fn succeeded, so a crash in
+// between leads to one more run rather than a lost event.
+func Once[T Event](consumer string, key KeyFunc[T], fn func(ctx context.Context, event T, env Envelope) error) func(ctx context.Context, event T, env Envelope) error {
+	return func(ctx context.Context, event T, env Envelope) error {
+		k := key(event, env)
+		if AlreadyProcessed(consumer, k) {
+			log.Printf("[Ledger] %s skipped duplicate %s %s", consumer, event.Subject(), k)
+			return nil
+		}
+		if err := fn(ctx, event, env); err != nil {
+			return err
+		}
+		MarkProcessed(consumer, k)
+		return nil
+	}
+}
+
+// AlreadyProcessed reports whether consumer recorded key. Ledger failures are
+// logged and reported as not processed, as handlers must tolerate an extra
+// run anyway.
+func AlreadyProcessed(consumer, key string) bool {
+	if ledger == nil || key == "" {
+		return false
+	}
+	processed, err := ledger.Processed(consumer, LedgerKey(key))
+	if err != nil {
+		log.Printf("[Ledger] lookup for %s failed: %v", consumer, err)
+		return false
+	}
+	return processed
+}
+
+// MarkProcessed records that consumer finished the work identified by key
+func MarkProcessed(consumer, key string) {
+	if ledger == nil || key == "" {
+		return
+	}
+	if err := ledger.Record(consumer, LedgerKey(key)); err != nil {
+		log.Printf("[Ledger] record for %s failed: %v", consumer, err)
+	}
+}
+
+// LedgerKey hashes an idempotency key, so keys built from arbitrary payload
+// fields are safe to use as NATS KV keys and table keys alike
+func LedgerKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
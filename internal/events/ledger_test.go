@@ -0,0 +1,61 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type memoryLedger map[string]bool
+
+func (l memoryLedger) Processed(consumer, key string) (bool, error) {
+	return l[consumer+"."+key], nil
+}
+
+func (l memoryLedger) Record(consumer, key string) error {
+	l[consumer+"."+key] = true
+	return nil
+}
+
+func TestOnceSkipsProcessedKeys(t *testing.T) {
+	UseLedger(memoryLedger{})
+	defer UseLedger(nil)
+
+	ctx := context.Background()
+	calls := 0
+	fail := true
+	handler := Once("cleanup", func(e UserDeleted, _ Envelope) string { return e.UserID }, func(context.Context, UserDeleted, Envelope) error {
+		calls++
+		if fail {
+			return errors.New("storage down")
+		}
+		return nil
+	})
+
+	event := UserDeleted{UserID: userID}
+	if err := handler(ctx, event, Envelope{ID: "a"}); err == nil {
+		t.Fatal("expected the handler error")
+	}
+	// A failed run is not recorded, so the redelivery runs again
+	fail = false
+	if err := handler(ctx, event, Envelope{ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	// A second event with the same payload key is a duplicate
+	if err := handler(ctx, event, Envelope{ID: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("handler ran %d times, want 2", calls)
+	}
+
+	// Other consumers keep their own records
+	other := Once("audit", ByEnvelopeID[UserDeleted], func(context.Context, UserDeleted, Envelope) error { calls++; return nil })
+	_ = other(ctx, event, Envelope{ID: "a"})
+	_ = other(ctx, event, Envelope{ID: "a"})
+	_ = other(ctx, event, Envelope{})
+	_ = other(ctx, event, Envelope{})
+	if calls != 5 {
+		t.Fatalf("handler ran %d times, want 5 (events without an ID are never deduplicated)", calls)
+	}
+}
@@ -0,0 +1,50 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/tracing"
+)
+
+// Marshal wraps e in an envelope and encodes it
+func Marshal(e Event) (Envelope, []byte, error) {
+	env, err := Wrap(e)
+	if err != nil {
+		return Envelope{}, nil, err
+	}
+	data, err := json.Marshal(env)
+	return env, data, err
+}
+
+// Publish validates e and publishes it to JetStream. The envelope ID is used
+// as Nats-Msg-Id; the trace of ctx travels in the headers.
+func Publish(ctx context.Context, e Event) error {
+	env, data, err := Marshal(e)
+	if err != nil {
+		return err
+	}
+	return services.PublishRaw(ctx, env.Type, data, env.ID)
+}
+
+// PublishPlain validates e and publishes it without waiting for JetStream
+func PublishPlain(ctx context.Context, e Event) error {
+	env, data, err := Marshal(e)
+	if err != nil {
+		return err
+	}
+	return services.PublishPlain(ctx, env.Type, data)
+}
+
+// NewOutboxMessage wraps e for the transactional outbox; the outbox row, the
+// envelope and the Nats-Msg-Id share one ID. The trace of ctx is stored with
+// the message, so the relay publishes it within the same trace.
+func NewOutboxMessage(ctx context.Context, e Event) (models.OutboxMessage, error) {
+	env, data, err := Marshal(e)
+	if err != nil {
+		return models.OutboxMessage{}, err
+	}
+	return models.OutboxMessage{ID: env.ID, Subject: env.Type, Payload: data, TraceContext: tracing.Carrier(ctx)}, nil
+}
@@ -0,0 +1,81 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Subjects of the events consumed from the account service
+const (
+	SubjectUserDeleted = "users.deleted"
+	SubjectUserSynced  = "users.synced"
+)
+
+// SubjectUserFilesPurged is published once everything of a deleted user is gone
+const SubjectUserFilesPurged = "users.files.purged"
+
+// UserDeleted asks this service to remove everything stored for a user.
+type UserDeleted struct {
+	UserID string `json:"user_id"`
+}
+
+func (UserDeleted) Subject() string { return SubjectUserDeleted }
+func (UserDeleted) Version() int    { return 1 }
+func (e UserDeleted) Validate() error {
+	return required("user_id", e.UserID)
+}
+
+// UserSyncedType is the only event type of users.synced acted upon
+const UserSyncedType = "UserSynced"
+
+// UserSynced is published by the account service when a user was created or
+// updated from Keycloak.
+type UserSynced struct {
+	UserID    string `json:"user_id"`
+	EventType string `json:"event_type"`
+}
+
+func (UserSynced) Subject() string { return SubjectUserSynced }
+func (UserSynced) Version() int    { return 1 }
+func (e UserSynced) Validate() error {
+	return required("user_id", e.UserID)
+}
+
+// UnmarshalJSON also accepts the legacy camelCase payload
+// {"userId": ..., "eventType": ...} still sent by the account service.
+func (e *UserSynced) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		UserID          string `json:"user_id"`
+		EventType       string `json:"event_type"`
+		LegacyUserID    string `json:"userId"`
+		LegacyEventType string `json:"eventType"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	e.UserID, e.EventType = raw.UserID, raw.EventType
+	if e.UserID == "" {
+		e.UserID = raw.LegacyUserID
+	}
+	if e.EventType == "" {
+		e.EventType = raw.LegacyEventType
+	}
+	return nil
+}
+
+// UserFilesPurged confirms that the files, objects, shares, statistics and
+// webhooks of a deleted user were removed.
+type UserFilesPurged struct {
+	UserID         string    `json:"user_id"`
+	FilesDeleted   int       `json:"files_deleted"`
+	ObjectsDeleted int       `json:"objects_deleted"`
+	StartedAt      time.Time `json:"started_at"`
+	CompletedAt    time.Time `json:"completed_at"`
+}
+
+func (UserFilesPurged) Subject() string { return SubjectUserFilesPurged }
+func (UserFilesPurged) Version() int    { return 1 }
+func (e UserFilesPurged) Validate() error {
+	return required("user_id", e.UserID)
+}
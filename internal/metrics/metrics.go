@@ -0,0 +1,43 @@
+// Package metrics sends service metrics to the Datadog agent over DogStatsD.
+// Until Init is called every metric is dropped.
+package metrics
+
+import (
+	"log"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+)
+
+// Prefix is prepended to every metric name
+const Prefix = "file_service."
+
+var client statsd.ClientInterface = &statsd.NoOpClient{}
+
+// Init connects to the agent at addr, e.g. "localhost:8125" or
+// "unix:///var/run/datadog/dsd.socket".
+func Init(addr string) error {
+	c, err := statsd.New(addr, statsd.WithNamespace(Prefix))
+	if err != nil {
+		return err
+	}
+	client = c
+	return nil
+}
+
+func Gauge(name string, value float64, tags ...string) {
+	if err := client.Gauge(name, value, tags, 1); err != nil {
+		log.Printf("[Metrics] gauge %s: %v", name, err)
+	}
+}
+
+func Count(name string, value int64, tags ...string) {
+	if err := client.Count(name, value, tags, 1); err != nil {
+		log.Printf("[Metrics] count %s: %v", name, err)
+	}
+}
+
+func Distribution(name string, value float64, tags ...string) {
+	if err := client.Distribution(name, value, tags, 1); err != nil {
+		log.Printf("[Metrics] distribution %s: %v", name, err)
+	}
+}
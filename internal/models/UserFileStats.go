@@ -3,3 +3,11 @@ package models
 type UserFileStats struct {
 	FileCount int `json:"file_count"`
 }
+
+// FileStatsDrift is a user whose stored file count differs from the count
+// of their files
+type FileStatsDrift struct {
+	UserID string `json:"user_id"`
+	Stored int    `json:"stored"`
+	Actual int    `json:"actual"`
+}
@@ -19,4 +19,16 @@ type FileMetadata struct {
 	UserID       string    `json:"user_id,omitempty"`
 	ScanStatus   string    `json:"scan_status"`
 	ScannedAt    time.Time `json:"scanned_at"`
+	// ScanSignature is the name of the signature that matched an infected file,
+	// or the limit a rejected archive broke
+	ScanSignature string     `json:"scan_signature,omitempty"`
+	QuarantinedAt *time.Time `json:"quarantined_at,omitempty"`
+	// ScanOverride is set by an admin to serve the file whatever its scan status
+	ScanOverride bool `json:"scan_override"`
+	// ScanError holds the reason of the last failed scan attempt
+	ScanError    string `json:"scan_error,omitempty"`
+	ScanAttempts int    `json:"scan_attempts"`
+	// ScanEngine and SignatureVersion identify what the last verdict was based on
+	ScanEngine       string `json:"scan_engine,omitempty"`
+	SignatureVersion string `json:"signature_version,omitempty"`
 }
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// OutboxMessage is an event stored in the same transaction as the change it
+// describes and published to JetStream afterwards. ID doubles as Nats-Msg-Id,
+// so a message relayed twice is deduplicated by the stream.
+type OutboxMessage struct {
+	ID        string    `json:"id"`
+	Subject   string    `json:"subject"`
+	Payload   []byte    `json:"payload"`
+	CreatedAt time.Time `json:"created_at"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	// TraceContext continues the trace of the change that stored the message
+	TraceContext map[string]string `json:"-"`
+}
+
+// OutboxLag describes the unpublished backlog of one shard's outbox.
+type OutboxLag struct {
+	Pending int64 `json:"pending"`
+	// OldestAge is how long the oldest unpublished message has waited
+	OldestAge time.Duration `json:"oldest_age"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+// Values stored in files.scan_status
+const (
+	ScanStatusPending  = "pending"
+	ScanStatusClean    = "clean"
+	ScanStatusInfected = "infected"
+	// ScanStatusTooLarge marks files bigger than clamd's StreamMaxLength.
+	// They were never scanned and must not be treated as clean.
+	ScanStatusTooLarge = "too_large"
+	// ScanStatusSkipped marks files an engine declined to scan for another reason
+	ScanStatusSkipped = "skipped"
+	// ScanStatusError marks files whose scan failed permanently or ran out of retries
+	ScanStatusError = "scan_error"
+	// ScanStatusReleased marks an infected file that an admin released from quarantine
+	ScanStatusReleased = "released"
+
+	// Archives that broke one of the inspector's limits. They are not
+	// infected, but are never served unless an admin overrides the scan.
+	ScanStatusArchiveTooLarge  = "archive_too_large"
+	ScanStatusArchiveRatio     = "archive_ratio_exceeded"
+	ScanStatusArchiveEntries   = "archive_too_many_entries"
+	ScanStatusArchiveDepth     = "archive_too_deep"
+	ScanStatusArchiveEncrypted = "archive_encrypted"
+)
+
+// IsArchiveRejection reports whether status records an archive limit violation
+func IsArchiveRejection(status string) bool {
+	switch status {
+	case ScanStatusArchiveTooLarge, ScanStatusArchiveRatio, ScanStatusArchiveEntries,
+		ScanStatusArchiveDepth, ScanStatusArchiveEncrypted:
+		return true
+	}
+	return false
+}
+
+// ScanResult is what a finished scan records on the file row.
+type ScanResult struct {
+	Status    string
+	Signature string
+	ScannedAt time.Time
+	// Engine and SignatureVersion come from the scanner, e.g. clamd's VERSION reply
+	Engine           string
+	SignatureVersion string
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+type Share struct {
+	ID        string     `json:"id"`
+	FileID    string     `json:"file_id"`
+	UserID    string     `json:"user_id"`
+	Token     string     `json:"token"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type ShareAccess struct {
+	ID           string    `json:"id"`
+	ShareID      string    `json:"share_id"`
+	AccessedAt   time.Time `json:"accessed_at"`
+	IP           string    `json:"ip"`
+	UserAgent    string    `json:"user_agent"`
+	BytesServed  int64     `json:"bytes_served"`
+	Success      bool      `json:"success"`
+	DenialReason string    `json:"denial_reason,omitempty"`
+}
+
+type ShareAccessStats struct {
+	TotalAccesses   int            `json:"total_accesses"`
+	Successful      int            `json:"successful"`
+	Denied          int            `json:"denied"`
+	BytesServed     int64          `json:"bytes_served"`
+	UniqueIPs       int            `json:"unique_ips"`
+	LastAccessedAt  *time.Time     `json:"last_accessed_at,omitempty"`
+	DenialsByReason map[string]int `json:"denials_by_reason"`
+}
+
+// DenialReason reports why the share can no longer be used, or "" if it is active.
+func (s Share) DenialReason(now time.Time) string {
+	if s.RevokedAt != nil {
+		return "revoked"
+	}
+	if s.ExpiresAt != nil && now.After(*s.ExpiresAt) {
+		return "expired"
+	}
+	return ""
+}
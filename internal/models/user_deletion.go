@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Phases of a user deletion, in the order they run. A job records the phase
+// it reached and a cursor within it, so a retry resumes there.
+const (
+	DeletionBlockAccess   = "block_access"
+	DeletionDeleteObjects = "delete_objects"
+	DeletionDeleteRows    = "delete_rows"
+	DeletionDeleteRelated = "delete_related"
+	DeletionEmitPurged    = "emit_purged"
+	DeletionDone          = "done"
+)
+
+// Deletion job states
+const (
+	DeletionRunning   = "running"
+	DeletionCompleted = "completed"
+)
+
+// UserDeletion is the persisted state of removing everything stored for a
+// user. Its existence blocks the user's access.
+type UserDeletion struct {
+	UserID string `json:"user_id"`
+	Status string `json:"status"`
+	Phase  string `json:"phase"`
+	// Cursor is the last file ID whose objects were removed
+	Cursor         string     `json:"-"`
+	FilesDeleted   int        `json:"files_deleted"`
+	ObjectsDeleted int        `json:"objects_deleted"`
+	Attempts       int        `json:"attempts"`
+	LastError      string     `json:"last_error,omitempty"`
+	StartedAt      time.Time  `json:"started_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebhookSubscription asks for file events of a user, or of every member of
+// an organization, to be POSTed to URL. Secret signs the requests and is
+// only shown when the subscription is created.
+type WebhookSubscription struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	// Organization is empty for subscriptions of a single user
+	Organization        string     `json:"organization,omitempty"`
+	URL                 string     `json:"url"`
+	EventTypes          []string   `json:"event_types"`
+	Secret              string     `json:"secret,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason      string     `json:"disabled_reason,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+// ShardKey selects the shard storing the subscription and its deliveries
+func (s WebhookSubscription) ShardKey() string {
+	return WebhookShardKey(s.UserID, s.Organization)
+}
+
+// WebhookShardKey is the owning user, or the organization for subscriptions
+// shared by its members
+func WebhookShardKey(userID, organization string) string {
+	if organization != "" {
+		return "org:" + organization
+	}
+	return userID
+}
+
+// Delivery states
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+// WebhookDelivery is one event to be sent to one subscription, with the
+// result of its latest attempt.
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"-"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+
+	// URL and Secret of the subscription, set for deliveries being sent
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+// WebhookAttempt is the outcome of sending a delivery. A failed attempt
+// without RetryAt is final.
+type WebhookAttempt struct {
+	Delivered  bool
+	StatusCode int
+	Error      string
+	RetryAt    *time.Time
+}
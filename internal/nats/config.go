@@ -8,6 +8,8 @@ import (
 
 type Client struct {
 	Conn *nats.Conn
+	// JS is used by the Router for durable consumers
+	JS nats.JetStreamContext
 }
 
 // SubscribeAll loads all routes once during startup
@@ -0,0 +1,98 @@
+package nats
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/metrics"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/tracing"
+	"github.com/nats-io/nats.go"
+)
+
+// Recover turns a panicking handler into an error, so the message is
+// redelivered instead of the subscription dying with the process.
+func Recover() Middleware {
+	return func(route Route, next Handler) Handler {
+		return func(ctx context.Context, msg *nats.Msg) (err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					slog.Error("nats handler panicked", "durable", route.Durable, "subject", msg.Subject, "panic", p, "stack", string(debug.Stack()))
+					err = fmt.Errorf("handler panicked: %v", p)
+				}
+			}()
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Logging logs every handled message with its outcome and duration.
+func Logging(logger *slog.Logger) Middleware {
+	return func(route Route, next Handler) Handler {
+		return func(ctx context.Context, msg *nats.Msg) error {
+			start := time.Now()
+			err := next(ctx, msg)
+
+			attrs := []any{
+				"subject", msg.Subject,
+				"durable", route.Durable,
+				"duration", time.Since(start),
+			}
+			if meta, merr := msg.Metadata(); merr == nil {
+				attrs = append(attrs, "stream_seq", meta.Sequence.Stream, "delivered", meta.NumDelivered)
+			}
+			result, _ := classify(err)
+			attrs = append(attrs, "outcome", result.String())
+			if err != nil {
+				logger.Warn("nats message failed", append(attrs, "error", err)...)
+				return err
+			}
+			logger.Info("nats message handled", attrs...)
+			return nil
+		}
+	}
+}
+
+// Tracing runs the handler in a span that continues the trace found in the
+// message headers, if any.
+func Tracing() Middleware {
+	return func(route Route, next Handler) Handler {
+		return func(ctx context.Context, msg *nats.Msg) (err error) {
+			span, ctx := tracing.StartConsumerSpan(ctx, msg, route.Durable)
+			defer tracing.Finish(span, &err)
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Timeout cancels the handler's context after the route's timeout.
+func Timeout() Middleware {
+	return func(route Route, next Handler) Handler {
+		if route.Timeout <= 0 {
+			return next
+		}
+		return func(ctx context.Context, msg *nats.Msg) error {
+			ctx, cancel := context.WithTimeout(ctx, route.Timeout)
+			defer cancel()
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Metrics reports handler durations and outcomes per consumer.
+func Metrics() Middleware {
+	return func(route Route, next Handler) Handler {
+		return func(ctx context.Context, msg *nats.Msg) error {
+			start := time.Now()
+			err := next(ctx, msg)
+
+			result, _ := classify(err)
+			tags := []string{"durable:" + route.Durable, "subject:" + route.Subject, "outcome:" + result.String()}
+			metrics.Distribution("nats.handler.duration", float64(time.Since(start).Milliseconds()), tags...)
+			metrics.Count("nats.handler.messages", 1, tags...)
+			return err
+		}
+	}
+}
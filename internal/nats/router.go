@@ -0,0 +1,202 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	"github.com/nats-io/nats.go"
+)
+
+// Handler processes one message. The router acks, naks or dead-letters the
+// message depending on the returned error; handlers never settle it
+// themselves.
+type Handler func(ctx context.Context, msg *nats.Msg) error
+
+// Middleware wraps the handler of a route.
+type Middleware func(route Route, next Handler) Handler
+
+// Route binds a handler to a durable JetStream consumer of one subject.
+type Route struct {
+	Subject string
+	Durable string
+	Handler Handler
+	// MaxDeliver and AckWait are applied to the consumer; exhausted
+	// messages are dead-lettered
+	MaxDeliver int
+	AckWait    time.Duration
+	// Timeout bounds one run of the handler; defaults to AckWait
+	Timeout time.Duration
+	// Options are added to the subscription, e.g. nats.DeliverNew()
+	Options []nats.SubOpt
+}
+
+// Router subscribes routes through a Client and runs their handlers behind
+// a shared middleware chain.
+type Router struct {
+	client     *Client
+	routes     []Route
+	middleware []Middleware
+}
+
+func NewRouter(client *Client) *Router {
+	return &Router{client: client}
+}
+
+// Use appends middleware; the first one added is the outermost.
+func (r *Router) Use(mw ...Middleware) {
+	r.middleware = append(r.middleware, mw...)
+}
+
+// Handle registers a route; it is subscribed by Start.
+func (r *Router) Handle(route Route) {
+	if route.Timeout <= 0 {
+		route.Timeout = route.AckWait
+	}
+	r.routes = append(r.routes, route)
+}
+
+// Start subscribes every route. A route that fails to subscribe is logged
+// and skipped so the others still run; the joined errors are returned.
+func (r *Router) Start() error {
+	var errs []error
+	for _, route := range r.routes {
+		if err := r.subscribe(route); err != nil {
+			log.Printf("[Router] failed to subscribe %s (%s): %v", route.Subject, route.Durable, err)
+			errs = append(errs, fmt.Errorf("%s: %w", route.Durable, err))
+			continue
+		}
+		log.Printf("[Router] %s -> %s (max %d deliveries)", route.Subject, route.Durable, route.MaxDeliver)
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Router) subscribe(route Route) error {
+	if r.client == nil || r.client.JS == nil {
+		return errors.New("jetstream not initialized")
+	}
+	// Subscribing with limits that differ from the stored consumer fails
+	if err := services.UpdateConsumerLimits(route.Durable, route.MaxDeliver, route.AckWait); err != nil {
+		log.Printf("[Router] failed to update limits of %s: %v", route.Durable, err)
+	}
+
+	handler := r.chain(route)
+	opts := append([]nats.SubOpt{
+		nats.Durable(route.Durable),
+		nats.ManualAck(),
+		nats.MaxDeliver(route.MaxDeliver),
+		nats.AckWait(route.AckWait),
+	}, route.Options...)
+
+	callback := func(msg *nats.Msg) {
+		settle(msg, handler(context.Background(), msg))
+	}
+	if _, err := r.client.JS.Subscribe(route.Subject, callback, opts...); err != nil {
+		return err
+	}
+
+	// Dead letters replayed to this route, under the same durable name
+	_, err := r.client.JS.Subscribe(services.ReplayFilter(route.Durable), callback,
+		nats.BindStream(services.DeadLetterReplayStream),
+		nats.Durable(route.Durable),
+		nats.ManualAck(),
+		nats.MaxDeliver(route.MaxDeliver),
+		nats.AckWait(route.AckWait),
+	)
+	if err != nil {
+		return fmt.Errorf("replays: %w", err)
+	}
+	return nil
+}
+
+func (r *Router) chain(route Route) Handler {
+	h := route.Handler
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		h = r.middleware[i](route, h)
+	}
+	return h
+}
+
+// Typed adapts a handler of event T. Messages that do not decode or
+// validate fail with events.ErrInvalidEvent and are dead-lettered at once.
+func Typed[T events.Event](fn func(ctx context.Context, event T, env events.Envelope) error) Handler {
+	return func(ctx context.Context, msg *nats.Msg) error {
+		event, env, err := events.Decode[T](msg.Data)
+		if err != nil {
+			return err
+		}
+		return fn(ctx, event, env)
+	}
+}
+
+// permanentError marks a failure redelivery cannot fix.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not retryable; the message is dead-lettered
+// without further deliveries.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// retryError asks for redelivery after a delay.
+type retryError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryError) Error() string { return e.err.Error() }
+func (e *retryError) Unwrap() error { return e.err }
+
+// RetryAfter asks for redelivery after delay instead of immediately. The
+// consumer's MaxDeliver still applies.
+func RetryAfter(err error, delay time.Duration) error {
+	return &retryError{err: err, delay: delay}
+}
+
+type outcome int
+
+const (
+	outcomeAck outcome = iota
+	outcomeRetry
+	outcomeDeadLetter
+)
+
+func (o outcome) String() string {
+	return [...]string{"ack", "retry", "dead_letter"}[o]
+}
+
+// classify maps a handler result to what happens to the message
+func classify(err error) (outcome, time.Duration) {
+	var permanent *permanentError
+	var retry *retryError
+	switch {
+	case err == nil:
+		return outcomeAck, 0
+	case errors.As(err, &permanent), errors.Is(err, events.ErrInvalidEvent):
+		return outcomeDeadLetter, 0
+	case errors.As(err, &retry):
+		return outcomeRetry, retry.delay
+	default:
+		return outcomeRetry, 0
+	}
+}
+
+func settle(msg *nats.Msg, err error) {
+	switch result, delay := classify(err); result {
+	case outcomeAck:
+		if aerr := msg.Ack(); aerr != nil && !errors.Is(aerr, nats.ErrMsgAlreadyAckd) {
+			log.Printf("[Router] ack failed: %v", aerr)
+		}
+	case outcomeDeadLetter:
+		_ = services.DeadLetter(msg, err.Error())
+	default:
+		services.RetryOrDeadLetter(msg, err.Error(), delay)
+	}
+}
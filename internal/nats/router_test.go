@@ -0,0 +1,205 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		err   error
+		want  outcome
+		delay time.Duration
+	}{
+		{"success", nil, outcomeAck, 0},
+		{"plain error", errors.New("minio down"), outcomeRetry, 0},
+		{"retry after", RetryAfter(errors.New("rate limited"), time.Minute), outcomeRetry, time.Minute},
+		{"permanent", Permanent(errors.New("bucket gone")), outcomeDeadLetter, 0},
+		{"wrapped permanent", fmt.Errorf("cleanup: %w", Permanent(errors.New("bucket gone"))), outcomeDeadLetter, 0},
+		{"invalid event", fmt.Errorf("%w: missing file_id", events.ErrInvalidEvent), outcomeDeadLetter, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, delay := classify(tc.err)
+			if got != tc.want || delay != tc.delay {
+				t.Fatalf("classify = %s after %v, want %s after %v", got, delay, tc.want, tc.delay)
+			}
+		})
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(_ Route, next Handler) Handler {
+			return func(ctx context.Context, msg *nats.Msg) error {
+				calls = append(calls, name+">")
+				err := next(ctx, msg)
+				calls = append(calls, "<"+name)
+				return err
+			}
+		}
+	}
+
+	r := NewRouter(nil)
+	r.Use(trace("a"), trace("b"))
+	h := r.chain(Route{Handler: func(context.Context, *nats.Msg) error {
+		calls = append(calls, "handler")
+		return nil
+	}})
+	if err := h(context.Background(), &nats.Msg{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(calls, " "); got != "a> b> handler <b <a" {
+		t.Fatalf("calls %q", got)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	h := Recover()(Route{Durable: "test"}, func(context.Context, *nats.Msg) error {
+		panic("boom")
+	})
+
+	err := h(context.Background(), &nats.Msg{Subject: "files.deleted"})
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("error %v", err)
+	}
+	if got, _ := classify(err); got != outcomeRetry {
+		t.Fatalf("panic classified as %s", got)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	h := Timeout()(Route{Timeout: 10 * time.Millisecond}, func(ctx context.Context, _ *nats.Msg) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	if err := h(context.Background(), &nats.Msg{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error %v", err)
+	}
+}
+
+func TestTypedRejectsInvalidEvents(t *testing.T) {
+	called := false
+	h := Typed(func(context.Context, events.FileDeleted, events.Envelope) error {
+		called = true
+		return nil
+	})
+
+	err := h(context.Background(), &nats.Msg{Data: []byte(`{"user_id":"u"}`)})
+	if called {
+		t.Fatal("handler ran for an invalid event")
+	}
+	if got, _ := classify(err); got != outcomeDeadLetter {
+		t.Fatalf("invalid event classified as %s (%v)", got, err)
+	}
+}
+
+func TestReplayReachesOnlyTheFailedConsumer(t *testing.T) {
+	srv, err := natsserver.NewServer(&natsserver.Options{
+		Host:      "127.0.0.1",
+		Port:      natsserver.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start()
+	t.Cleanup(func() {
+		srv.Shutdown()
+		srv.WaitForShutdown()
+	})
+	if !srv.ReadyForConnections(10 * time.Second) {
+		t.Fatal("nats server did not start")
+	}
+	nc, js, err := services.ConnectNATS(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := services.EnsureDeadLetterStream(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	handled := map[string]int{}
+	handler := func(durable string, fail bool) Handler {
+		return func(context.Context, *nats.Msg) error {
+			mu.Lock()
+			defer mu.Unlock()
+			handled[durable]++
+			if fail && handled[durable] == 1 {
+				return Permanent(errors.New("broken"))
+			}
+			return nil
+		}
+	}
+	counts := func() (int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return handled["failing"], handled["working"]
+	}
+
+	router := NewRouter(&Client{Conn: nc, JS: js})
+	for durable, fail := range map[string]bool{"failing": true, "working": false} {
+		router.Handle(Route{Subject: "files.updated", Durable: durable, Handler: handler(durable, fail), MaxDeliver: 3, AckWait: time.Second})
+	}
+	if err := router.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := js.Publish("files.updated", []byte(`{"file_id":"f1"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []services.DeadLetterEntry
+	waitFor(t, "the dead letter", func() bool {
+		entries, _, err = services.ListDeadLetters(0, 10)
+		return err == nil && len(entries) == 1
+	})
+	if entries[0].Consumer != "failing" || entries[0].Subject != "files.updated" {
+		t.Fatalf("dead letter of %s on %s", entries[0].Consumer, entries[0].Subject)
+	}
+
+	if err := services.ReplayDeadLetter(entries[0].Sequence); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the replay", func() bool {
+		failing, _ := counts()
+		return failing == 2
+	})
+	waitFor(t, "the replay to be acknowledged", func() bool {
+		info, err := js.StreamInfo(services.DeadLetterReplayStream)
+		return err == nil && info.State.Msgs == 0
+	})
+	if _, working := counts(); working != 1 {
+		t.Fatalf("the working consumer handled the event %d times", working)
+	}
+	if entries, total, err := services.ListDeadLetters(0, 10); err != nil || total != 0 {
+		t.Fatalf("%d dead letters left (%v): %v", total, err, entries)
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+)
+
+// Mode decides how files that are not known to be clean may be served.
+type Mode string
+
+const (
+	// ModeBlock serves nothing until the scan says clean
+	ModeBlock Mode = "block"
+	// ModeOwnerOnly lets the owner fetch unscanned files; shares stay blocked
+	ModeOwnerOnly Mode = "owner"
+	// ModeWarn serves unscanned files with a warning header
+	ModeWarn Mode = "warn"
+)
+
+// Error codes returned to clients so the frontend can render a specific message
+const (
+	CodeScanPending     = "scan_pending"
+	CodeScanIncomplete  = "scan_incomplete"
+	CodeFileInfected    = "file_infected"
+	CodeArchiveRejected = "archive_rejected"
+)
+
+var mode = ModeBlock
+
+// ParseMode validates a configured mode.
+func ParseMode(value string) (Mode, error) {
+	switch m := Mode(value); m {
+	case ModeBlock, ModeOwnerOnly, ModeWarn:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown scan access policy %q (want block, owner or warn)", value)
+	}
+}
+
+// SetMode configures the process-wide policy; it is called once at startup.
+func SetMode(m Mode) {
+	mode = m
+}
+
+func CurrentMode() Mode {
+	return mode
+}
+
+// Decision is the outcome of evaluating the policy for one request.
+type Decision struct {
+	Allowed bool
+	// Status, Code and Message describe the rejection when Allowed is false
+	Status  int
+	Code    string
+	Message string
+	// Warning is set when the file is served despite not being known clean
+	Warning string
+}
+
+// Evaluate decides whether the bytes of file may be served to requesterID.
+// requesterID is empty for anonymous share-link downloads.
+func Evaluate(m Mode, file models.FileMetadata, requesterID string) Decision {
+	if file.ScanOverride {
+		return Decision{Allowed: true}
+	}
+
+	switch file.ScanStatus {
+	case models.ScanStatusClean, models.ScanStatusReleased:
+		return Decision{Allowed: true}
+	case models.ScanStatusInfected:
+		// Infected files are never served; quarantine review is the way out
+		return Decision{
+			Status:  http.StatusConflict,
+			Code:    CodeFileInfected,
+			Message: "File was flagged as infected and cannot be downloaded",
+		}
+	}
+	if models.IsArchiveRejection(file.ScanStatus) {
+		return Decision{
+			Status:  http.StatusConflict,
+			Code:    CodeArchiveRejected,
+			Message: "Archive exceeds the allowed limits and cannot be downloaded",
+		}
+	}
+
+	isOwner := requesterID != "" && requesterID == file.UserID
+	switch {
+	case m == ModeWarn:
+		return Decision{Allowed: true, Warning: "file has not been verified by the virus scanner"}
+	case m == ModeOwnerOnly && isOwner:
+		return Decision{Allowed: true, Warning: "file has not been verified by the virus scanner"}
+	case file.ScanStatus == models.ScanStatusPending || file.ScanStatus == "":
+		// 423: the lock goes away once the scan finishes
+		return Decision{
+			Status:  http.StatusLocked,
+			Code:    CodeScanPending,
+			Message: "File is still being scanned, try again shortly",
+		}
+	default:
+		return Decision{
+			Status:  http.StatusConflict,
+			Code:    CodeScanIncomplete,
+			Message: "File could not be verified by the virus scanner",
+		}
+	}
+}
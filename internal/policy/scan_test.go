@@ -0,0 +1,58 @@
+package policy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+)
+
+func TestEvaluate(t *testing.T) {
+	const owner = "owner-id"
+	file := func(status string) models.FileMetadata {
+		return models.FileMetadata{ID: "f", UserID: owner, ScanStatus: status}
+	}
+	overridden := file(models.ScanStatusInfected)
+	overridden.ScanOverride = true
+
+	tests := []struct {
+		name      string
+		mode      Mode
+		file      models.FileMetadata
+		requester string
+		allowed   bool
+		status    int
+		warning   bool
+	}{
+		{"clean is always served", ModeBlock, file(models.ScanStatusClean), "", true, 0, false},
+		{"released is served", ModeBlock, file(models.ScanStatusReleased), owner, true, 0, false},
+		{"block pending", ModeBlock, file(models.ScanStatusPending), owner, false, http.StatusLocked, false},
+		{"block too large", ModeBlock, file(models.ScanStatusTooLarge), owner, false, http.StatusConflict, false},
+		{"owner mode serves owner", ModeOwnerOnly, file(models.ScanStatusPending), owner, true, 0, true},
+		{"owner mode blocks others", ModeOwnerOnly, file(models.ScanStatusPending), "", false, http.StatusLocked, false},
+		{"warn mode serves anyone", ModeWarn, file(models.ScanStatusPending), "", true, 0, true},
+		{"infected blocked even in warn", ModeWarn, file(models.ScanStatusInfected), owner, false, http.StatusConflict, false},
+		{"rejected archive blocked even in warn", ModeWarn, file(models.ScanStatusArchiveRatio), owner, false, http.StatusConflict, false},
+		{"admin override wins", ModeBlock, overridden, "", true, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Evaluate(tt.mode, tt.file, tt.requester)
+			if d.Allowed != tt.allowed || d.Status != tt.status || (d.Warning != "") != tt.warning {
+				t.Fatalf("got %+v", d)
+			}
+		})
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for _, valid := range []string{"block", "owner", "warn"} {
+		if _, err := ParseMode(valid); err != nil {
+			t.Errorf("%s: %v", valid, err)
+		}
+	}
+	if _, err := ParseMode("allow"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
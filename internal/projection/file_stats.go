@@ -0,0 +1,330 @@
+// Package projection rebuilds read models that are derived from the files
+// table or from the file-events stream, such as user_file_stats.
+package projection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/command"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/infrastructure"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/query"
+)
+
+// Sources a projection can be rebuilt from
+const (
+	// SourceFiles counts the rows in files, the source of truth
+	SourceFiles = "files"
+	// SourceEvents replays files.uploaded and files.deleted* from the
+	// file-events stream
+	SourceEvents = "events"
+)
+
+// maxReportedDrift caps the differences listed in a report
+const maxReportedDrift = 1000
+
+// FileStatsOptions selects what RebuildFileStats checks and how
+type FileStatsOptions struct {
+	// UserID limits the rebuild to one user
+	UserID string
+	// Shard limits the rebuild to one shard; all shards when nil
+	Shard  *int
+	Source string
+	// DryRun only reports the differences
+	DryRun    bool
+	BatchSize int
+	// Pause between batches spares the databases
+	Pause time.Duration
+}
+
+// FileStatsReport is the outcome of RebuildFileStats
+type FileStatsReport struct {
+	Source       string `json:"source"`
+	DryRun       bool   `json:"dry_run"`
+	Shards       []int  `json:"shards"`
+	UsersChecked int    `json:"users_checked"`
+	// Drifted users had a wrong count; Repaired of them were corrected
+	Drifted  int `json:"drifted"`
+	Repaired int `json:"repaired"`
+	// Differences lists the first drifted users
+	Differences []models.FileStatsDrift `json:"differences"`
+	// Partial is set when the stream no longer holds the oldest events;
+	// counts replayed from it are only reported then
+	Partial   bool      `json:"partial,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	Duration  string    `json:"duration"`
+}
+
+func (r *FileStatsReport) add(drift []models.FileStatsDrift) {
+	r.Drifted += len(drift)
+	room := maxReportedDrift - len(r.Differences)
+	r.Differences = append(r.Differences, drift[:min(room, len(drift))]...)
+}
+
+// RebuildFileStats compares the stored file counts with the source and,
+// unless DryRun is set, corrects them. Users are handled in batches; only
+// the stats rows of drifted users are locked while they are corrected.
+func RebuildFileStats(ctx context.Context, opts FileStatsOptions) (FileStatsReport, error) {
+	if opts.Source == "" {
+		opts.Source = SourceFiles
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	report := FileStatsReport{Source: opts.Source, DryRun: opts.DryRun, Differences: []models.FileStatsDrift{}, StartedAt: time.Now().UTC()}
+	defer func() { report.Duration = time.Since(report.StartedAt).Round(time.Millisecond).String() }()
+
+	shards, err := selectShards(opts)
+	if err != nil {
+		return report, err
+	}
+	report.Shards = shards
+
+	switch opts.Source {
+	case SourceFiles:
+		for _, shard := range shards {
+			if err := rebuildFromFiles(ctx, shard, opts, &report); err != nil {
+				return report, fmt.Errorf("shard %d: %w", shard, err)
+			}
+		}
+	case SourceEvents:
+		if err := rebuildFromEvents(ctx, shards, opts, &report); err != nil {
+			return report, err
+		}
+	default:
+		return report, fmt.Errorf("unknown source %q, use %s or %s", opts.Source, SourceFiles, SourceEvents)
+	}
+	return report, nil
+}
+
+func selectShards(opts FileStatsOptions) ([]int, error) {
+	count := infrastructure.ShardCount()
+	switch {
+	case opts.UserID != "":
+		return []int{infrastructure.ShardOf(opts.UserID)}, nil
+	case opts.Shard != nil:
+		if *opts.Shard < 0 || *opts.Shard >= count {
+			return nil, fmt.Errorf("no shard %d, %d configured", *opts.Shard, count)
+		}
+		return []int{*opts.Shard}, nil
+	}
+	shards := make([]int, count)
+	for i := range shards {
+		shards[i] = i
+	}
+	return shards, nil
+}
+
+// rebuildFromFiles pages through the users of a shard and recounts the files
+// of those whose stored count differs
+func rebuildFromFiles(ctx context.Context, shard int, opts FileStatsOptions, report *FileStatsReport) error {
+	after := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		userIDs := []string{opts.UserID}
+		if opts.UserID == "" {
+			var err error
+			if userIDs, err = query.ListFileStatsUsers(shard, after, opts.BatchSize); err != nil {
+				return err
+			}
+			if len(userIDs) == 0 {
+				return nil
+			}
+			after = userIDs[len(userIDs)-1]
+		}
+		report.UsersChecked += len(userIDs)
+
+		drift, err := query.FindFileStatsDrift(shard, userIDs)
+		if err != nil {
+			return err
+		}
+		if len(drift) > 0 && !opts.DryRun {
+			// Recount under lock; drift caused by uploads in flight disappears
+			if drift, err = command.RepairFileStats(shard, driftedUsers(drift)); err != nil {
+				return err
+			}
+			report.Repaired += len(drift)
+		}
+		report.add(drift)
+
+		if opts.UserID != "" || len(userIDs) < opts.BatchSize {
+			return nil
+		}
+		pause(ctx, opts.Pause)
+	}
+}
+
+// rebuildFromEvents replays the stream into per-user file counts and
+// compares them with the stored counts
+func rebuildFromEvents(ctx context.Context, shards []int, opts FileStatsOptions, report *FileStatsReport) error {
+	wanted := func(userID string) bool {
+		if opts.UserID != "" {
+			return userID == opts.UserID
+		}
+		return slices.Contains(shards, infrastructure.ShardOf(userID))
+	}
+
+	files := newFileSets()
+	replay, err := services.ReplayStream(ctx, services.FileEventsStream, func(subject string, data []byte) error {
+		return files.apply(subject, data, wanted)
+	})
+	if err != nil {
+		return fmt.Errorf("replay %s: %w", services.FileEventsStream, err)
+	}
+	report.Partial = replay.FirstSeq > 1
+	apply := !opts.DryRun && !report.Partial
+
+	for _, shard := range shards {
+		// Users with a stored count but no events left must be checked too
+		counts := files.counts(func(userID string) bool { return infrastructure.ShardOf(userID) == shard })
+		if opts.UserID == "" {
+			after := ""
+			for {
+				userIDs, err := query.ListFileStatsUsers(shard, after, opts.BatchSize)
+				if err != nil {
+					return fmt.Errorf("shard %d: %w", shard, err)
+				}
+				if len(userIDs) == 0 {
+					break
+				}
+				for _, userID := range userIDs {
+					if _, ok := counts[userID]; !ok {
+						counts[userID] = 0
+					}
+				}
+				after = userIDs[len(userIDs)-1]
+			}
+		} else if _, ok := counts[opts.UserID]; !ok {
+			counts[opts.UserID] = 0
+		}
+
+		userIDs := make([]string, 0, len(counts))
+		for userID := range counts {
+			userIDs = append(userIDs, userID)
+		}
+		slices.Sort(userIDs)
+
+		for start := 0; start < len(userIDs); start += opts.BatchSize {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			batch := userIDs[start:min(start+opts.BatchSize, len(userIDs))]
+			report.UsersChecked += len(batch)
+
+			stored, err := query.GetFileCounts(shard, batch)
+			if err != nil {
+				return fmt.Errorf("shard %d: %w", shard, err)
+			}
+			var drift []models.FileStatsDrift
+			for _, userID := range batch {
+				if stored[userID] != counts[userID] {
+					drift = append(drift, models.FileStatsDrift{UserID: userID, Stored: stored[userID], Actual: counts[userID]})
+				}
+			}
+			if len(drift) > 0 && apply {
+				replayed := map[string]int{}
+				for _, d := range drift {
+					replayed[d.UserID] = d.Actual
+				}
+				if drift, err = command.SetFileStats(shard, replayed); err != nil {
+					return fmt.Errorf("shard %d: %w", shard, err)
+				}
+				report.Repaired += len(drift)
+			}
+			report.add(drift)
+			pause(ctx, opts.Pause)
+		}
+	}
+	return nil
+}
+
+// fileSets tracks the live files of each user while events are replayed.
+// Sets rather than counters make duplicate deliveries harmless.
+type fileSets map[string]map[string]struct{}
+
+func newFileSets() fileSets {
+	return fileSets{}
+}
+
+func (f fileSets) apply(subject string, data []byte, wanted func(userID string) bool) error {
+	switch subject {
+	case events.SubjectFileUploaded:
+		e, _, err := events.Decode[events.FileUploaded](data)
+		if err != nil || !wanted(e.UserID) {
+			return skipInvalid(err)
+		}
+		if f[e.UserID] == nil {
+			f[e.UserID] = map[string]struct{}{}
+		}
+		f[e.UserID][e.FileID] = struct{}{}
+	case events.SubjectFileDeleted:
+		e, _, err := events.Decode[events.FileDeleted](data)
+		if err != nil || !wanted(e.UserID) {
+			return skipInvalid(err)
+		}
+		f.remove(e.UserID, e.FileID)
+	case events.SubjectFilesDeleted:
+		e, _, err := events.Decode[events.FilesDeleted](data)
+		if err != nil || !wanted(e.UserID) {
+			return skipInvalid(err)
+		}
+		for _, file := range e.Files {
+			f.remove(e.UserID, file.FileID)
+		}
+	}
+	return nil
+}
+
+func (f fileSets) remove(userID, fileID string) {
+	delete(f[userID], fileID)
+	// Keep the user, so a count of zero is still compared
+	if f[userID] == nil {
+		f[userID] = map[string]struct{}{}
+	}
+}
+
+// counts returns the number of live files of the users matching keep
+func (f fileSets) counts(keep func(userID string) bool) map[string]int {
+	counts := map[string]int{}
+	for userID, files := range f {
+		if keep(userID) {
+			counts[userID] = len(files)
+		}
+	}
+	return counts
+}
+
+// skipInvalid ignores events the consumers would have dead-lettered too
+func skipInvalid(err error) error {
+	if errors.Is(err, events.ErrInvalidEvent) {
+		return nil
+	}
+	return err
+}
+
+func driftedUsers(drift []models.FileStatsDrift) []string {
+	userIDs := make([]string, len(drift))
+	for i, d := range drift {
+		userIDs[i] = d.UserID
+	}
+	return userIDs
+}
+
+func pause(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,62 @@
+package projection
+
+import (
+	"testing"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+)
+
+func TestFileSetsReplay(t *testing.T) {
+	var stream []events.Event
+	upload := func(userID, fileID string) {
+		stream = append(stream, events.FileUploaded{FileID: fileID, UserID: userID, ObjectName: fileID})
+	}
+	upload("u1", "f1")
+	upload("u1", "f2")
+	upload("u1", "f2") // redelivered by the outbox relay
+	upload("u1", "f3")
+	upload("u2", "f4")
+	upload("u3", "f5")
+	stream = append(stream,
+		events.FileDeleted{FileID: "f1", UserID: "u1", Reason: events.DeleteReasonUser},
+		events.FileDeleted{FileID: "f9", UserID: "u1", Reason: events.DeleteReasonUser}, // never seen uploaded
+		events.FilesDeleted{UserID: "u2", Reason: events.DeleteReasonAccountDeletion, Files: []events.DeletedFile{{FileID: "f4"}}},
+	)
+
+	files := newFileSets()
+	wanted := func(userID string) bool { return userID != "u3" }
+	for _, e := range stream {
+		_, data, err := events.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := files.apply(e.Subject(), data, wanted); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := files.apply(events.SubjectFileUploaded, []byte(`{"file_id":""}`), wanted); err != nil {
+		t.Fatalf("invalid event: %v", err)
+	}
+
+	counts := files.counts(func(string) bool { return true })
+	want := map[string]int{"u1": 2, "u2": 0}
+	if len(counts) != len(want) {
+		t.Fatalf("counts %v, want %v", counts, want)
+	}
+	for userID, n := range want {
+		if counts[userID] != n {
+			t.Fatalf("counts %v, want %v", counts, want)
+		}
+	}
+}
+
+func TestReportCapsDifferences(t *testing.T) {
+	report := FileStatsReport{}
+	drift := make([]models.FileStatsDrift, maxReportedDrift-1)
+	report.add(drift)
+	report.add(drift)
+	if report.Drifted != 2*len(drift) || len(report.Differences) != maxReportedDrift {
+		t.Fatalf("drifted %d, listed %d", report.Drifted, len(report.Differences))
+	}
+}
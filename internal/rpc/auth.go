@@ -0,0 +1,54 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// VerifyFunc verifies a bearer token and returns the client ID it was issued to
+type VerifyFunc func(ctx context.Context, token string) (clientID string, err error)
+
+var errUnauthenticated = errors.New("missing or invalid service token")
+
+// ACL lists the clients allowed to call each endpoint.
+type ACL map[string]map[string]bool
+
+// allEndpoints marks a client allowed to call every endpoint
+const allEndpoints = "*"
+
+// ParseACL reads a comma separated list of client IDs, each optionally
+// limited to some endpoints: "billing:stats,search:get|list,admin-tools".
+func ParseACL(value string) ACL {
+	acl := ACL{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		client, endpoints, limited := strings.Cut(entry, ":")
+		if acl[client] == nil {
+			acl[client] = map[string]bool{}
+		}
+		if !limited {
+			acl[client][allEndpoints] = true
+			continue
+		}
+		for _, endpoint := range strings.Split(endpoints, "|") {
+			acl[client][strings.TrimSpace(endpoint)] = true
+		}
+	}
+	return acl
+}
+
+// Allows reports whether client may call endpoint, e.g. "get"
+func (a ACL) Allows(client, endpoint string) bool {
+	endpoints := a[client]
+	return endpoints[allEndpoints] || endpoints[endpoint]
+}
+
+// bearerToken extracts the token of an "Authorization: Bearer ..." header
+func bearerToken(header string) (string, bool) {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	return token, ok && token != ""
+}
@@ -0,0 +1,226 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/policy"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/query"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+)
+
+// Config of the request-reply service
+type Config struct {
+	// QueueGroup is shared by all replicas, so each request is served once
+	QueueGroup string
+	// Timeout bounds the work done for one request
+	Timeout time.Duration
+	ACL     ACL
+	Verify  VerifyFunc
+}
+
+// Error is returned by endpoint functions to answer with a specific code.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string { return e.Code + ": " + e.Message }
+
+func errorf(code, format string, args ...interface{}) error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+const (
+	defaultPresignExpiry = 15 * time.Minute
+	maxPresignExpiry     = 24 * time.Hour
+)
+
+// Start registers the file-service micro service. Its endpoints share
+// cfg.QueueGroup; discovery, info and stats are answered under $SRV.
+func Start(nc *nats.Conn, cfg Config) (micro.Service, error) {
+	svc, err := micro.AddService(nc, micro.Config{
+		Name:        "file-service",
+		Version:     "1.0.0",
+		Description: "File metadata for platform services",
+		QueueGroup:  cfg.QueueGroup,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	group := svc.AddGroup("files.rpc")
+	for _, endpoint := range []struct {
+		name    string
+		handler micro.HandlerFunc
+	}{
+		{"get", handle(cfg, "get", getFile)},
+		{"list", handle(cfg, "list", listFiles)},
+		{"presign", handle(cfg, "presign", presignFile)},
+		{"stats", handle(cfg, "stats", getStats)},
+		{"deletion", handle(cfg, "deletion", getDeletion)},
+	} {
+		if err := group.AddEndpoint(endpoint.name, endpoint.handler); err != nil {
+			_ = svc.Stop()
+			return nil, err
+		}
+	}
+
+	log.Printf("[RPC] serving files.rpc.* in queue group %s", cfg.QueueGroup)
+	return svc, nil
+}
+
+type request interface {
+	validate() error
+}
+
+// handle adapts a typed endpoint function: it authorizes the caller, decodes
+// and validates the request and encodes the response or error.
+func handle[Req request, Resp any](cfg Config, name string, fn func(ctx context.Context, req Req) (Resp, error)) micro.HandlerFunc {
+	return func(r micro.Request) {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+		defer cancel()
+
+		client, err := authorize(ctx, cfg, r, name)
+		if err != nil {
+			respondError(r, name, client, err)
+			return
+		}
+
+		var req Req
+		if err := json.Unmarshal(r.Data(), &req); err != nil {
+			respondError(r, name, client, errorf(CodeBadRequest, "invalid request: %v", err))
+			return
+		}
+		if err := req.validate(); err != nil {
+			respondError(r, name, client, errorf(CodeBadRequest, "%v", err))
+			return
+		}
+
+		resp, err := fn(ctx, req)
+		if err != nil {
+			respondError(r, name, client, err)
+			return
+		}
+		if err := r.RespondJSON(resp); err != nil {
+			log.Printf("[RPC] %s: respond to %s failed: %v", name, client, err)
+		}
+	}
+}
+
+func authorize(ctx context.Context, cfg Config, r micro.Request, endpoint string) (string, error) {
+	token, ok := bearerToken(r.Headers().Get("Authorization"))
+	if !ok || cfg.Verify == nil {
+		return "", errorf(CodeUnauthorized, "%v", errUnauthenticated)
+	}
+	client, err := cfg.Verify(ctx, token)
+	if err != nil {
+		return "", errorf(CodeUnauthorized, "%v: %v", errUnauthenticated, err)
+	}
+	if !cfg.ACL.Allows(client, endpoint) {
+		return client, errorf(CodeForbidden, "client %s may not call %s", client, endpoint)
+	}
+	return client, nil
+}
+
+func respondError(r micro.Request, endpoint, client string, err error) {
+	var rpcErr *Error
+	if !errors.As(err, &rpcErr) {
+		log.Printf("[RPC] %s for %s failed: %v", endpoint, client, err)
+		rpcErr = &Error{Code: CodeInternal, Message: "internal error"}
+	}
+	if rerr := r.Error(rpcErr.Code, rpcErr.Message, nil); rerr != nil {
+		log.Printf("[RPC] %s: error response failed: %v", endpoint, rerr)
+	}
+}
+
+func getFile(ctx context.Context, req GetRequest) (File, error) {
+	metadata, ok := query.GetFileMetadataForUser(ctx, req.FileID, req.UserID)
+	if !ok {
+		return File{}, errorf(CodeNotFound, "file %s not found", req.FileID)
+	}
+	return newFile(metadata), nil
+}
+
+func listFiles(_ context.Context, req ListRequest) (ListResponse, error) {
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.PageSize < 1 {
+		req.PageSize = 50
+	}
+	if req.PageSize > 500 {
+		req.PageSize = 500
+	}
+
+	page, err := query.GetUserFileMetadataPage(req.UserID, req.PageSize, (req.Page-1)*req.PageSize)
+	if err != nil {
+		return ListResponse{}, err
+	}
+	total, err := query.GetUserFileCount(req.UserID)
+	if err != nil {
+		return ListResponse{}, err
+	}
+
+	files := make([]File, 0, len(page))
+	for _, metadata := range page {
+		files = append(files, newFile(metadata))
+	}
+	return ListResponse{Files: files, Total: total, Page: req.Page, PageSize: req.PageSize}, nil
+}
+
+// presignFile hands out a download URL under the same scan policy as
+// anonymous share links: the calling service is never the owner.
+func presignFile(ctx context.Context, req PresignRequest) (PresignResponse, error) {
+	metadata, ok := query.GetFileMetadataForUser(ctx, req.FileID, req.UserID)
+	if !ok {
+		return PresignResponse{}, errorf(CodeNotFound, "file %s not found", req.FileID)
+	}
+	// Objects of a user being deleted may already be gone
+	if _, deleting, err := query.GetUserDeletion(ctx, req.UserID); err != nil {
+		return PresignResponse{}, err
+	} else if deleting {
+		return PresignResponse{}, errorf(CodeGone, "user %s is being deleted", req.UserID)
+	}
+	if decision := policy.Evaluate(policy.CurrentMode(), metadata, ""); !decision.Allowed {
+		return PresignResponse{}, errorf(strconv.Itoa(decision.Status), "%s: %s", decision.Code, decision.Message)
+	}
+
+	minioService := services.GetMinioService()
+	if minioService == nil {
+		return PresignResponse{}, errors.New("storage service not available")
+	}
+
+	expiry := defaultPresignExpiry
+	if req.ExpirySeconds > 0 {
+		expiry = min(time.Duration(req.ExpirySeconds)*time.Second, maxPresignExpiry)
+	}
+	u, err := minioService.PresignedGetURL(ctx, metadata.FilePath, metadata.OriginalName, expiry)
+	if err != nil {
+		return PresignResponse{}, err
+	}
+	return PresignResponse{URL: u.String(), ExpiresAt: time.Now().Add(expiry).UTC()}, nil
+}
+
+func getStats(_ context.Context, req StatsRequest) (StatsResponse, error) {
+	stats, err := query.GetUserFileStats(req.UserID)
+	if err != nil {
+		return StatsResponse{}, err
+	}
+	return StatsResponse{UserID: req.UserID, FileCount: stats.FileCount}, nil
+}
+
+func getDeletion(ctx context.Context, req DeletionRequest) (DeletionResponse, error) {
+	job, exists, err := query.GetUserDeletion(ctx, req.UserID)
+	if err != nil {
+		return DeletionResponse{}, err
+	}
+	return newDeletionResponse(req.UserID, job, exists), nil
+}
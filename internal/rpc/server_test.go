@@ -0,0 +1,114 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go/micro"
+)
+
+type fakeRequest struct {
+	data    []byte
+	headers micro.Headers
+
+	code     string
+	response []byte
+}
+
+func (r *fakeRequest) Respond(data []byte, _ ...micro.RespondOpt) error {
+	r.response = data
+	return nil
+}
+
+func (r *fakeRequest) RespondJSON(v any, _ ...micro.RespondOpt) error {
+	data, err := json.Marshal(v)
+	r.response = data
+	return err
+}
+
+func (r *fakeRequest) Error(code, _ string, _ []byte, _ ...micro.RespondOpt) error {
+	r.code = code
+	return nil
+}
+
+func (r *fakeRequest) Data() []byte           { return r.data }
+func (r *fakeRequest) Headers() micro.Headers { return r.headers }
+func (r *fakeRequest) Subject() string        { return SubjectStats }
+func (r *fakeRequest) Reply() string          { return "_INBOX.test" }
+
+func TestParseACL(t *testing.T) {
+	acl := ParseACL("billing:stats, search:get|list,ops")
+
+	for _, tc := range []struct {
+		client, endpoint string
+		want             bool
+	}{
+		{"billing", "stats", true},
+		{"billing", "presign", false},
+		{"search", "list", true},
+		{"search", "stats", false},
+		{"ops", "presign", true},
+		{"unknown", "get", false},
+	} {
+		if got := acl.Allows(tc.client, tc.endpoint); got != tc.want {
+			t.Errorf("Allows(%s, %s) = %t, want %t", tc.client, tc.endpoint, got, tc.want)
+		}
+	}
+}
+
+func TestHandle(t *testing.T) {
+	cfg := Config{
+		Timeout: time.Second,
+		ACL:     ParseACL("billing:stats"),
+		Verify: func(_ context.Context, token string) (string, error) {
+			if token == "expired" {
+				return "", errors.New("token is expired")
+			}
+			return token, nil
+		},
+	}
+	handler := handle(cfg, "stats", func(_ context.Context, req StatsRequest) (StatsResponse, error) {
+		if req.UserID == "missing" {
+			return StatsResponse{}, errorf(CodeNotFound, "no such user")
+		}
+		if req.UserID == "broken" {
+			return StatsResponse{}, errors.New("shard down")
+		}
+		return StatsResponse{UserID: req.UserID, FileCount: 3}, nil
+	})
+
+	for _, tc := range []struct {
+		name, auth, data, code string
+	}{
+		{"no token", "", `{"user_id":"u"}`, CodeUnauthorized},
+		{"invalid token", "Bearer expired", `{"user_id":"u"}`, CodeUnauthorized},
+		{"client not allowed", "Bearer search", `{"user_id":"u"}`, CodeForbidden},
+		{"malformed", "Bearer billing", `{`, CodeBadRequest},
+		{"missing user", "Bearer billing", `{}`, CodeBadRequest},
+		{"typed error", "Bearer billing", `{"user_id":"missing"}`, CodeNotFound},
+		{"internal error", "Bearer billing", `{"user_id":"broken"}`, CodeInternal},
+		{"ok", "Bearer billing", `{"user_id":"u"}`, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := &fakeRequest{data: []byte(tc.data), headers: micro.Headers{}}
+			if tc.auth != "" {
+				req.headers["Authorization"] = []string{tc.auth}
+			}
+			handler(req)
+
+			if req.code != tc.code {
+				t.Fatalf("code %q, want %q", req.code, tc.code)
+			}
+			if tc.code != "" {
+				return
+			}
+			var resp StatsResponse
+			if err := json.Unmarshal(req.response, &resp); err != nil || resp.FileCount != 3 {
+				t.Fatalf("response %s (%v)", req.response, err)
+			}
+		})
+	}
+}
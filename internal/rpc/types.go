@@ -0,0 +1,178 @@
+// Package rpc serves file metadata to other services of the platform over
+// NATS request-reply. Requests and responses are JSON; callers authenticate
+// with a Keycloak client-credentials token in the Authorization header.
+package rpc
+
+import (
+	"errors"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+)
+
+// Subjects of the endpoints, all under the "files.rpc" group
+const (
+	SubjectGet      = "files.rpc.get"
+	SubjectList     = "files.rpc.list"
+	SubjectPresign  = "files.rpc.presign"
+	SubjectStats    = "files.rpc.stats"
+	SubjectDeletion = "files.rpc.deletion"
+)
+
+// Error codes returned in the Nats-Service-Error-Code header
+const (
+	CodeBadRequest   = "400"
+	CodeUnauthorized = "401"
+	CodeForbidden    = "403"
+	CodeNotFound     = "404"
+	CodeConflict     = "409"
+	CodeGone         = "410"
+	CodeInternal     = "500"
+)
+
+// Every request names the owning user; it selects the shard to query.
+
+type GetRequest struct {
+	UserID string `json:"user_id"`
+	FileID string `json:"file_id"`
+}
+
+func (r GetRequest) validate() error {
+	return required("user_id", r.UserID, "file_id", r.FileID)
+}
+
+type ListRequest struct {
+	UserID   string `json:"user_id"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"page_size"`
+}
+
+func (r ListRequest) validate() error {
+	return required("user_id", r.UserID)
+}
+
+type PresignRequest struct {
+	UserID string `json:"user_id"`
+	FileID string `json:"file_id"`
+	// ExpirySeconds defaults to 15 minutes and is capped at 24 hours
+	ExpirySeconds int `json:"expiry_seconds"`
+}
+
+func (r PresignRequest) validate() error {
+	return required("user_id", r.UserID, "file_id", r.FileID)
+}
+
+type StatsRequest struct {
+	UserID string `json:"user_id"`
+}
+
+func (r StatsRequest) validate() error {
+	return required("user_id", r.UserID)
+}
+
+type DeletionRequest struct {
+	UserID string `json:"user_id"`
+}
+
+func (r DeletionRequest) validate() error {
+	return required("user_id", r.UserID)
+}
+
+// required returns an error naming the first empty field; pairs are name, value
+func required(pairs ...string) error {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] == "" {
+			return errors.New(pairs[i] + " is required")
+		}
+	}
+	return nil
+}
+
+// File is the metadata other services may see; storage paths stay internal.
+type File struct {
+	ID           string     `json:"id"`
+	UserID       string     `json:"user_id"`
+	Name         string     `json:"name"`
+	OriginalName string     `json:"original_name"`
+	Size         int64      `json:"size"`
+	Type         string     `json:"type"`
+	Extension    string     `json:"extension"`
+	UploadedAt   time.Time  `json:"uploaded_at"`
+	ScanStatus   string     `json:"scan_status"`
+	ScannedAt    *time.Time `json:"scanned_at,omitempty"`
+	Quarantined  bool       `json:"quarantined"`
+}
+
+func newFile(m models.FileMetadata) File {
+	f := File{
+		ID:           m.ID,
+		UserID:       m.UserID,
+		Name:         m.Name,
+		OriginalName: m.OriginalName,
+		Size:         m.Size,
+		Type:         m.Type,
+		Extension:    m.Extension,
+		UploadedAt:   m.UploadedAt,
+		ScanStatus:   m.ScanStatus,
+		Quarantined:  m.QuarantinedAt != nil,
+	}
+	if !m.ScannedAt.IsZero() {
+		f.ScannedAt = &m.ScannedAt
+	}
+	return f
+}
+
+type ListResponse struct {
+	Files    []File `json:"files"`
+	Total    int64  `json:"total"`
+	Page     int    `json:"page"`
+	PageSize int    `json:"page_size"`
+}
+
+type PresignResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type StatsResponse struct {
+	UserID    string `json:"user_id"`
+	FileCount int    `json:"file_count"`
+}
+
+// Deletion states reported to the account service
+const (
+	DeletionNotStarted = "not_started"
+	DeletionRunning    = models.DeletionRunning
+	DeletionCompleted  = models.DeletionCompleted
+)
+
+// DeletionResponse reports how far the deletion of a user's data got; the
+// account service confirms an erasure request once Status is completed.
+type DeletionResponse struct {
+	UserID         string     `json:"user_id"`
+	Status         string     `json:"status"`
+	Phase          string     `json:"phase,omitempty"`
+	FilesDeleted   int        `json:"files_deleted"`
+	ObjectsDeleted int        `json:"objects_deleted"`
+	Attempts       int        `json:"attempts"`
+	LastError      string     `json:"last_error,omitempty"`
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+}
+
+func newDeletionResponse(userID string, job models.UserDeletion, exists bool) DeletionResponse {
+	if !exists {
+		return DeletionResponse{UserID: userID, Status: DeletionNotStarted}
+	}
+	return DeletionResponse{
+		UserID:         job.UserID,
+		Status:         job.Status,
+		Phase:          job.Phase,
+		FilesDeleted:   job.FilesDeleted,
+		ObjectsDeleted: job.ObjectsDeleted,
+		Attempts:       job.Attempts,
+		LastError:      job.LastError,
+		StartedAt:      &job.StartedAt,
+		CompletedAt:    job.CompletedAt,
+	}
+}
@@ -0,0 +1,305 @@
+package scanner
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// StatusRejected marks content that broke an archive limit; Reason says which.
+const StatusRejected Status = "rejected"
+
+// Reasons of rejected verdicts, one per archive limit
+const (
+	ReasonArchiveTooLarge  = "archive_too_large"
+	ReasonArchiveRatio     = "archive_ratio_exceeded"
+	ReasonArchiveEntries   = "archive_too_many_entries"
+	ReasonArchiveDepth     = "archive_too_deep"
+	ReasonArchiveEncrypted = "archive_encrypted"
+)
+
+// ArchiveLimits bound what the inspector is willing to unpack. A zero value
+// disables the corresponding limit.
+type ArchiveLimits struct {
+	// MaxDecompressedSize caps the bytes unpacked across all nesting levels
+	MaxDecompressedSize int64
+	// MaxRatio caps unpacked bytes per compressed byte, for the whole upload
+	// and for each zip entry
+	MaxRatio   float64
+	MaxEntries int
+	// MaxDepth is the number of archive layers allowed; a .tar.gz has two
+	MaxDepth        int
+	RejectEncrypted bool
+}
+
+// ratioFloor keeps small, highly compressible files (e.g. a zipped text file)
+// from tripping the ratio limit
+const ratioFloor = 1 << 20
+
+// spoolMemoryLimit is how much of a nested zip is buffered in memory before
+// it is spooled to a temporary file; zip needs random access to its directory
+const spoolMemoryLimit = 8 << 20
+
+type archiveKind int
+
+const (
+	archiveNone archiveKind = iota
+	archiveZip
+	archiveTar
+	archiveGzip
+)
+
+// ArchiveInspector unpacks zip, tar and gzip uploads, including nested ones,
+// before they are handed to the scanner engines and rejects those that break
+// its limits. Entries are only read, never stored.
+type ArchiveInspector struct {
+	Limits ArchiveLimits
+}
+
+func NewArchiveInspector(limits ArchiveLimits) *ArchiveInspector {
+	return &ArchiveInspector{Limits: limits}
+}
+
+func (a *ArchiveInspector) Name() string { return "archive" }
+
+// Inspect checks the size bytes readable from ra. Content that is not an
+// archive is clean; so is an archive that cannot be parsed, leaving the
+// verdict to the engines. Only a limit violation yields StatusRejected.
+func (a *ArchiveInspector) Inspect(ctx context.Context, ra io.ReaderAt, size int64) Verdict {
+	w := &archiveWalk{ctx: ctx, limits: a.Limits, compressed: size}
+	err := w.inspect(io.NewSectionReader(ra, 0, size), ra, size, 1)
+
+	var violation *archiveViolation
+	switch {
+	case err == nil:
+		return Verdict{Status: StatusClean, Engine: a.Name()}
+	case errors.As(err, &violation):
+		return Verdict{Status: StatusRejected, Engine: a.Name(), Reason: violation.reason, Detail: violation.detail}
+	case ctx.Err() != nil:
+		return Verdict{Status: StatusError, Engine: a.Name(), Reason: ctx.Err().Error()}
+	default:
+		return Verdict{Status: StatusClean, Engine: a.Name(), Detail: "unreadable archive: " + err.Error()}
+	}
+}
+
+type archiveViolation struct {
+	reason string
+	detail string
+}
+
+func (v *archiveViolation) Error() string { return v.reason + ": " + v.detail }
+
+type archiveWalk struct {
+	ctx          context.Context
+	limits       ArchiveLimits
+	compressed   int64
+	decompressed int64
+	entries      int
+}
+
+func detectArchive(head []byte) archiveKind {
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return archiveZip
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return archiveGzip
+	case len(head) >= 262 && bytes.Equal(head[257:262], []byte("ustar")):
+		return archiveTar
+	default:
+		return archiveNone
+	}
+}
+
+// inspect walks r if it is an archive. ra is set when the caller already has
+// random access to the same bytes, which saves spooling a zip.
+func (w *archiveWalk) inspect(r io.Reader, ra io.ReaderAt, size int64, depth int) error {
+	br := bufio.NewReaderSize(r, 4096)
+	head, _ := br.Peek(262)
+	kind := detectArchive(head)
+	if kind == archiveNone {
+		return nil
+	}
+	if w.limits.MaxDepth > 0 && depth > w.limits.MaxDepth {
+		return &archiveViolation{ReasonArchiveDepth, fmt.Sprintf("more than %d nested archives", w.limits.MaxDepth)}
+	}
+
+	switch kind {
+	case archiveZip:
+		if ra == nil {
+			spooled, n, cleanup, err := spool(br)
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+			ra, size = spooled, n
+		}
+		return w.zip(ra, size, depth)
+	case archiveTar:
+		return w.tar(br, depth)
+	default:
+		return w.gzip(br, depth)
+	}
+}
+
+func (w *archiveWalk) zip(ra io.ReaderAt, size int64, depth int) error {
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if err := w.countEntry(); err != nil {
+			return err
+		}
+		if f.Flags&0x1 != 0 {
+			if w.limits.RejectEncrypted {
+				return &archiveViolation{ReasonArchiveEncrypted, f.Name + " is encrypted"}
+			}
+			// Encrypted entries cannot be unpacked; the engines see them as is
+			continue
+		}
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = w.entry(rc, f.Name, int64(f.CompressedSize64), depth)
+		_ = rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *archiveWalk) tar(r io.Reader, depth int) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := w.countEntry(); err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		// Tar does not compress, so only the overall ratio applies
+		if err := w.entry(tr, hdr.Name, 0, depth); err != nil {
+			return err
+		}
+	}
+}
+
+func (w *archiveWalk) gzip(r io.Reader, depth int) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	if err := w.countEntry(); err != nil {
+		return err
+	}
+	return w.entry(gz, gz.Name, 0, depth)
+}
+
+// entry reads one archive member through the limits, descending into it when
+// it is an archive itself
+func (w *archiveWalk) entry(r io.Reader, name string, compressed int64, depth int) error {
+	counted := &countingReader{walk: w, r: r, name: name, compressed: compressed}
+	if err := w.inspect(counted, nil, -1, depth+1); err != nil {
+		return err
+	}
+	// Whatever the nested walk did not consume still counts as unpacked
+	_, err := io.Copy(io.Discard, counted)
+	return err
+}
+
+func (w *archiveWalk) countEntry() error {
+	w.entries++
+	if w.limits.MaxEntries > 0 && w.entries > w.limits.MaxEntries {
+		return &archiveViolation{ReasonArchiveEntries, fmt.Sprintf("more than %d entries", w.limits.MaxEntries)}
+	}
+	return nil
+}
+
+// countingReader enforces the size and ratio limits while an entry is unpacked
+type countingReader struct {
+	walk       *archiveWalk
+	r          io.Reader
+	name       string
+	compressed int64
+	n          int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	if err := c.walk.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	c.walk.decompressed += int64(n)
+	if verr := c.check(); verr != nil {
+		return n, verr
+	}
+	return n, err
+}
+
+func (c *countingReader) check() error {
+	w := c.walk
+	if max := w.limits.MaxDecompressedSize; max > 0 && w.decompressed > max {
+		return &archiveViolation{ReasonArchiveTooLarge, fmt.Sprintf("more than %d bytes unpacked", max)}
+	}
+	if w.limits.MaxRatio <= 0 {
+		return nil
+	}
+	if w.decompressed > ratioFloor && float64(w.decompressed) > w.limits.MaxRatio*float64(max(w.compressed, 1)) {
+		return &archiveViolation{ReasonArchiveRatio, fmt.Sprintf("unpacks to more than %.0f times its size", w.limits.MaxRatio)}
+	}
+	if c.compressed > 0 && c.n > ratioFloor && float64(c.n) > w.limits.MaxRatio*float64(c.compressed) {
+		return &archiveViolation{ReasonArchiveRatio, fmt.Sprintf("%s unpacks to more than %.0f times its size", c.name, w.limits.MaxRatio)}
+	}
+	return nil
+}
+
+// spool makes a nested archive randomly accessible, in memory when small and
+// in a temporary file otherwise
+func spool(r io.Reader) (io.ReaderAt, int64, func(), error) {
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, r, spoolMemoryLimit)
+	if err == io.EOF {
+		return bytes.NewReader(buf.Bytes()), n, func() {}, nil
+	}
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "archive-inspect-*")
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	cleanup := func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}
+	total, err := io.Copy(tmp, io.MultiReader(&buf, r))
+	if err != nil {
+		cleanup()
+		return nil, 0, nil, err
+	}
+	return tmp, total, cleanup, nil
+}
@@ -0,0 +1,107 @@
+package scanner
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+)
+
+type zipEntry struct {
+	name      string
+	data      []byte
+	encrypted bool
+}
+
+func makeZip(t *testing.T, entries ...zipEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		if e.encrypted {
+			hdr.Flags |= 0x1
+		}
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(e.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func makeTarGz(t *testing.T, name string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func inspect(limits ArchiveLimits, data []byte) Verdict {
+	return NewArchiveInspector(limits).Inspect(context.Background(), bytes.NewReader(data), int64(len(data)))
+}
+
+func TestArchiveInspector(t *testing.T) {
+	limits := ArchiveLimits{
+		MaxDecompressedSize: 64 << 20,
+		MaxRatio:            100,
+		MaxEntries:          10,
+		MaxDepth:            2,
+		RejectEncrypted:     true,
+	}
+
+	manyEntries := make([]zipEntry, 11)
+	for i := range manyEntries {
+		manyEntries[i] = zipEntry{name: string(rune('a'+i)) + ".txt", data: []byte("x")}
+	}
+	nested := makeZip(t, zipEntry{name: "inner.zip", data: makeZip(t, zipEntry{name: "innermost.zip", data: makeZip(t, zipEntry{name: "a.txt", data: []byte("a")})})})
+
+	tests := []struct {
+		name   string
+		limits ArchiveLimits
+		data   []byte
+		want   Status
+		reason string
+	}{
+		{"not an archive", limits, []byte("plain text"), StatusClean, ""},
+		{"small zip", limits, makeZip(t, zipEntry{name: "a.txt", data: []byte("hello")}), StatusClean, ""},
+		{"tar.gz is two layers", limits, makeTarGz(t, "a.txt", []byte("hello")), StatusClean, ""},
+		{"zip bomb", limits, makeZip(t, zipEntry{name: "zeros", data: make([]byte, 32<<20)}), StatusRejected, ReasonArchiveRatio},
+		{"too large", ArchiveLimits{MaxDecompressedSize: 1 << 20}, makeTarGz(t, "big", make([]byte, 2<<20)), StatusRejected, ReasonArchiveTooLarge},
+		{"too many entries", limits, makeZip(t, manyEntries...), StatusRejected, ReasonArchiveEntries},
+		{"too deep", limits, nested, StatusRejected, ReasonArchiveDepth},
+		{"encrypted", limits, makeZip(t, zipEntry{name: "secret", data: []byte("x"), encrypted: true}), StatusRejected, ReasonArchiveEncrypted},
+		{"encrypted allowed", ArchiveLimits{}, makeZip(t, zipEntry{name: "secret", data: []byte("x"), encrypted: true}), StatusClean, ""},
+		{"corrupt archive left to engines", limits, []byte("PK\x03\x04garbage"), StatusClean, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := inspect(tt.limits, tt.data)
+			if v.Status != tt.want || v.Reason != tt.reason {
+				t.Fatalf("got %+v, want %s %q", v, tt.want, tt.reason)
+			}
+		})
+	}
+}
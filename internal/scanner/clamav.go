@@ -0,0 +1,74 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+)
+
+// versionTTL is how long the clamd VERSION reply is reused between scans
+const versionTTL = time.Minute
+
+// ClamAV scans through clamd's INSTREAM protocol.
+type ClamAV struct {
+	service *services.ClamAVService
+
+	mu          sync.Mutex
+	engine      string
+	signatures  string
+	versionedAt time.Time
+}
+
+func NewClamAV(service *services.ClamAVService) *ClamAV {
+	return &ClamAV{service: service}
+}
+
+func (c *ClamAV) Name() string { return "clamav" }
+
+func (c *ClamAV) Scan(ctx context.Context, r io.Reader, size int64) Verdict {
+	verdict := c.scan(ctx, r, size)
+	if engine, signatures, err := c.Version(ctx); err == nil {
+		verdict.EngineVersion, verdict.SignatureVersion = engine, signatures
+	}
+	return verdict
+}
+
+func (c *ClamAV) scan(ctx context.Context, r io.Reader, size int64) Verdict {
+	if c.service.StreamMaxLength > 0 && size > c.service.StreamMaxLength {
+		return Verdict{Status: StatusSkipped, Engine: c.Name(), Reason: ReasonTooLarge}
+	}
+
+	result, err := c.service.ScanStream(ctx, r)
+	switch {
+	case errors.Is(err, services.ErrStreamTooLarge):
+		return Verdict{Status: StatusSkipped, Engine: c.Name(), Reason: ReasonTooLarge}
+	case err != nil:
+		return Verdict{Status: StatusError, Engine: c.Name(), Reason: err.Error()}
+	case result.Infected:
+		return Verdict{Status: StatusInfected, Engine: c.Name(), Signatures: []string{result.Signature}}
+	default:
+		return Verdict{Status: StatusClean, Engine: c.Name()}
+	}
+}
+
+// Version returns the clamd engine and signature database version, cached
+// for versionTTL so scans do not each open an extra connection.
+func (c *ClamAV) Version(ctx context.Context) (string, string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.versionedAt) < versionTTL {
+		return c.engine, c.signatures, nil
+	}
+
+	engine, signatures, err := c.service.Version(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	c.engine, c.signatures, c.versionedAt = engine, signatures, time.Now()
+	return engine, signatures, nil
+}
@@ -0,0 +1,135 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Composite streams the input once into several engines concurrently and
+// merges their verdicts. Infected beats error, error beats skipped, and the
+// result is only clean when every engine says so.
+type Composite struct {
+	engines []Scanner
+}
+
+func NewComposite(engines ...Scanner) *Composite {
+	return &Composite{engines: engines}
+}
+
+func (c *Composite) Name() string {
+	names := make([]string, len(c.engines))
+	for i, engine := range c.engines {
+		names[i] = engine.Name()
+	}
+	return "composite(" + strings.Join(names, ",") + ")"
+}
+
+// Version joins the versions of all versioned engines, so a signature update
+// in any of them changes the composite version.
+func (c *Composite) Version(ctx context.Context) (string, string, error) {
+	var engines, signatures []string
+	for _, engine := range c.engines {
+		versioned, ok := engine.(Versioned)
+		if !ok {
+			continue
+		}
+		e, s, err := versioned.Version(ctx)
+		if err != nil {
+			return "", "", err
+		}
+		engines = append(engines, e)
+		signatures = append(signatures, engine.Name()+":"+s)
+	}
+	return strings.Join(engines, ","), strings.Join(signatures, ","), nil
+}
+
+func (c *Composite) Scan(ctx context.Context, r io.Reader, size int64) Verdict {
+	verdicts := make([]Verdict, len(c.engines))
+	writers := make([]*io.PipeWriter, len(c.engines))
+
+	var wg sync.WaitGroup
+	for i, engine := range c.engines {
+		pr, pw := io.Pipe()
+		writers[i] = pw
+
+		wg.Add(1)
+		go func(i int, engine Scanner) {
+			defer wg.Done()
+			verdicts[i] = engine.Scan(ctx, pr, size)
+			// Engines may stop reading early; closing the reader lets fanOut skip them
+			_ = pr.CloseWithError(errEngineDone)
+		}(i, engine)
+	}
+
+	copyErr := fanOut(contextReader{ctx: ctx, r: r}, writers)
+	for _, pw := range writers {
+		_ = pw.CloseWithError(copyErr)
+	}
+	wg.Wait()
+
+	merged := mergeVerdicts(verdicts)
+	if engine, signatures, err := c.Version(ctx); err == nil {
+		merged.EngineVersion, merged.SignatureVersion = engine, signatures
+	}
+	return merged
+}
+
+var errEngineDone = errors.New("scanner: engine finished reading")
+
+// fanOut copies r into every writer, dropping writers whose engine has returned
+func fanOut(r io.Reader, writers []*io.PipeWriter) error {
+	active := make([]bool, len(writers))
+	for i := range active {
+		active[i] = true
+	}
+
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			for i, w := range writers {
+				if !active[i] {
+					continue
+				}
+				if _, werr := w.Write(buf[:n]); werr != nil {
+					active[i] = false
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func mergeVerdicts(verdicts []Verdict) Verdict {
+	rank := map[Status]int{StatusClean: 0, StatusSkipped: 1, StatusError: 2, StatusInfected: 3}
+
+	merged := Verdict{Status: StatusClean}
+	var engines, reasons []string
+	for _, v := range verdicts {
+		switch {
+		case rank[v.Status] > rank[merged.Status]:
+			merged.Status = v.Status
+			engines, reasons = nil, nil
+			merged.Signatures = nil
+		case rank[v.Status] < rank[merged.Status]:
+			continue
+		}
+		engines = append(engines, v.Engine)
+		if v.Reason != "" {
+			reasons = append(reasons, v.Reason)
+		}
+		merged.Signatures = append(merged.Signatures, v.Signatures...)
+	}
+
+	merged.Engine = strings.Join(engines, ",")
+	merged.Reason = strings.Join(reasons, "; ")
+	return merged
+}
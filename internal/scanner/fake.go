@@ -0,0 +1,45 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// EICAR is the industry standard anti-virus test string.
+var EICAR = []byte(`X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`)
+
+// Fake is a deterministic engine for tests and local development: content
+// containing the EICAR string is infected, everything else is clean.
+type Fake struct {
+	// Err, when set, makes every scan return an error verdict
+	Err error
+	// MaxSize, when positive, skips larger inputs like clamd's StreamMaxLength
+	MaxSize int64
+	// SignatureVersion is reported by Version; change it to simulate a signature update
+	SignatureVersion string
+}
+
+func (f *Fake) Name() string { return "fake" }
+
+func (f *Fake) Version(context.Context) (string, string, error) {
+	return "fake", f.SignatureVersion, nil
+}
+
+func (f *Fake) Scan(ctx context.Context, r io.Reader, size int64) Verdict {
+	if f.Err != nil {
+		return Verdict{Status: StatusError, Engine: f.Name(), Reason: f.Err.Error()}
+	}
+	if f.MaxSize > 0 && size > f.MaxSize {
+		return Verdict{Status: StatusSkipped, Engine: f.Name(), Reason: ReasonTooLarge}
+	}
+
+	data, err := io.ReadAll(contextReader{ctx: ctx, r: r})
+	if err != nil {
+		return Verdict{Status: StatusError, Engine: f.Name(), Reason: err.Error()}
+	}
+	if bytes.Contains(data, EICAR) {
+		return Verdict{Status: StatusInfected, Engine: f.Name(), Signatures: []string{"Eicar-Test-Signature"}, EngineVersion: "fake", SignatureVersion: f.SignatureVersion}
+	}
+	return Verdict{Status: StatusClean, Engine: f.Name(), EngineVersion: "fake", SignatureVersion: f.SignatureVersion}
+}
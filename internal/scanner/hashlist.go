@@ -0,0 +1,88 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// HashBlocklist flags files whose SHA-256 is on a list of known-bad hashes.
+type HashBlocklist struct {
+	// hashes maps a lower-case hex SHA-256 to the signature name reported on a match
+	hashes map[string]string
+}
+
+func NewHashBlocklist(hashes map[string]string) *HashBlocklist {
+	normalized := make(map[string]string, len(hashes))
+	for hash, name := range hashes {
+		normalized[strings.ToLower(hash)] = name
+	}
+	return &HashBlocklist{hashes: normalized}
+}
+
+// LoadHashBlocklist reads one "<sha256> [signature name]" entry per line.
+// Blank lines and lines starting with # are ignored.
+func LoadHashBlocklist(path string) (*HashBlocklist, error) {
+	if path == "" {
+		return nil, fmt.Errorf("scanner: hashlist engine requires HASH_BLOCKLIST_PATH")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("scanner: open hash blocklist: %w", err)
+	}
+	defer f.Close()
+
+	hashes := map[string]string{}
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		name := fields[0]
+		if len(fields) > 1 {
+			name = strings.Join(fields[1:], " ")
+		}
+		hashes[fields[0]] = name
+	}
+	if err := lines.Err(); err != nil {
+		return nil, fmt.Errorf("scanner: read hash blocklist: %w", err)
+	}
+
+	return NewHashBlocklist(hashes), nil
+}
+
+func (h *HashBlocklist) Name() string { return "hashlist" }
+
+func (h *HashBlocklist) Scan(ctx context.Context, r io.Reader, _ int64) Verdict {
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, contextReader{ctx: ctx, r: r}); err != nil {
+		return Verdict{Status: StatusError, Engine: h.Name(), Reason: err.Error()}
+	}
+
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	if name, found := h.hashes[sum]; found {
+		return Verdict{Status: StatusInfected, Engine: h.Name(), Signatures: []string{"Hash." + name}}
+	}
+	return Verdict{Status: StatusClean, Engine: h.Name()}
+}
+
+// contextReader stops reading once ctx is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -0,0 +1,91 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+)
+
+type Status string
+
+const (
+	StatusClean    Status = "clean"
+	StatusInfected Status = "infected"
+	StatusError    Status = "error"
+	StatusSkipped  Status = "skipped"
+)
+
+// ReasonTooLarge is the skip reason of engines that refuse oversized input
+const ReasonTooLarge = "too_large"
+
+// Verdict is the structured result of scanning one object.
+type Verdict struct {
+	Status     Status   `json:"status"`
+	Signatures []string `json:"signatures,omitempty"`
+	Engine     string   `json:"engine"`
+	// Reason explains error and skipped verdicts
+	Reason string `json:"reason,omitempty"`
+	// Detail describes a rejection, e.g. which archive entry broke a limit
+	Detail string `json:"detail,omitempty"`
+	// EngineVersion and SignatureVersion identify what the verdict was based on
+	EngineVersion    string `json:"engine_version,omitempty"`
+	SignatureVersion string `json:"signature_version,omitempty"`
+}
+
+// Scanner inspects a stream of size bytes. Implementations must not keep r
+// after returning and should stop early when ctx is done.
+type Scanner interface {
+	Name() string
+	Scan(ctx context.Context, r io.Reader, size int64) Verdict
+}
+
+// Versioned is implemented by engines whose verdicts depend on a signature
+// database that is updated over time.
+type Versioned interface {
+	Version(ctx context.Context) (engine, signatures string, err error)
+}
+
+// Options holds what the engines need to be built from configuration.
+type Options struct {
+	ClamAV            *services.ClamAVService
+	HashBlocklistPath string
+}
+
+// New builds the scanner for a comma separated engine list such as
+// "clamav,hashlist". Several engines are combined into a Composite.
+func New(engines string, opts Options) (Scanner, error) {
+	var built []Scanner
+	for _, name := range strings.Split(engines, ",") {
+		switch strings.TrimSpace(name) {
+		case "":
+			continue
+		case "clamav":
+			if opts.ClamAV == nil {
+				return nil, fmt.Errorf("scanner: clamav engine requires a configured ClamAV service")
+			}
+			built = append(built, NewClamAV(opts.ClamAV))
+		case "hashlist":
+			blocklist, err := LoadHashBlocklist(opts.HashBlocklistPath)
+			if err != nil {
+				return nil, err
+			}
+			built = append(built, blocklist)
+		case "fake":
+			built = append(built, &Fake{})
+		default:
+			return nil, fmt.Errorf("scanner: unknown engine %q", name)
+		}
+	}
+
+	switch len(built) {
+	case 0:
+		return nil, fmt.Errorf("scanner: no engines configured")
+	case 1:
+		return built[0], nil
+	default:
+		return NewComposite(built...), nil
+	}
+}
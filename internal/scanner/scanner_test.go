@@ -0,0 +1,206 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+)
+
+func scan(t *testing.T, s Scanner, data []byte) Verdict {
+	t.Helper()
+	return s.Scan(context.Background(), bytes.NewReader(data), int64(len(data)))
+}
+
+func TestFakeDetectsEICAR(t *testing.T) {
+	fake := &Fake{}
+
+	if v := scan(t, fake, []byte("hello world")); v.Status != StatusClean {
+		t.Fatalf("clean content: got %s", v.Status)
+	}
+
+	infected := append([]byte("prefix "), EICAR...)
+	v := scan(t, fake, infected)
+	if v.Status != StatusInfected || len(v.Signatures) != 1 {
+		t.Fatalf("EICAR content: got %+v", v)
+	}
+}
+
+func TestFakeErrorAndSkip(t *testing.T) {
+	if v := scan(t, &Fake{Err: errors.New("boom")}, []byte("x")); v.Status != StatusError || v.Reason != "boom" {
+		t.Fatalf("got %+v", v)
+	}
+	if v := scan(t, &Fake{MaxSize: 2}, []byte("xyz")); v.Status != StatusSkipped || v.Reason != ReasonTooLarge {
+		t.Fatalf("got %+v", v)
+	}
+}
+
+func TestHashBlocklist(t *testing.T) {
+	bad := []byte("known bad payload")
+	sum := sha256.Sum256(bad)
+	blocklist := NewHashBlocklist(map[string]string{strings.ToUpper(hex.EncodeToString(sum[:])): "Known.Bad"})
+
+	if v := scan(t, blocklist, bad); v.Status != StatusInfected || v.Signatures[0] != "Hash.Known.Bad" {
+		t.Fatalf("blocked hash: got %+v", v)
+	}
+	if v := scan(t, blocklist, []byte("something else")); v.Status != StatusClean {
+		t.Fatalf("unknown hash: got %+v", v)
+	}
+}
+
+func TestCompositeMergesVerdicts(t *testing.T) {
+	bad := []byte("blocked")
+	sum := sha256.Sum256(bad)
+	blocklist := NewHashBlocklist(map[string]string{hex.EncodeToString(sum[:]): "Blocked"})
+
+	tests := []struct {
+		name    string
+		engines []Scanner
+		data    []byte
+		want    Status
+	}{
+		{"all clean", []Scanner{&Fake{}, blocklist}, []byte("fine"), StatusClean},
+		{"one infected", []Scanner{&Fake{}, blocklist}, bad, StatusInfected},
+		{"infected beats error", []Scanner{&Fake{Err: errors.New("down")}, &Fake{}}, EICAR, StatusInfected},
+		{"error beats clean", []Scanner{&Fake{Err: errors.New("down")}, &Fake{}}, []byte("fine"), StatusError},
+		{"skipped is not clean", []Scanner{&Fake{MaxSize: 1}, &Fake{}}, []byte("fine"), StatusSkipped},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := scan(t, NewComposite(tt.engines...), tt.data)
+			if v.Status != tt.want {
+				t.Fatalf("got %+v, want %s", v, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompositeStreamsLargeInputToEveryEngine(t *testing.T) {
+	data := bytes.Repeat([]byte("a"), 1<<20)
+	data = append(data, EICAR...)
+
+	// The first engine stops reading immediately; the others must still see everything
+	v := scan(t, NewComposite(&Fake{MaxSize: 1}, &Fake{}, &Fake{}), data)
+	if v.Status != StatusInfected || len(v.Signatures) != 2 {
+		t.Fatalf("got %+v", v)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New("", Options{}); err == nil {
+		t.Fatal("expected error for empty engine list")
+	}
+	if _, err := New("clamav", Options{}); err == nil {
+		t.Fatal("expected error for clamav without a service")
+	}
+	if _, err := New("nope", Options{}); err == nil {
+		t.Fatal("expected error for unknown engine")
+	}
+
+	s, err := New("fake, fake", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.(*Composite); !ok {
+		t.Fatalf("expected composite, got %T", s)
+	}
+}
+
+// fakeClamd answers INSTREAM requests like clamd would, flagging EICAR and
+// enforcing maxLength the way StreamMaxLength does.
+func fakeClamd(t *testing.T, maxLength int) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go handleClamdConn(conn, maxLength)
+		}
+	}()
+	return "tcp://" + ln.Addr().String()
+}
+
+func handleClamdConn(conn net.Conn, maxLength int) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	cmd, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+	if cmd == "zVERSION\x00" {
+		_, _ = conn.Write([]byte("ClamAV 1.0.1/26789/Mon Jan  1 09:00:00 2024\x00"))
+		return
+	}
+	if cmd != "zINSTREAM\x00" {
+		return
+	}
+
+	var data []byte
+	for {
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if size == 0 {
+			break
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return
+		}
+		data = append(data, chunk...)
+		if len(data) > maxLength {
+			_, _ = conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			return
+		}
+	}
+
+	if bytes.Contains(data, EICAR) {
+		_, _ = conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+		return
+	}
+	_, _ = conn.Write([]byte("stream: OK\x00"))
+}
+
+func TestClamAVInstream(t *testing.T) {
+	address := fakeClamd(t, 1<<20)
+
+	// Our own limit is higher than clamd's so clamd's reply is exercised too
+	if err := services.InitializeClamAV(address, 4<<20); err != nil {
+		t.Fatal(err)
+	}
+	clamav := NewClamAV(services.GetClamAVService())
+
+	if v := scan(t, clamav, bytes.Repeat([]byte("b"), 200<<10)); v.Status != StatusClean {
+		t.Fatalf("clean stream: got %+v", v)
+	}
+	if v := scan(t, clamav, EICAR); v.Status != StatusInfected || v.Signatures[0] != "Eicar-Test-Signature" || v.SignatureVersion != "26789" {
+		t.Fatalf("EICAR stream: got %+v", v)
+	}
+	if v := scan(t, clamav, bytes.Repeat([]byte("c"), 2<<20)); v.Status != StatusSkipped || v.Reason != ReasonTooLarge {
+		t.Fatalf("over clamd limit: got %+v", v)
+	}
+	if v := scan(t, clamav, bytes.Repeat([]byte("d"), 5<<20)); v.Status != StatusSkipped || v.Reason != ReasonTooLarge {
+		t.Fatalf("over our limit: got %+v", v)
+	}
+}
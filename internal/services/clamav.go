@@ -0,0 +1,184 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	clamAVChunkSize   = 64 << 10
+	clamAVDialTimeout = 5 * time.Second
+)
+
+// ErrStreamTooLarge is returned when an object exceeds clamd's StreamMaxLength.
+// Such objects were not (fully) scanned and must not be treated as clean.
+var ErrStreamTooLarge = errors.New("clamav: stream exceeds StreamMaxLength")
+
+type ClamAVService struct {
+	Network         string
+	Address         string
+	StreamMaxLength int64
+}
+
+// ClamAVResult is the parsed reply of a clamd scan.
+type ClamAVResult struct {
+	Infected  bool
+	Signature string
+	Raw       string
+}
+
+var clamAVInstance *ClamAVService
+
+// InitializeClamAV configures the clamd client. The address is either
+// tcp://host:port or unix:///path/to/clamd.sock. streamMaxLength must match
+// (or be lower than) StreamMaxLength in clamd.conf.
+func InitializeClamAV(address string, streamMaxLength int64) error {
+	u, err := url.Parse(address)
+	if err != nil {
+		return fmt.Errorf("invalid clamav address: %v", err)
+	}
+
+	svc := &ClamAVService{StreamMaxLength: streamMaxLength}
+	switch u.Scheme {
+	case "tcp":
+		svc.Network, svc.Address = "tcp", u.Host
+	case "unix":
+		svc.Network, svc.Address = "unix", u.Path
+	default:
+		return fmt.Errorf("unsupported clamav address scheme %q", u.Scheme)
+	}
+
+	clamAVInstance = svc
+	log.Printf("[ClamAV] configured %s://%s (StreamMaxLength=%d)", svc.Network, svc.Address, streamMaxLength)
+	return nil
+}
+
+func GetClamAVService() *ClamAVService {
+	return clamAVInstance
+}
+
+// ScanStream sends r to clamd using the INSTREAM protocol: a "zINSTREAM"
+// command followed by <uint32 length><data> chunks and a zero-length chunk.
+// It stops sending and returns ErrStreamTooLarge once StreamMaxLength would be
+// exceeded, or when clamd reports the limit itself.
+func (s *ClamAVService) ScanStream(ctx context.Context, r io.Reader) (ClamAVResult, error) {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return ClamAVResult{}, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return ClamAVResult{}, fmt.Errorf("clamav: send INSTREAM: %w", err)
+	}
+
+	buf := make([]byte, 4+clamAVChunkSize)
+	var sent int64
+	for {
+		n, readErr := r.Read(buf[4:])
+		if n > 0 {
+			if s.StreamMaxLength > 0 && sent+int64(n) > s.StreamMaxLength {
+				return ClamAVResult{}, ErrStreamTooLarge
+			}
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				// clamd closes the socket when its own limit is hit; its reply tells us why
+				if res, rerr := readClamAVReply(conn); res.Raw != "" {
+					return res, rerr
+				}
+				return ClamAVResult{}, fmt.Errorf("clamav: send chunk: %w", err)
+			}
+			sent += int64(n)
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return ClamAVResult{}, fmt.Errorf("clamav: read source: %w", readErr)
+		}
+	}
+
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return ClamAVResult{}, fmt.Errorf("clamav: send terminator: %w", err)
+	}
+
+	return readClamAVReply(conn)
+}
+
+// Version asks clamd for its VERSION, e.g. "ClamAV 1.0.1/26789/Mon Jan  1 09:00:00 2024",
+// and returns the engine version and the signature database version.
+func (s *ClamAVService) Version(ctx context.Context) (engine, signatures string, err error) {
+	reply, err := s.command(ctx, "VERSION")
+	if err != nil {
+		return "", "", err
+	}
+
+	parts := strings.SplitN(reply, "/", 3)
+	engine = strings.TrimSpace(parts[0])
+	if len(parts) > 1 {
+		signatures = strings.TrimSpace(parts[1])
+	}
+	return engine, signatures, nil
+}
+
+func (s *ClamAVService) command(ctx context.Context, cmd string) (string, error) {
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("z" + cmd + "\x00")); err != nil {
+		return "", fmt.Errorf("clamav: send %s: %w", cmd, err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return "", fmt.Errorf("clamav: read %s reply: %w", cmd, err)
+	}
+	return strings.TrimRight(reply, "\x00\r\n "), nil
+}
+
+func (s *ClamAVService) dial(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: clamAVDialTimeout}
+	conn, err := dialer.DialContext(ctx, s.Network, s.Address)
+	if err != nil {
+		return nil, fmt.Errorf("clamav: connect: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+// readClamAVReply parses replies such as "stream: OK",
+// "stream: Eicar-Signature FOUND" and "INSTREAM size limit exceeded. ERROR".
+func readClamAVReply(conn net.Conn) (ClamAVResult, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return ClamAVResult{}, fmt.Errorf("clamav: read reply: %w", err)
+	}
+	reply = strings.TrimRight(reply, "\x00\r\n ")
+	res := ClamAVResult{Raw: reply}
+
+	switch {
+	case strings.Contains(reply, "size limit exceeded"):
+		return res, ErrStreamTooLarge
+	case strings.HasSuffix(reply, " FOUND"):
+		res.Infected = true
+		res.Signature = strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), " FOUND")
+		return res, nil
+	case strings.HasSuffix(reply, " OK"):
+		return res, nil
+	default:
+		return res, fmt.Errorf("clamav: scan error: %s", reply)
+	}
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// clamdSession is what the fake clamd received on one connection
+type clamdSession struct {
+	command    string
+	chunks     []int
+	data       []byte
+	terminated bool
+}
+
+// fakeClamd answers every INSTREAM with reply once the stream is terminated,
+// or as soon as more than maxLength bytes arrived when maxLength > 0
+func fakeClamd(t *testing.T, reply string, maxLength int) (*ClamAVService, <-chan clamdSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	sessions := make(chan clamdSession, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var session clamdSession
+		defer func() { sessions <- session }()
+		r := bufio.NewReader(conn)
+		if session.command, err = r.ReadString(0); err != nil {
+			return
+		}
+		for {
+			var size uint32
+			if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				session.terminated = true
+				break
+			}
+			chunk := make([]byte, size)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return
+			}
+			session.chunks = append(session.chunks, int(size))
+			session.data = append(session.data, chunk...)
+			if maxLength > 0 && len(session.data) > maxLength {
+				break
+			}
+		}
+		_, _ = conn.Write([]byte(reply + "\x00"))
+	}()
+
+	return &ClamAVService{Network: "tcp", Address: ln.Addr().String()}, sessions
+}
+
+func TestClamAVScanStream(t *testing.T) {
+	tests := []struct {
+		name      string
+		reply     string
+		maxLength int
+		size      int
+		infected  bool
+		signature string
+		wantErr   string
+	}{
+		{name: "clean", reply: "stream: OK", size: 150 << 10},
+		{name: "empty", reply: "stream: OK", size: 0},
+		{name: "found", reply: "stream: Eicar-Test-Signature FOUND", size: 68, infected: true, signature: "Eicar-Test-Signature"},
+		{name: "error", reply: "stream: Can't allocate memory ERROR", size: 10, wantErr: "scan error: stream: Can't allocate memory ERROR"},
+		{name: "size limit after the stream", reply: "INSTREAM size limit exceeded. ERROR", size: 10},
+		{name: "size limit mid-stream", reply: "INSTREAM size limit exceeded. ERROR", maxLength: 100 << 10, size: 1 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clamav, sessions := fakeClamd(t, tt.reply, tt.maxLength)
+			content := bytes.Repeat([]byte("x"), tt.size)
+
+			res, err := clamav.ScanStream(context.Background(), bytes.NewReader(content))
+			session := <-sessions
+			if session.command != "zINSTREAM\x00" {
+				t.Fatalf("command %q", session.command)
+			}
+
+			if strings.Contains(tt.reply, "size limit exceeded") {
+				if !errors.Is(err, ErrStreamTooLarge) {
+					t.Fatalf("want ErrStreamTooLarge, got %+v, %v", res, err)
+				}
+				return
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("want %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Infected != tt.infected || res.Signature != tt.signature || res.Raw != tt.reply {
+				t.Fatalf("result %+v", res)
+			}
+
+			if !session.terminated {
+				t.Fatal("stream not terminated by a zero-length chunk")
+			}
+			if !bytes.Equal(session.data, content) {
+				t.Fatalf("clamd received %d bytes, sent %d", len(session.data), len(content))
+			}
+			for _, size := range session.chunks {
+				if size > clamAVChunkSize {
+					t.Fatalf("chunk of %d bytes exceeds %d", size, clamAVChunkSize)
+				}
+			}
+			if want := (tt.size + clamAVChunkSize - 1) / clamAVChunkSize; len(session.chunks) != want {
+				t.Fatalf("%d chunks, want %d", len(session.chunks), want)
+			}
+		})
+	}
+}
+
+func TestClamAVScanStreamStopsAtStreamMaxLength(t *testing.T) {
+	clamav, sessions := fakeClamd(t, "stream: OK", 0)
+	clamav.StreamMaxLength = 100 << 10
+
+	_, err := clamav.ScanStream(context.Background(), bytes.NewReader(make([]byte, 200<<10)))
+	if !errors.Is(err, ErrStreamTooLarge) {
+		t.Fatalf("want ErrStreamTooLarge, got %v", err)
+	}
+	if session := <-sessions; len(session.data) > 100<<10 || session.terminated {
+		t.Fatalf("sent %d bytes past the limit, terminated %t", len(session.data), session.terminated)
+	}
+}
@@ -1,13 +1,16 @@
 package command
 
 import (
+	"context"
 	"time"
 
 	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
 	"github.com/File-Sharing-BondBridg/File-Service/internal/services/infrastructure"
 )
 
-func SaveFileMetadata(metadata models.FileMetadata) error {
+// SaveFileMetadata stores the file row; events are written to the shard's
+// outbox in the same transaction and published by the outbox relay
+func SaveFileMetadata(metadata models.FileMetadata, events ...models.OutboxMessage) error {
 	// Default implementation
 	//if postgresInstance == nil {
 	//	return fmt.Errorf("postgres storage not initialized")
@@ -16,23 +19,62 @@ func SaveFileMetadata(metadata models.FileMetadata) error {
 
 	// Sharding implementation
 	pg := infrastructure.GetPostgresForUser(metadata.UserID)
-	_ = pg.IncrementUserFileStats(metadata.UserID)
-	return pg.SaveFileMetadata(metadata)
+	return pg.SaveFileMetadata(metadata, events...)
 }
 
-func DeleteFileMetadata(fileID, userID string) bool {
+// DeleteFileMetadata deletes the file row and reports whether it existed
+func DeleteFileMetadata(fileID, userID string, events ...models.OutboxMessage) (bool, error) {
 	pg := infrastructure.GetPostgresForUser(userID)
-	_ = pg.DecrementUserFileStats(userID)
-	return pg.DeleteFileMetadata(fileID, userID)
+	return pg.DeleteFileMetadata(fileID, userID, events...)
 }
 
-func UpdateFileScanStatus(fileID, userID, status string, now time.Time) error {
+func UpdateFileScanStatus(ctx context.Context, fileID, userID string, result models.ScanResult) error {
 	pg := infrastructure.GetPostgresForUser(userID)
-	return pg.UpdateFileScanStatus(fileID, status, now)
+	return pg.UpdateFileScanStatus(ctx, fileID, result)
 }
 
-func DeleteAllFilesForUser(userID string) int {
+// DeleteUserFilesBatch deletes up to limit file rows of a user; events builds
+// the outbox messages describing the deleted rows
+func DeleteUserFilesBatch(ctx context.Context, userID string, limit int, events func(deleted []models.FileMetadata) ([]models.OutboxMessage, error)) (int, error) {
 	pg := infrastructure.GetPostgresForUser(userID)
-	_ = pg.DeleteUserFileStats(userID)
-	return pg.DeleteAllFilesForUser(userID)
+	return pg.DeleteUserFilesBatch(ctx, userID, limit, events)
+}
+
+func QuarantineFile(ctx context.Context, fileID, userID, bucket string, result models.ScanResult) error {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.QuarantineFile(ctx, fileID, bucket, result)
+}
+
+func ReleaseQuarantinedFile(fileID, userID, bucket string, events ...models.OutboxMessage) bool {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.ReleaseQuarantinedFile(fileID, bucket, events...)
+}
+
+func SetScanOverride(fileID, userID string, allow bool, adminID string, events ...models.OutboxMessage) bool {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.SetScanOverride(fileID, allow, adminID, events...)
+}
+
+func RecordScanFailure(ctx context.Context, fileID, userID, reason string, final bool) error {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.RecordScanFailure(ctx, fileID, reason, final)
+}
+
+func MarkScanRequeued(fileID, userID string) error {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.MarkScanRequeued(fileID)
+}
+
+// ClaimFilesForRescan claims up to limit files per shard whose clean verdict
+// predates signatureVersion
+func ClaimFilesForRescan(signatureVersion string, recentSince, atRiskSince time.Time, atRiskExtensions []string, limit int) ([]models.FileMetadata, error) {
+	var files []models.FileMetadata
+	for _, pg := range infrastructure.GetAllShards() {
+		shardFiles, err := pg.ClaimFilesForRescan(signatureVersion, recentSince, atRiskSince, atRiskExtensions, limit)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, shardFiles...)
+	}
+	return files, nil
 }
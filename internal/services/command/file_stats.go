@@ -0,0 +1,25 @@
+package command
+
+import (
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/infrastructure"
+)
+
+// RepairFileStats recounts the files of users on a shard and corrects their
+// stored counts
+func RepairFileStats(shard int, userIDs []string) ([]models.FileStatsDrift, error) {
+	pg, err := infrastructure.GetShard(shard)
+	if err != nil {
+		return nil, err
+	}
+	return pg.RepairFileStats(userIDs)
+}
+
+// SetFileStats stores file counts of users on a shard
+func SetFileStats(shard int, counts map[string]int) ([]models.FileStatsDrift, error) {
+	pg, err := infrastructure.GetShard(shard)
+	if err != nil {
+		return nil, err
+	}
+	return pg.SetFileStats(counts)
+}
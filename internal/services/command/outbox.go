@@ -0,0 +1,34 @@
+package command
+
+import (
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/infrastructure"
+)
+
+// RelayOutbox publishes up to limit due outbox messages per shard
+func RelayOutbox(limit int, publish func(models.OutboxMessage) error, backoff func(attempts int) time.Duration) (published, failed int, err error) {
+	for _, pg := range infrastructure.GetAllShards() {
+		p, f, err := pg.RelayOutbox(limit, publish, backoff)
+		published += p
+		failed += f
+		if err != nil {
+			return published, failed, err
+		}
+	}
+	return published, failed, nil
+}
+
+// PurgePublishedOutbox deletes messages published before the given time on every shard
+func PurgePublishedOutbox(before time.Time) (int64, error) {
+	var total int64
+	for _, pg := range infrastructure.GetAllShards() {
+		n, err := pg.PurgePublishedOutbox(before)
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
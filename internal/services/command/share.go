@@ -0,0 +1,22 @@
+package command
+
+import (
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/infrastructure"
+)
+
+func CreateShare(share models.Share) error {
+	pg := infrastructure.GetPostgresForUser(share.UserID)
+	return pg.CreateShare(share)
+}
+
+func RevokeShare(shareID, userID string) bool {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.RevokeShare(shareID, userID)
+}
+
+// RecordShareAccess stores the access on the shard of the share owner
+func RecordShareAccess(ownerID string, access models.ShareAccess) error {
+	pg := infrastructure.GetPostgresForUser(ownerID)
+	return pg.RecordShareAccess(access)
+}
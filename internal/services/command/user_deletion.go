@@ -0,0 +1,69 @@
+package command
+
+import (
+	"context"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/infrastructure"
+)
+
+// StartUserDeletion records the deletion job of a user; an existing job is
+// returned as is
+func StartUserDeletion(ctx context.Context, userID string) (models.UserDeletion, error) {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.StartUserDeletion(ctx, userID)
+}
+
+func ClaimUserDeletion(ctx context.Context, userID string, lease time.Duration) (models.UserDeletion, bool, error) {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.ClaimUserDeletion(ctx, userID, lease)
+}
+
+// ClaimDueUserDeletions leases up to limit resumable jobs per shard
+func ClaimDueUserDeletions(ctx context.Context, limit int, lease time.Duration) ([]models.UserDeletion, error) {
+	var jobs []models.UserDeletion
+	for _, pg := range infrastructure.GetAllShards() {
+		claimed, err := pg.ClaimDueUserDeletions(ctx, limit, lease)
+		if err != nil {
+			return jobs, err
+		}
+		jobs = append(jobs, claimed...)
+	}
+	return jobs, nil
+}
+
+func CheckpointUserDeletion(ctx context.Context, job models.UserDeletion, lease time.Duration) error {
+	pg := infrastructure.GetPostgresForUser(job.UserID)
+	return pg.CheckpointUserDeletion(ctx, job, lease)
+}
+
+func FailUserDeletion(ctx context.Context, userID, reason string, retryAt time.Time) error {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.FailUserDeletion(ctx, userID, reason, retryAt)
+}
+
+func ReleaseUserDeletion(ctx context.Context, userID string) error {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.ReleaseUserDeletion(ctx, userID)
+}
+
+func CompleteUserDeletion(ctx context.Context, userID string, events ...models.OutboxMessage) error {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.CompleteUserDeletion(ctx, userID, events...)
+}
+
+func RevokeAllSharesForUser(ctx context.Context, userID string) (int64, error) {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.RevokeAllSharesForUser(ctx, userID)
+}
+
+func DeleteSharesForUser(ctx context.Context, userID string) error {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.DeleteSharesForUser(ctx, userID)
+}
+
+func DeleteUserFileStats(ctx context.Context, userID string) error {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.DeleteUserFileStats(ctx, userID)
+}
@@ -0,0 +1,89 @@
+package command
+
+import (
+	"context"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/infrastructure"
+)
+
+func CreateWebhookSubscription(sub models.WebhookSubscription) error {
+	pg := infrastructure.GetPostgresForUser(sub.ShardKey())
+	return pg.CreateWebhookSubscription(sub)
+}
+
+func UpdateWebhookSubscription(sub models.WebhookSubscription, enable bool) error {
+	pg := infrastructure.GetPostgresForUser(sub.ShardKey())
+	return pg.UpdateWebhookSubscription(sub, enable)
+}
+
+func DeleteWebhookSubscription(sub models.WebhookSubscription) error {
+	pg := infrastructure.GetPostgresForUser(sub.ShardKey())
+	return pg.DeleteWebhookSubscription(sub.ID)
+}
+
+// DeleteWebhooksForUser removes a deleted user's subscriptions and memberships
+func DeleteWebhooksForUser(ctx context.Context, userID string) error {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.DeleteWebhooksForUser(ctx, userID)
+}
+
+// EnqueueWebhookDeliveries stores deliveries on the shard of their subscription
+func EnqueueWebhookDeliveries(sub models.WebhookSubscription, deliveries []models.WebhookDelivery) error {
+	pg := infrastructure.GetPostgresForUser(sub.ShardKey())
+	return pg.EnqueueWebhookDeliveries(deliveries)
+}
+
+// LogWebhookDelivery stores a delivery that was sent outside the dispatcher
+func LogWebhookDelivery(sub models.WebhookSubscription, delivery models.WebhookDelivery) error {
+	pg := infrastructure.GetPostgresForUser(sub.ShardKey())
+	return pg.InsertWebhookDelivery(delivery)
+}
+
+// DispatchWebhooks claims up to limit due deliveries per shard, sends them
+// with send and records the attempts. It returns the attempts made and the
+// subscriptions disabled on the way.
+func DispatchWebhooks(limit int, lease time.Duration, disableAfter int, send func([]models.WebhookDelivery) []models.WebhookAttempt) (sent int, disabled []string, err error) {
+	for _, pg := range infrastructure.GetAllShards() {
+		deliveries, err := pg.ClaimWebhookDeliveries(limit, lease)
+		if err != nil {
+			return sent, disabled, err
+		}
+		if len(deliveries) == 0 {
+			continue
+		}
+
+		attempts := send(deliveries)
+		for i, d := range deliveries {
+			off, err := pg.RecordWebhookAttempt(d, attempts[i], disableAfter)
+			if err != nil {
+				return sent, disabled, err
+			}
+			sent++
+			if off {
+				disabled = append(disabled, d.SubscriptionID)
+			}
+		}
+	}
+	return sent, disabled, nil
+}
+
+// PurgeWebhookDeliveries deletes finished deliveries created before the given time on every shard
+func PurgeWebhookDeliveries(before time.Time) (int64, error) {
+	var total int64
+	for _, pg := range infrastructure.GetAllShards() {
+		n, err := pg.PurgeWebhookDeliveries(before)
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// SetOrganizationMemberships records the organizations a user belongs to
+func SetOrganizationMemberships(userID string, organizations []string) error {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.SetOrganizationMemberships(userID, organizations)
+}
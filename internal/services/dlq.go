@@ -0,0 +1,395 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/metrics"
+	"github.com/nats-io/nats.go"
+)
+
+// DeadLetterStream keeps messages a consumer gave up on, under
+// "dlq.<original subject>", until they are replayed or discarded.
+const DeadLetterStream = "file-events-dlq"
+
+const deadLetterPrefix = "dlq."
+
+// DeadLetterReplayStream holds replayed dead letters under
+// "replay.<consumer>.<original subject>" until that consumer handled them.
+// Every consumer that can dead-letter also reads its own replay subjects,
+// under the same durable name, so a replay reaches only the consumer that
+// gave up.
+const DeadLetterReplayStream = "file-events-replay"
+
+const replayPrefix = "replay."
+
+// Headers added to dead-lettered messages. The original headers are kept,
+// except Nats-Msg-Id which moves to HeaderDLQMsgID.
+const (
+	HeaderDLQSubject    = "Dlq-Original-Subject"
+	HeaderDLQSequence   = "Dlq-Original-Sequence"
+	HeaderDLQMsgID      = "Dlq-Original-Msg-Id"
+	HeaderDLQConsumer   = "Dlq-Consumer"
+	HeaderDLQReason     = "Dlq-Reason"
+	HeaderDLQDeliveries = "Dlq-Deliveries"
+	HeaderDLQFailedAt   = "Dlq-Failed-At"
+	HeaderDLQEditedAt   = "Dlq-Edited-At"
+)
+
+// ErrDeadLetterNotFound is returned for a sequence that is not in the DLQ
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// EnsureDeadLetterStream creates the DLQ and replay streams or updates their
+// retention
+func EnsureDeadLetterStream(maxAge time.Duration) error {
+	if js == nil {
+		return errors.New("jetstream not initialized")
+	}
+
+	if err := ensureRetention(&nats.StreamConfig{
+		Name:     DeadLetterStream,
+		Subjects: []string{deadLetterPrefix + ">"},
+		Storage:  nats.FileStorage,
+		MaxAge:   maxAge,
+	}); err != nil {
+		return err
+	}
+	// A replay nobody picks up expires like a dead letter
+	return ensureRetention(&nats.StreamConfig{
+		Name:      DeadLetterReplayStream,
+		Subjects:  []string{replayPrefix + ">"},
+		Retention: nats.WorkQueuePolicy,
+		Storage:   nats.FileStorage,
+		MaxAge:    maxAge,
+	})
+}
+
+func ensureRetention(cfg *nats.StreamConfig) error {
+	info, err := js.StreamInfo(cfg.Name)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(cfg)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if info.Config.MaxAge == cfg.MaxAge {
+		return nil
+	}
+	updated := info.Config
+	updated.MaxAge = cfg.MaxAge
+	_, err = js.UpdateStream(&updated)
+	return err
+}
+
+// ReplayFilter is the subject filter of the replay consumer of durable
+func ReplayFilter(durable string) string {
+	return replayPrefix + durable + ".>"
+}
+
+// OriginalSubject is the subject msg was first published on; replayed dead
+// letters arrive on a replay subject
+func OriginalSubject(msg *nats.Msg) string {
+	rest, ok := strings.CutPrefix(msg.Subject, replayPrefix)
+	if !ok {
+		return msg.Subject
+	}
+	// Durable names cannot contain dots
+	if _, subject, ok := strings.Cut(rest, "."); ok {
+		return subject
+	}
+	return msg.Subject
+}
+
+// EnsureReplayConsumer creates the pull consumer that reads the replayed dead
+// letters of durable, or applies the limits to an existing one
+func EnsureReplayConsumer(durable string, maxDeliver int, ackWait time.Duration) error {
+	if js == nil {
+		return errors.New("jetstream not initialized")
+	}
+	_, err := js.ConsumerInfo(DeadLetterReplayStream, durable)
+	if err == nil {
+		return UpdateConsumerLimits(durable, maxDeliver, ackWait)
+	}
+	if !errors.Is(err, nats.ErrConsumerNotFound) {
+		return err
+	}
+	_, err = js.AddConsumer(DeadLetterReplayStream, &nats.ConsumerConfig{
+		Durable:       durable,
+		FilterSubject: ReplayFilter(durable),
+		AckPolicy:     nats.AckExplicitPolicy,
+		MaxDeliver:    maxDeliver,
+		AckWait:       ackWait,
+	})
+	if errors.Is(err, nats.ErrConsumerNameAlreadyInUse) {
+		return nil
+	}
+	return err
+}
+
+// PullSubscribeReplays binds to the replay consumer of durable
+func PullSubscribeReplays(durable string) (*nats.Subscription, error) {
+	if js == nil {
+		return nil, errors.New("jetstream not initialized")
+	}
+	return js.PullSubscribe(ReplayFilter(durable), durable, nats.Bind(DeadLetterReplayStream, durable))
+}
+
+// maxDeliver caches the MaxDeliver of each consumer, keyed by stream/durable
+var maxDeliver sync.Map
+
+func consumerMaxDeliver(stream, consumer string) int {
+	key := stream + "/" + consumer
+	if v, ok := maxDeliver.Load(key); ok {
+		return v.(int)
+	}
+	info, err := js.ConsumerInfo(stream, consumer)
+	if err != nil {
+		log.Printf("[DLQ] consumer info of %s: %v", key, err)
+		return -1
+	}
+	maxDeliver.Store(key, info.Config.MaxDeliver)
+	return info.Config.MaxDeliver
+}
+
+// IsLastDelivery reports whether JetStream will not redeliver msg after a nak
+func IsLastDelivery(msg *nats.Msg) bool {
+	meta, err := msg.Metadata()
+	if err != nil {
+		return false
+	}
+	limit := consumerMaxDeliver(meta.Stream, meta.Consumer)
+	return limit > 0 && meta.NumDelivered >= uint64(limit)
+}
+
+// RetryOrDeadLetter naks msg for redelivery after delay, or moves it to the
+// DLQ when this was its last delivery.
+func RetryOrDeadLetter(msg *nats.Msg, reason string, delay time.Duration) {
+	if IsLastDelivery(msg) {
+		if err := DeadLetter(msg, reason); err == nil {
+			return
+		}
+	}
+	var err error
+	if delay > 0 {
+		err = msg.NakWithDelay(delay)
+	} else {
+		err = msg.Nak()
+	}
+	if err != nil {
+		log.Printf("[DLQ] nak failed: %v", err)
+	}
+}
+
+// DeadLetter copies msg to the DLQ with the failure reason and terminates
+// it. When the copy fails msg is nacked instead, so it is not lost.
+func DeadLetter(msg *nats.Msg, reason string) error {
+	err := publishDeadLetter(msg, reason)
+	if err != nil {
+		log.Printf("[DLQ] failed to dead-letter %s: %v", msg.Subject, err)
+		if nerr := msg.Nak(); nerr != nil {
+			log.Printf("[DLQ] nak failed: %v", nerr)
+		}
+		return err
+	}
+	if terr := msg.Term(); terr != nil {
+		log.Printf("[DLQ] term failed: %v", terr)
+	}
+	return nil
+}
+
+func publishDeadLetter(msg *nats.Msg, reason string) error {
+	if js == nil {
+		return errors.New("jetstream not initialized")
+	}
+	meta, err := msg.Metadata()
+	if err != nil {
+		return err
+	}
+
+	subject := OriginalSubject(msg)
+	out := nats.NewMsg(deadLetterPrefix + subject)
+	out.Data = msg.Data
+	for key, values := range msg.Header {
+		if key == nats.MsgIdHdr {
+			continue
+		}
+		out.Header[key] = values
+	}
+	if id := msg.Header.Get(nats.MsgIdHdr); id != "" {
+		out.Header.Set(HeaderDLQMsgID, id)
+	}
+	out.Header.Set(HeaderDLQSubject, subject)
+	out.Header.Set(HeaderDLQSequence, strconv.FormatUint(meta.Sequence.Stream, 10))
+	out.Header.Set(HeaderDLQConsumer, meta.Consumer)
+	out.Header.Set(HeaderDLQReason, reason)
+	out.Header.Set(HeaderDLQDeliveries, strconv.FormatUint(meta.NumDelivered, 10))
+	out.Header.Set(HeaderDLQFailedAt, time.Now().UTC().Format(time.RFC3339))
+	// A message dead-lettered twice by the same consumer is stored once
+	out.Header.Set(nats.MsgIdHdr, fmt.Sprintf("%s:%s:%d", meta.Stream, meta.Consumer, meta.Sequence.Stream))
+
+	if _, err := js.PublishMsg(out); err != nil {
+		return err
+	}
+	metrics.Count("dlq.dead_lettered", 1, "consumer:"+meta.Consumer, "subject:"+subject)
+	log.Printf("[DLQ] %s moved %s #%d after %d deliveries: %s", meta.Consumer, subject, meta.Sequence.Stream, meta.NumDelivered, reason)
+	return nil
+}
+
+// DeadLetterEntry is a message in the DLQ. Data is set when the payload is
+// JSON, DataBase64 otherwise.
+type DeadLetterEntry struct {
+	Sequence   uint64              `json:"sequence"`
+	Subject    string              `json:"subject"`
+	Consumer   string              `json:"consumer"`
+	Reason     string              `json:"reason"`
+	Deliveries int                 `json:"deliveries"`
+	FailedAt   time.Time           `json:"failed_at"`
+	StoredAt   time.Time           `json:"stored_at"`
+	Headers    map[string][]string `json:"headers"`
+	Data       json.RawMessage     `json:"data,omitempty"`
+	DataBase64 []byte              `json:"data_base64,omitempty"`
+}
+
+func newDeadLetterEntry(raw *nats.RawStreamMsg) DeadLetterEntry {
+	entry := DeadLetterEntry{
+		Sequence: raw.Sequence,
+		Subject:  raw.Header.Get(HeaderDLQSubject),
+		Consumer: raw.Header.Get(HeaderDLQConsumer),
+		Reason:   raw.Header.Get(HeaderDLQReason),
+		StoredAt: raw.Time,
+		Headers:  raw.Header,
+	}
+	if entry.Subject == "" {
+		entry.Subject = strings.TrimPrefix(raw.Subject, deadLetterPrefix)
+	}
+	entry.Deliveries, _ = strconv.Atoi(raw.Header.Get(HeaderDLQDeliveries))
+	entry.FailedAt, _ = time.Parse(time.RFC3339, raw.Header.Get(HeaderDLQFailedAt))
+	if json.Valid(raw.Data) {
+		entry.Data = raw.Data
+	} else {
+		entry.DataBase64 = raw.Data
+	}
+	return entry
+}
+
+// ListDeadLetters returns up to limit entries stored after sequence after,
+// and the number of entries in the DLQ
+func ListDeadLetters(after uint64, limit int) ([]DeadLetterEntry, uint64, error) {
+	if js == nil {
+		return nil, 0, errors.New("jetstream not initialized")
+	}
+	info, err := js.StreamInfo(DeadLetterStream)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries := []DeadLetterEntry{}
+	seq := max(after+1, info.State.FirstSeq)
+	for ; seq <= info.State.LastSeq && len(entries) < limit; seq++ {
+		raw, err := js.GetMsg(DeadLetterStream, seq)
+		if errors.Is(err, nats.ErrMsgNotFound) {
+			continue // replayed or discarded
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, newDeadLetterEntry(raw))
+	}
+	return entries, info.State.Msgs, nil
+}
+
+// GetDeadLetter returns the DLQ entry stored at seq
+func GetDeadLetter(seq uint64) (DeadLetterEntry, error) {
+	raw, err := getDeadLetter(seq)
+	if err != nil {
+		return DeadLetterEntry{}, err
+	}
+	return newDeadLetterEntry(raw), nil
+}
+
+func getDeadLetter(seq uint64) (*nats.RawStreamMsg, error) {
+	if js == nil {
+		return nil, errors.New("jetstream not initialized")
+	}
+	raw, err := js.GetMsg(DeadLetterStream, seq)
+	if errors.Is(err, nats.ErrMsgNotFound) {
+		return nil, ErrDeadLetterNotFound
+	}
+	return raw, err
+}
+
+// EditDeadLetter replaces the payload of an entry, e.g. to fix a malformed
+// event before replaying it. The edited copy gets a new sequence.
+func EditDeadLetter(seq uint64, data []byte) (DeadLetterEntry, error) {
+	raw, err := getDeadLetter(seq)
+	if err != nil {
+		return DeadLetterEntry{}, err
+	}
+
+	out := nats.NewMsg(raw.Subject)
+	out.Data = data
+	for key, values := range raw.Header {
+		out.Header[key] = values
+	}
+	out.Header.Set(HeaderDLQEditedAt, time.Now().UTC().Format(time.RFC3339))
+	out.Header.Del(nats.MsgIdHdr)
+
+	ack, err := js.PublishMsg(out)
+	if err != nil {
+		return DeadLetterEntry{}, err
+	}
+	if err := js.DeleteMsg(DeadLetterStream, seq); err != nil {
+		return DeadLetterEntry{}, err
+	}
+	return GetDeadLetter(ack.Sequence)
+}
+
+// ReplayDeadLetter hands an entry back to the consumer that gave up on it
+// and removes it from the DLQ. Other consumers of the original subject do
+// not see it again.
+func ReplayDeadLetter(seq uint64) error {
+	raw, err := getDeadLetter(seq)
+	if err != nil {
+		return err
+	}
+	consumer := raw.Header.Get(HeaderDLQConsumer)
+	if consumer == "" {
+		return fmt.Errorf("dead letter %d names no consumer to replay it to", seq)
+	}
+
+	subject := raw.Header.Get(HeaderDLQSubject)
+	if subject == "" {
+		subject = strings.TrimPrefix(raw.Subject, deadLetterPrefix)
+	}
+	out := nats.NewMsg(replayPrefix + consumer + "." + subject)
+	out.Data = raw.Data
+	for key, values := range raw.Header {
+		if strings.HasPrefix(key, "Dlq-") || key == nats.MsgIdHdr {
+			continue
+		}
+		out.Header[key] = values
+	}
+	// Replaying the same entry twice within the duplicate window publishes once
+	out.Header.Set(nats.MsgIdHdr, fmt.Sprintf("dlq-replay:%d", seq))
+
+	if _, err := js.PublishMsg(out); err != nil {
+		return err
+	}
+	metrics.Count("dlq.replayed", 1, "consumer:"+consumer, "subject:"+subject)
+	return js.DeleteMsg(DeadLetterStream, seq)
+}
+
+// DiscardDeadLetter removes an entry from the DLQ
+func DiscardDeadLetter(seq uint64) error {
+	if _, err := getDeadLetter(seq); err != nil {
+		return err
+	}
+	return js.DeleteMsg(DeadLetterStream, seq)
+}
@@ -16,6 +16,7 @@ type PostgresStorage struct {
 
 var postgresShards map[int]*PostgresStorage
 var postgresShardCount int
+var postgresResolver Resolver
 
 // Connect establishes connection to PostgreSQL
 func (p *PostgresStorage) Connect(connectionString string) error {
@@ -48,15 +49,25 @@ func (p *PostgresStorage) Connect(connectionString string) error {
 	return nil
 }
 
-func InitializePostgresShards(connections []string) error {
+// InitializePostgresShards connects the shards, indexed by shard ID, and
+// checks each against the topology recorded in its database. resolver routes
+// users to the shards.
+func InitializePostgresShards(connections []string, resolver Resolver) error {
+	if resolver.Shards() != len(connections) {
+		return fmt.Errorf("resolver %s covers %d shards, %d configured", resolver, resolver.Shards(), len(connections))
+	}
 	postgresShards = make(map[int]*PostgresStorage)
 	postgresShardCount = len(connections)
+	postgresResolver = resolver
 
 	for i, conn := range connections {
 		pg := &PostgresStorage{}
 		if err := pg.Connect(conn); err != nil {
 			return fmt.Errorf("failed to connect shard %d: %w", i, err)
 		}
+		if err := pg.CheckTopology(ShardTopology{ShardID: i, ShardCount: len(connections), Resolver: resolver.String()}); err != nil {
+			return fmt.Errorf("shard %d: %w", i, err)
+		}
 		postgresShards[i] = pg
 	}
 
@@ -76,7 +87,38 @@ func GetStats() map[string]interface{} {
 }
 
 func GetPostgresForUser(userID string) *PostgresStorage {
-	shard := ResolveShard(userID, postgresShardCount)
+	shard := postgresResolver.Resolve(userID)
 	log.Printf("[DB] user=%s → shard=%d", userID, shard)
 	return postgresShards[shard]
 }
+
+// GetAllShards returns every configured shard ordered by shard index.
+// Use it for lookups that cannot be routed by user ID.
+func GetAllShards() []*PostgresStorage {
+	shards := make([]*PostgresStorage, 0, postgresShardCount)
+	for i := 0; i < postgresShardCount; i++ {
+		if shard, ok := postgresShards[i]; ok {
+			shards = append(shards, shard)
+		}
+	}
+	return shards
+}
+
+// ShardCount returns the number of configured shards
+func ShardCount() int {
+	return postgresShardCount
+}
+
+// ShardOf returns the index of the shard holding a user's data
+func ShardOf(userID string) int {
+	return postgresResolver.Resolve(userID)
+}
+
+// GetShard returns the shard with the given index
+func GetShard(index int) (*PostgresStorage, error) {
+	shard, ok := postgresShards[index]
+	if !ok {
+		return nil, fmt.Errorf("no shard %d, %d configured", index, postgresShardCount)
+	}
+	return shard, nil
+}
@@ -1,12 +1,14 @@
 package infrastructure
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"log"
 	"time"
 
 	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/tracing"
 )
 
 func (p *PostgresStorage) createTables() error {
@@ -37,6 +39,98 @@ func (p *PostgresStorage) createTables() error {
 		updated_at TIMESTAMP NOT NULL DEFAULT now()
 	);
 
+	CREATE TABLE IF NOT EXISTS shares (
+	  id UUID PRIMARY KEY,
+	  file_id UUID NOT NULL,
+	  user_id UUID NOT NULL,
+	  token VARCHAR(64) NOT NULL UNIQUE,
+	  expires_at TIMESTAMPTZ,
+	  revoked_at TIMESTAMPTZ,
+	  created_at TIMESTAMPTZ DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS share_accesses (
+	  id UUID PRIMARY KEY,
+	  share_id UUID NOT NULL,
+	  accessed_at TIMESTAMPTZ NOT NULL,
+	  ip VARCHAR(64),
+	  user_agent TEXT,
+	  bytes_served BIGINT NOT NULL DEFAULT 0,
+	  success BOOLEAN NOT NULL,
+	  denial_reason VARCHAR(50)
+	);
+
+	CREATE TABLE IF NOT EXISTS outbox (
+	  id UUID PRIMARY KEY,
+	  subject VARCHAR(255) NOT NULL,
+	  payload JSONB NOT NULL,
+	  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	  published_at TIMESTAMPTZ,
+	  attempts INT NOT NULL DEFAULT 0,
+	  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	  last_error TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+	  id UUID PRIMARY KEY,
+	  user_id UUID NOT NULL,
+	  organization VARCHAR(255) NOT NULL DEFAULT '',
+	  url TEXT NOT NULL,
+	  event_types TEXT[] NOT NULL,
+	  secret VARCHAR(255) NOT NULL,
+	  consecutive_failures INT NOT NULL DEFAULT 0,
+	  disabled_at TIMESTAMPTZ,
+	  disabled_reason TEXT,
+	  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	  id UUID PRIMARY KEY,
+	  subscription_id UUID NOT NULL,
+	  event_id VARCHAR(255) NOT NULL,
+	  event_type VARCHAR(255) NOT NULL,
+	  payload JSONB NOT NULL,
+	  status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	  attempts INT NOT NULL DEFAULT 0,
+	  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	  last_status_code INT,
+	  last_error TEXT,
+	  last_attempt_at TIMESTAMPTZ,
+	  delivered_at TIMESTAMPTZ,
+	  created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	  UNIQUE (subscription_id, event_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS user_deletions (
+	  user_id UUID PRIMARY KEY,
+	  status VARCHAR(20) NOT NULL DEFAULT 'running',
+	  phase VARCHAR(50) NOT NULL,
+	  cursor_id VARCHAR(255) NOT NULL DEFAULT '',
+	  files_deleted INT NOT NULL DEFAULT 0,
+	  objects_deleted INT NOT NULL DEFAULT 0,
+	  attempts INT NOT NULL DEFAULT 0,
+	  last_error TEXT,
+	  locked_until TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	  next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	  started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	  updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	  completed_at TIMESTAMPTZ
+	);
+
+	CREATE TABLE IF NOT EXISTS organization_members (
+	  user_id UUID NOT NULL,
+	  organization VARCHAR(255) NOT NULL,
+	  seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	  PRIMARY KEY (user_id, organization)
+	);
+
+	CREATE TABLE IF NOT EXISTS shard_topology (
+	  singleton BOOLEAN PRIMARY KEY DEFAULT true CHECK (singleton),
+	  shard_id INT NOT NULL,
+	  shard_count INT NOT NULL,
+	  recorded_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);
+
   `
 	_, err := p.Db.Exec(query)
 	if err != nil {
@@ -45,8 +139,19 @@ func (p *PostgresStorage) createTables() error {
 
 	// Add columns if missing
 	alterQueries := []string{
+		`ALTER TABLE shard_topology ADD COLUMN IF NOT EXISTS resolver VARCHAR(255) NOT NULL DEFAULT 'modulo'`,
 		`ALTER TABLE files ADD COLUMN IF NOT EXISTS scan_status VARCHAR(50) DEFAULT 'pending'`,
 		`ALTER TABLE files ADD COLUMN IF NOT EXISTS scanned_at TIMESTAMPTZ`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS scan_signature VARCHAR(255)`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS quarantined_at TIMESTAMPTZ`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS scan_override BOOLEAN NOT NULL DEFAULT false`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS scan_override_by VARCHAR(255)`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS scan_error TEXT`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS scan_attempts INT NOT NULL DEFAULT 0`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS scan_engine VARCHAR(100)`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS signature_version VARCHAR(255)`,
+		`ALTER TABLE files ADD COLUMN IF NOT EXISTS rescan_requested_at TIMESTAMPTZ`,
+		`ALTER TABLE outbox ADD COLUMN IF NOT EXISTS trace_context JSONB`,
 	}
 	for _, altQuery := range alterQueries {
 		_, err := p.Db.Exec(altQuery)
@@ -61,38 +166,43 @@ func (p *PostgresStorage) createTables() error {
   CREATE INDEX IF NOT EXISTS idx_files_type ON files(type);
   CREATE INDEX IF NOT EXISTS idx_files_user_id ON files(user_id);
   CREATE INDEX IF NOT EXISTS idx_files_scan_status ON files(scan_status);
+  CREATE INDEX IF NOT EXISTS idx_files_scanned_at ON files(scanned_at DESC) WHERE scan_status = 'clean';
+  CREATE INDEX IF NOT EXISTS idx_files_quarantined_at ON files(quarantined_at DESC) WHERE quarantined_at IS NOT NULL;
+  CREATE INDEX IF NOT EXISTS idx_shares_file_id ON shares(file_id);
+  CREATE INDEX IF NOT EXISTS idx_share_accesses_share_id ON share_accesses(share_id, accessed_at DESC);
+  CREATE INDEX IF NOT EXISTS idx_outbox_unpublished ON outbox(next_attempt_at) WHERE published_at IS NULL;
+  CREATE INDEX IF NOT EXISTS idx_outbox_published_at ON outbox(published_at) WHERE published_at IS NOT NULL;
+  CREATE INDEX IF NOT EXISTS idx_user_deletions_due ON user_deletions(next_attempt_at) WHERE status = 'running';
+  CREATE INDEX IF NOT EXISTS idx_files_user_id_id ON files(user_id, id);
+  CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_owner ON webhook_subscriptions(user_id, organization);
+  CREATE INDEX IF NOT EXISTS idx_webhook_subscriptions_organization ON webhook_subscriptions(organization) WHERE organization <> '';
+  CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+  CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription ON webhook_deliveries(subscription_id, created_at DESC);
   `
 
 	_, err = p.Db.Exec(indexQuery)
 	return err
 }
 
-func (p *PostgresStorage) IncrementUserFileStats(userID string) error {
-	_, err := p.Db.Exec(`
+// adjustFileCount changes the file count of a user by delta within tx, the
+// transaction that inserts or deletes the files
+func adjustFileCount(tx *sql.Tx, userID string, delta int) error {
+	_, err := tx.Exec(`
         INSERT INTO user_file_stats (user_id, file_count)
-        VALUES ($1, 1)
+        VALUES ($1, GREATEST($2, 0))
         ON CONFLICT (user_id)
         DO UPDATE SET
-            file_count = user_file_stats.file_count + 1,
+            file_count = GREATEST(user_file_stats.file_count + $2, 0),
             updated_at = NOW()
-    `, userID)
-
+    `, userID, delta)
 	return err
 }
 
-func (p *PostgresStorage) DecrementUserFileStats(userID string) error {
-	_, err := p.Db.Exec(`
-        UPDATE user_file_stats
-        SET
-            file_count = GREATEST(file_count - 1, 0),
-            updated_at = NOW()
-        WHERE user_id = $1
-    `, userID)
-	return err
-}
+func (p *PostgresStorage) DeleteUserFileStats(ctx context.Context, userID string) (err error) {
+	span, ctx := tracing.StartPostgresSpan(ctx, "DeleteUserFileStats")
+	defer tracing.Finish(span, &err)
 
-func (p *PostgresStorage) DeleteUserFileStats(userID string) error {
-	_, err := p.Db.Exec(`
+	_, err = p.Db.ExecContext(ctx, `
         DELETE FROM user_file_stats WHERE user_id = $1
     `, userID)
 	return err
@@ -115,7 +225,9 @@ func (p *PostgresStorage) GetUserFileStats(userID string) (int, error) {
 
 // Private methods with actual implementation
 
-func (p *PostgresStorage) SaveFileMetadata(metadata models.FileMetadata) error {
+// SaveFileMetadata upserts the file row and stores events in the outbox in the
+// same transaction. The user's file count only grows when a row is inserted.
+func (p *PostgresStorage) SaveFileMetadata(metadata models.FileMetadata, events ...models.OutboxMessage) error {
 	query := `
   INSERT INTO files (id, name, original_name, size, type, extension, uploaded_at, file_path, preview_path, share_url, bucket_name, user_id, scan_status)
   VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
@@ -131,9 +243,17 @@ func (p *PostgresStorage) SaveFileMetadata(metadata models.FileMetadata) error {
       user_id = EXCLUDED.user_id,
       scan_status = EXCLUDED.scan_status,
       updated_at = NOW()
+  RETURNING (xmax = 0) AS inserted
   `
 
-	_, err := p.Db.Exec(query,
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var inserted bool
+	err = tx.QueryRow(query,
 		metadata.ID,
 		metadata.Name,
 		metadata.OriginalName,
@@ -147,19 +267,33 @@ func (p *PostgresStorage) SaveFileMetadata(metadata models.FileMetadata) error {
 		"files",
 		metadata.UserID,
 		"pending",
-	)
-
-	return err
+	).Scan(&inserted)
+	if err != nil {
+		return err
+	}
+	if inserted {
+		if err := adjustFileCount(tx, metadata.UserID, 1); err != nil {
+			return err
+		}
+	}
+	if err := insertOutbox(tx, events); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-func (p *PostgresStorage) GetFileMetadata(fileID string) (models.FileMetadata, bool) {
-	query := `
-  SELECT id, name, original_name, size, type, extension, uploaded_at, file_path, preview_path, share_url, bucket_name, user_id, scan_status, scanned_at
-  FROM files WHERE id = $1
-  `
+// fileMetadataColumns is the column list read by scanFileMetadata
+const fileMetadataColumns = `id, name, original_name, size, type, extension, uploaded_at, file_path, preview_path, share_url, bucket_name, user_id, scan_status, scanned_at, COALESCE(scan_signature, ''), quarantined_at, scan_override, COALESCE(scan_error, ''), scan_attempts, COALESCE(scan_engine, ''), COALESCE(signature_version, '')`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
 
+func scanFileMetadata(row rowScanner) (models.FileMetadata, error) {
 	var metadata models.FileMetadata
-	err := p.Db.QueryRow(query, fileID).Scan(
+	var scannedAt, quarantinedAt sql.NullTime
+
+	err := row.Scan(
 		&metadata.ID,
 		&metadata.Name,
 		&metadata.OriginalName,
@@ -173,9 +307,34 @@ func (p *PostgresStorage) GetFileMetadata(fileID string) (models.FileMetadata, b
 		&metadata.BucketName,
 		&metadata.UserID,
 		&metadata.ScanStatus,
-		&metadata.ScannedAt,
+		&scannedAt,
+		&metadata.ScanSignature,
+		&quarantinedAt,
+		&metadata.ScanOverride,
+		&metadata.ScanError,
+		&metadata.ScanAttempts,
+		&metadata.ScanEngine,
+		&metadata.SignatureVersion,
 	)
+	if err != nil {
+		return models.FileMetadata{}, err
+	}
 
+	// scanned_at stays NULL until the first scan finishes
+	metadata.ScannedAt = scannedAt.Time
+	if quarantinedAt.Valid {
+		metadata.QuarantinedAt = &quarantinedAt.Time
+	}
+	return metadata, nil
+}
+
+func (p *PostgresStorage) GetFileMetadata(ctx context.Context, fileID string) (models.FileMetadata, bool) {
+	span, ctx := tracing.StartPostgresSpan(ctx, "GetFileMetadata")
+	defer span.Finish()
+
+	query := `SELECT ` + fileMetadataColumns + ` FROM files WHERE id = $1`
+
+	metadata, err := scanFileMetadata(p.Db.QueryRowContext(ctx, query, fileID))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return models.FileMetadata{}, false
@@ -188,10 +347,7 @@ func (p *PostgresStorage) GetFileMetadata(fileID string) (models.FileMetadata, b
 }
 
 func (p *PostgresStorage) getAllFileMetadataPerUser(userID string) []models.FileMetadata {
-	query := `
-  SELECT id, name, original_name, size, type, extension, uploaded_at, file_path, preview_path, share_url, bucket_name, user_id, scan_status, scanned_at
-  FROM files WHERE user_id = $1 ORDER BY uploaded_at DESC
-  `
+	query := `SELECT ` + fileMetadataColumns + ` FROM files WHERE user_id = $1 ORDER BY uploaded_at DESC`
 
 	rows, err := p.Db.Query(query, userID)
 	if err != nil {
@@ -207,23 +363,7 @@ func (p *PostgresStorage) getAllFileMetadataPerUser(userID string) []models.File
 
 	var files []models.FileMetadata
 	for rows.Next() {
-		var metadata models.FileMetadata
-		err := rows.Scan(
-			&metadata.ID,
-			&metadata.Name,
-			&metadata.OriginalName,
-			&metadata.Size,
-			&metadata.Type,
-			&metadata.Extension,
-			&metadata.UploadedAt,
-			&metadata.FilePath,
-			&metadata.PreviewPath,
-			&metadata.ShareURL,
-			&metadata.BucketName,
-			&metadata.UserID,
-			&metadata.ScanStatus,
-			&metadata.ScannedAt,
-		)
+		metadata, err := scanFileMetadata(rows)
 		if err != nil {
 			log.Printf("Error scanning row: %v", err)
 			continue
@@ -278,10 +418,8 @@ func (p *PostgresStorage) GetUserFileMetadata(userID string) []models.FileMetada
 
 // GetUserFileMetadataPage returns a page of files for a user
 func (p *PostgresStorage) GetUserFileMetadataPage(userID string, limit, offset int) ([]models.FileMetadata, error) {
-	query := `
-      SELECT id, name, original_name, size, type, extension, uploaded_at, file_path, preview_path, share_url, bucket_name, user_id
-      FROM files WHERE user_id = $1 ORDER BY uploaded_at DESC LIMIT $2 OFFSET $3
-  `
+	query := `SELECT ` + fileMetadataColumns + `
+      FROM files WHERE user_id = $1 ORDER BY uploaded_at DESC LIMIT $2 OFFSET $3`
 	rows, err := p.Db.Query(query, userID, limit, offset)
 	if err != nil {
 		log.Printf("Error querying paginated user files: %v", err)
@@ -294,21 +432,8 @@ func (p *PostgresStorage) GetUserFileMetadataPage(userID string, limit, offset i
 	}(rows)
 	var files []models.FileMetadata
 	for rows.Next() {
-		var metadata models.FileMetadata
-		if err := rows.Scan(
-			&metadata.ID,
-			&metadata.Name,
-			&metadata.OriginalName,
-			&metadata.Size,
-			&metadata.Type,
-			&metadata.Extension,
-			&metadata.UploadedAt,
-			&metadata.FilePath,
-			&metadata.PreviewPath,
-			&metadata.ShareURL,
-			&metadata.BucketName,
-			&metadata.UserID,
-		); err != nil {
+		metadata, err := scanFileMetadata(rows)
+		if err != nil {
 			log.Printf("Error scanning row: %v", err)
 			continue
 		}
@@ -329,16 +454,30 @@ func (p *PostgresStorage) GetUserFileCount(userID string) (int64, error) {
 	return total, nil
 }
 
-func (p *PostgresStorage) DeleteFileMetadata(fileID, userID string) bool {
-	query := `DELETE FROM files WHERE id = $1 AND user_id = $2` // Added AND user_id
-	result, err := p.Db.Exec(query, fileID, userID)
+// DeleteFileMetadata deletes the file row; events are stored in the outbox
+// and the user's file count decremented in the same transaction, and only
+// when a row was deleted
+func (p *PostgresStorage) DeleteFileMetadata(fileID, userID string, events ...models.OutboxMessage) (bool, error) {
+	tx, err := p.Db.Begin()
 	if err != nil {
-		log.Printf("Error deleting file metadata: %v", err)
-		return false
+		return false, err
 	}
+	defer func() { _ = tx.Rollback() }()
 
-	rowsAffected, _ := result.RowsAffected()
-	return rowsAffected > 0
+	result, err := tx.Exec(`DELETE FROM files WHERE id = $1 AND user_id = $2`, fileID, userID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if err := adjustFileCount(tx, userID, -1); err != nil {
+		return false, err
+	}
+	if err := insertOutbox(tx, events); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
 }
 
 func (p *PostgresStorage) getStats() map[string]interface{} {
@@ -362,27 +501,90 @@ func (p *PostgresStorage) getStats() map[string]interface{} {
 	}
 }
 
-func (p *PostgresStorage) DeleteAllFilesForUser(userID string) int {
-	res, err := p.Db.Exec(`DELETE FROM files WHERE user_id = $1`, userID)
+// DeleteUserFilesBatch deletes up to limit file rows of a user. events builds
+// the outbox messages for the deleted rows, which are stored in the same
+// transaction. It returns 0 once no rows are left.
+func (p *PostgresStorage) DeleteUserFilesBatch(ctx context.Context, userID string, limit int, events func(deleted []models.FileMetadata) ([]models.OutboxMessage, error)) (n int, err error) {
+	span, ctx := tracing.StartPostgresSpan(ctx, "DeleteUserFilesBatch")
+	defer tracing.Finish(span, &err)
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := tx.QueryContext(ctx, `
+      DELETE FROM files WHERE id IN (SELECT id FROM files WHERE user_id = $1 LIMIT $2)
+      RETURNING `+fileMetadataColumns, userID, limit)
+	if err != nil {
+		return 0, err
+	}
+	// Every deleted row must reach the events, or its objects would leak
+	var deleted []models.FileMetadata
+	for rows.Next() {
+		metadata, err := scanFileMetadata(rows)
+		if err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		deleted = append(deleted, metadata)
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(deleted) == 0 {
+		return 0, nil
+	}
+
+	messages, err := events(deleted)
+	if err != nil {
+		return 0, err
+	}
+	if err := insertOutbox(tx, messages); err != nil {
+		return 0, err
+	}
+	if err := adjustFileCount(tx, userID, -len(deleted)); err != nil {
+		return 0, err
+	}
+	return len(deleted), tx.Commit()
+}
+
+// SetScanOverride lets an admin allow (or stop allowing) downloads of a file
+// regardless of its scan status
+func (p *PostgresStorage) SetScanOverride(fileID string, allow bool, adminID string, events ...models.OutboxMessage) bool {
+	rowsAffected, err := p.execWithOutbox(events, `
+      UPDATE files
+      SET scan_override = $1,
+          scan_override_by = $2,
+          updated_at = NOW()
+      WHERE id = $3
+  `, allow, adminID, fileID)
 	if err != nil {
-		log.Printf("Failed to delete files for user %s: %v", userID, err)
-		return 0
+		log.Printf("Error setting scan override: %v", err)
+		return false
 	}
-	count, _ := res.RowsAffected()
-	return int(count)
+	return rowsAffected > 0
 }
 
-func (p *PostgresStorage) UpdateFileScanStatus(
-	fileID, status string,
-	scannedAt time.Time,
-) error {
+func (p *PostgresStorage) UpdateFileScanStatus(ctx context.Context, fileID string, result models.ScanResult) (err error) {
+	span, ctx := tracing.StartPostgresSpan(ctx, "UpdateFileScanStatus")
+	defer tracing.Finish(span, &err)
+
 	query := `
       UPDATE files
       SET scan_status = $1,
           scanned_at = $2,
+          scan_engine = $3,
+          signature_version = $4,
+          scan_error = NULL,
+          rescan_requested_at = NULL,
           updated_at = NOW()
-      WHERE id = $3
+      WHERE id = $5
   `
-	_, err := p.Db.Exec(query, status, scannedAt, fileID)
+	_, err = p.Db.ExecContext(ctx, query, result.Status, result.ScannedAt, result.Engine, result.SignatureVersion, fileID)
 	return err
 }
@@ -0,0 +1,201 @@
+package infrastructure
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/lib/pq"
+)
+
+// ListFileStatsUsers returns up to limit user IDs greater than after that
+// have files or a file count, ordered by ID; an empty after starts at the
+// beginning
+func (p *PostgresStorage) ListFileStatsUsers(after string, limit int) ([]string, error) {
+	if after == "" {
+		after = "00000000-0000-0000-0000-000000000000"
+	}
+	rows, err := p.Db.Query(`
+      SELECT user_id FROM (
+          (SELECT DISTINCT user_id FROM files WHERE user_id > $1 ORDER BY user_id LIMIT $2)
+          UNION
+          (SELECT user_id FROM user_file_stats WHERE user_id > $1 ORDER BY user_id LIMIT $2)
+      ) users
+      ORDER BY user_id
+      LIMIT $2
+  `, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		if cerr := rows.Close(); cerr != nil {
+			log.Printf("Error closing rows: %v", cerr)
+		}
+	}(rows)
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
+
+// fileStatsDriftQuery compares the stored file count of the users in $1 with
+// the count of their rows in files
+const fileStatsDriftQuery = `
+  SELECT u.user_id, COALESCE(s.file_count, 0), f.n
+  FROM unnest($1::uuid[]) AS u(user_id)
+  LEFT JOIN user_file_stats s ON s.user_id = u.user_id
+  CROSS JOIN LATERAL (SELECT COUNT(*) AS n FROM files WHERE files.user_id = u.user_id) f
+  WHERE COALESCE(s.file_count, 0) <> f.n
+  ORDER BY u.user_id
+`
+
+// FindFileStatsDrift returns the users of userIDs whose stored file count is
+// wrong. It takes no locks, so uploads in flight may show up as drift.
+func (p *PostgresStorage) FindFileStatsDrift(userIDs []string) ([]models.FileStatsDrift, error) {
+	return queryFileStatsDrift(p.Db, fileStatsDriftQuery, pq.Array(userIDs))
+}
+
+// GetFileCounts returns the stored file counts of userIDs; users without a
+// count are left out
+func (p *PostgresStorage) GetFileCounts(userIDs []string) (map[string]int, error) {
+	rows, err := p.Db.Query(`SELECT user_id, file_count FROM user_file_stats WHERE user_id = ANY($1::uuid[])`, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		if cerr := rows.Close(); cerr != nil {
+			log.Printf("Error closing rows: %v", cerr)
+		}
+	}(rows)
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var userID string
+		var count int
+		if err := rows.Scan(&userID, &count); err != nil {
+			return nil, err
+		}
+		counts[userID] = count
+	}
+	return counts, rows.Err()
+}
+
+// RepairFileStats recounts the files of userIDs and corrects their stored
+// counts. Only the stats rows of these users are locked: uploads and deletes
+// update them in the transaction that changes the files, so once the rows
+// are locked the count is exact. It returns the corrected users.
+func (p *PostgresStorage) RepairFileStats(userIDs []string) ([]models.FileStatsDrift, error) {
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := lockFileStats(tx, userIDs); err != nil {
+		return nil, err
+	}
+	drift, err := queryFileStatsDrift(tx, fileStatsDriftQuery, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	if err := setFileCounts(tx, drift); err != nil {
+		return nil, err
+	}
+	return drift, tx.Commit()
+}
+
+// SetFileStats stores counts computed elsewhere, e.g. by replaying events,
+// and returns the users whose stored count changed
+func (p *PostgresStorage) SetFileStats(counts map[string]int) ([]models.FileStatsDrift, error) {
+	userIDs := make([]string, 0, len(counts))
+	for userID := range counts {
+		userIDs = append(userIDs, userID)
+	}
+
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := lockFileStats(tx, userIDs); err != nil {
+		return nil, err
+	}
+	stored, err := queryFileStatsDrift(tx, `
+      SELECT u.user_id, COALESCE(s.file_count, 0), 0
+      FROM unnest($1::uuid[]) AS u(user_id)
+      LEFT JOIN user_file_stats s ON s.user_id = u.user_id
+      ORDER BY u.user_id
+  `, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	var drift []models.FileStatsDrift
+	for _, d := range stored {
+		if d.Actual = counts[d.UserID]; d.Actual != d.Stored {
+			drift = append(drift, d)
+		}
+	}
+	if err := setFileCounts(tx, drift); err != nil {
+		return nil, err
+	}
+	return drift, tx.Commit()
+}
+
+// lockFileStats locks the existing stats rows of userIDs, in ID order so that
+// concurrent repairs cannot deadlock
+func lockFileStats(tx *sql.Tx, userIDs []string) error {
+	_, err := tx.Exec(`SELECT 1 FROM user_file_stats WHERE user_id = ANY($1::uuid[]) ORDER BY user_id FOR UPDATE`, pq.Array(userIDs))
+	return err
+}
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func queryFileStatsDrift(db queryer, query string, args ...interface{}) ([]models.FileStatsDrift, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		if cerr := rows.Close(); cerr != nil {
+			log.Printf("Error closing rows: %v", cerr)
+		}
+	}(rows)
+
+	var drift []models.FileStatsDrift
+	for rows.Next() {
+		var d models.FileStatsDrift
+		if err := rows.Scan(&d.UserID, &d.Stored, &d.Actual); err != nil {
+			return nil, err
+		}
+		drift = append(drift, d)
+	}
+	return drift, rows.Err()
+}
+
+func setFileCounts(tx *sql.Tx, drift []models.FileStatsDrift) error {
+	if len(drift) == 0 {
+		return nil
+	}
+	userIDs := make([]string, len(drift))
+	counts := make([]int64, len(drift))
+	for i, d := range drift {
+		userIDs[i], counts[i] = d.UserID, int64(d.Actual)
+	}
+	_, err := tx.Exec(`
+      INSERT INTO user_file_stats (user_id, file_count)
+      SELECT * FROM unnest($1::uuid[], $2::int[])
+      ON CONFLICT (user_id)
+      DO UPDATE SET file_count = EXCLUDED.file_count, updated_at = NOW()
+  `, pq.Array(userIDs), pq.Array(counts))
+	return err
+}
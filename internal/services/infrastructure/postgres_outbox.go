@@ -0,0 +1,144 @@
+package infrastructure
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+)
+
+// insertOutbox stores events within tx, so they are only published when the
+// change they describe commits
+func insertOutbox(tx *sql.Tx, events []models.OutboxMessage) error {
+	for _, event := range events {
+		var traceContext []byte
+		if len(event.TraceContext) > 0 {
+			traceContext, _ = json.Marshal(event.TraceContext)
+		}
+		_, err := tx.Exec(`
+          INSERT INTO outbox (id, subject, payload, trace_context, created_at)
+          VALUES ($1, $2, $3, $4, NOW())
+      `, event.ID, event.Subject, event.Payload, traceContext)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execWithOutbox runs a single-statement change and stores events in the
+// same transaction when it affected at least one row
+func (p *PostgresStorage) execWithOutbox(events []models.OutboxMessage, query string, args ...interface{}) (int64, error) {
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		return 0, nil
+	}
+	if err := insertOutbox(tx, events); err != nil {
+		return 0, err
+	}
+	return rowsAffected, tx.Commit()
+}
+
+// RelayOutbox publishes up to limit due messages. Rows are locked with SKIP
+// LOCKED, so several replicas can relay the same shard without publishing a
+// message twice. A failed message is retried after backoff(attempts).
+func (p *PostgresStorage) RelayOutbox(limit int, publish func(models.OutboxMessage) error, backoff func(attempts int) time.Duration) (published, failed int, err error) {
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	rows, err := tx.Query(`
+      SELECT id, subject, payload, trace_context, created_at, attempts
+      FROM outbox
+      WHERE published_at IS NULL AND next_attempt_at <= NOW()
+      ORDER BY created_at
+      LIMIT $1
+      FOR UPDATE SKIP LOCKED
+  `, limit)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var messages []models.OutboxMessage
+	for rows.Next() {
+		var msg models.OutboxMessage
+		var traceContext []byte
+		if err := rows.Scan(&msg.ID, &msg.Subject, &msg.Payload, &traceContext, &msg.CreatedAt, &msg.Attempts); err != nil {
+			log.Printf("Error scanning outbox row: %v", err)
+			continue
+		}
+		if len(traceContext) > 0 {
+			_ = json.Unmarshal(traceContext, &msg.TraceContext)
+		}
+		messages = append(messages, msg)
+	}
+	if cerr := rows.Close(); cerr != nil {
+		log.Printf("Error closing rows: %v", cerr)
+	}
+	if err = rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	for _, msg := range messages {
+		if perr := publish(msg); perr != nil {
+			failed++
+			_, err = tx.Exec(`
+              UPDATE outbox
+              SET attempts = attempts + 1, last_error = $1, next_attempt_at = $2
+              WHERE id = $3
+          `, perr.Error(), time.Now().Add(backoff(msg.Attempts+1)), msg.ID)
+		} else {
+			published++
+			_, err = tx.Exec(`UPDATE outbox SET published_at = NOW(), last_error = NULL WHERE id = $1`, msg.ID)
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	err = tx.Commit()
+	return published, failed, err
+}
+
+// GetOutboxLag counts unpublished messages and the age of the oldest one
+func (p *PostgresStorage) GetOutboxLag() (models.OutboxLag, error) {
+	var lag models.OutboxLag
+	var oldest sql.NullTime
+	err := p.Db.QueryRow(`
+      SELECT COUNT(*), MIN(created_at) FROM outbox WHERE published_at IS NULL
+  `).Scan(&lag.Pending, &oldest)
+	if err != nil {
+		return lag, err
+	}
+	if oldest.Valid {
+		lag.OldestAge = time.Since(oldest.Time)
+	}
+	return lag, nil
+}
+
+// PurgePublishedOutbox deletes messages published before the given time
+func (p *PostgresStorage) PurgePublishedOutbox(before time.Time) (int64, error) {
+	result, err := p.Db.Exec(`DELETE FROM outbox WHERE published_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,83 @@
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/tracing"
+)
+
+// QuarantineFile marks a file as infected and records where its object now lives
+func (p *PostgresStorage) QuarantineFile(ctx context.Context, fileID, bucket string, result models.ScanResult) (err error) {
+	span, ctx := tracing.StartPostgresSpan(ctx, "QuarantineFile")
+	defer tracing.Finish(span, &err)
+
+	_, err = p.Db.ExecContext(ctx, `
+      UPDATE files
+      SET scan_status = $1,
+          scan_signature = $2,
+          scanned_at = $3,
+          scan_engine = $4,
+          signature_version = $5,
+          scan_error = NULL,
+          rescan_requested_at = NULL,
+          quarantined_at = NOW(),
+          bucket_name = $6,
+          updated_at = NOW()
+      WHERE id = $7
+  `, models.ScanStatusInfected, result.Signature, result.ScannedAt, result.Engine, result.SignatureVersion, bucket, fileID)
+	return err
+}
+
+// ReleaseQuarantinedFile moves a file back out of quarantine after an admin review
+func (p *PostgresStorage) ReleaseQuarantinedFile(fileID, bucket string, events ...models.OutboxMessage) bool {
+	rowsAffected, err := p.execWithOutbox(events, `
+      UPDATE files
+      SET scan_status = $1,
+          quarantined_at = NULL,
+          bucket_name = $2,
+          updated_at = NOW()
+      WHERE id = $3 AND quarantined_at IS NOT NULL
+  `, models.ScanStatusReleased, bucket, fileID)
+	if err != nil {
+		log.Printf("Error releasing quarantined file: %v", err)
+		return false
+	}
+	return rowsAffected > 0
+}
+
+// ListQuarantinedFiles returns quarantined files on this shard, most recent first
+func (p *PostgresStorage) ListQuarantinedFiles(limit int) ([]models.FileMetadata, error) {
+	query := `SELECT ` + fileMetadataColumns + `
+      FROM files WHERE quarantined_at IS NOT NULL
+      ORDER BY quarantined_at DESC LIMIT $1`
+
+	rows, err := p.Db.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		if cerr := rows.Close(); cerr != nil {
+			log.Printf("Error closing rows: %v", cerr)
+		}
+	}(rows)
+
+	var files []models.FileMetadata
+	for rows.Next() {
+		metadata, err := scanFileMetadata(rows)
+		if err != nil {
+			log.Printf("Error scanning row: %v", err)
+			continue
+		}
+		files = append(files, metadata)
+	}
+	return files, rows.Err()
+}
+
+func (p *PostgresStorage) CountQuarantinedFiles() (int64, error) {
+	var total int64
+	err := p.Db.QueryRow(`SELECT COUNT(*) FROM files WHERE quarantined_at IS NOT NULL`).Scan(&total)
+	return total, err
+}
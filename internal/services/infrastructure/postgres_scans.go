@@ -0,0 +1,105 @@
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/tracing"
+	"github.com/lib/pq"
+)
+
+// RecordScanFailure stores the reason of a failed scan attempt. When final is
+// set the file leaves pending and becomes scan_error.
+func (p *PostgresStorage) RecordScanFailure(ctx context.Context, fileID, reason string, final bool) (err error) {
+	span, ctx := tracing.StartPostgresSpan(ctx, "RecordScanFailure")
+	defer tracing.Finish(span, &err)
+
+	_, err = p.Db.ExecContext(ctx, `
+      UPDATE files
+      SET scan_attempts = scan_attempts + 1,
+          scan_error = $1,
+          scan_status = CASE WHEN $2 THEN $3 ELSE scan_status END,
+          updated_at = NOW()
+      WHERE id = $4
+  `, reason, final, models.ScanStatusError, fileID)
+	return err
+}
+
+// ListStalePendingFiles returns files that have been pending since before the given time
+func (p *PostgresStorage) ListStalePendingFiles(before time.Time, limit int) ([]models.FileMetadata, error) {
+	query := `SELECT ` + fileMetadataColumns + `
+      FROM files WHERE scan_status = $1 AND updated_at < $2
+      ORDER BY updated_at LIMIT $3`
+
+	rows, err := p.Db.Query(query, models.ScanStatusPending, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		if cerr := rows.Close(); cerr != nil {
+			log.Printf("Error closing rows: %v", cerr)
+		}
+	}(rows)
+
+	var files []models.FileMetadata
+	for rows.Next() {
+		metadata, err := scanFileMetadata(rows)
+		if err != nil {
+			log.Printf("Error scanning row: %v", err)
+			continue
+		}
+		files = append(files, metadata)
+	}
+	return files, rows.Err()
+}
+
+// MarkScanRequeued bumps updated_at so the sweeper does not requeue the file
+// again while the new request is in flight
+func (p *PostgresStorage) MarkScanRequeued(fileID string) error {
+	_, err := p.Db.Exec(`UPDATE files SET updated_at = NOW() WHERE id = $1 AND scan_status = $2`, fileID, models.ScanStatusPending)
+	return err
+}
+
+// ClaimFilesForRescan picks clean files that were scanned with other
+// signatures than signatureVersion and marks them as requested, so concurrent
+// watchers and later runs skip them. Files scanned after recentSince qualify,
+// as do files with an at-risk extension scanned after atRiskSince.
+func (p *PostgresStorage) ClaimFilesForRescan(signatureVersion string, recentSince, atRiskSince time.Time, atRiskExtensions []string, limit int) ([]models.FileMetadata, error) {
+	query := `UPDATE files SET rescan_requested_at = NOW()
+      WHERE id IN (
+          SELECT id FROM files
+          WHERE scan_status = $1
+            AND signature_version IS DISTINCT FROM $2
+            AND (scanned_at > $3 OR (LOWER(extension) = ANY($4) AND scanned_at > $5))
+            AND (rescan_requested_at IS NULL OR rescan_requested_at < NOW() - INTERVAL '1 hour')
+          ORDER BY scanned_at DESC
+          LIMIT $6
+          FOR UPDATE SKIP LOCKED
+      )
+      RETURNING ` + fileMetadataColumns
+
+	rows, err := p.Db.Query(query, models.ScanStatusClean, signatureVersion, recentSince,
+		pq.Array(atRiskExtensions), atRiskSince, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		if cerr := rows.Close(); cerr != nil {
+			log.Printf("Error closing rows: %v", cerr)
+		}
+	}(rows)
+
+	var files []models.FileMetadata
+	for rows.Next() {
+		metadata, err := scanFileMetadata(rows)
+		if err != nil {
+			log.Printf("Error scanning row: %v", err)
+			continue
+		}
+		files = append(files, metadata)
+	}
+	return files, rows.Err()
+}
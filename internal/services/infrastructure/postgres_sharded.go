@@ -1,6 +0,0 @@
-package infrastructure
-
-type ShardedPostgres struct {
-	resolver *Resolver
-	shards   map[int]*PostgresStorage
-}
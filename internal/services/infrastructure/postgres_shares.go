@@ -0,0 +1,171 @@
+package infrastructure
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+)
+
+func (p *PostgresStorage) CreateShare(share models.Share) error {
+	_, err := p.Db.Exec(`
+      INSERT INTO shares (id, file_id, user_id, token, expires_at, created_at)
+      VALUES ($1, $2, $3, $4, $5, $6)
+  `, share.ID, share.FileID, share.UserID, share.Token, share.ExpiresAt, share.CreatedAt)
+	return err
+}
+
+func (p *PostgresStorage) GetShareByToken(token string) (models.Share, bool) {
+	return p.getShare(`SELECT id, file_id, user_id, token, expires_at, revoked_at, created_at FROM shares WHERE token = $1`, token)
+}
+
+func (p *PostgresStorage) GetShareForUser(shareID, userID string) (models.Share, bool) {
+	return p.getShare(`SELECT id, file_id, user_id, token, expires_at, revoked_at, created_at FROM shares WHERE id = $1 AND user_id = $2`, shareID, userID)
+}
+
+func (p *PostgresStorage) getShare(query string, args ...interface{}) (models.Share, bool) {
+	var share models.Share
+	var expiresAt, revokedAt sql.NullTime
+
+	err := p.Db.QueryRow(query, args...).Scan(
+		&share.ID,
+		&share.FileID,
+		&share.UserID,
+		&share.Token,
+		&expiresAt,
+		&revokedAt,
+		&share.CreatedAt,
+	)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error getting share: %v", err)
+		}
+		return models.Share{}, false
+	}
+
+	if expiresAt.Valid {
+		share.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		share.RevokedAt = &revokedAt.Time
+	}
+	return share, true
+}
+
+func (p *PostgresStorage) RevokeShare(shareID, userID string) bool {
+	result, err := p.Db.Exec(`
+      UPDATE shares SET revoked_at = NOW()
+      WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+  `, shareID, userID)
+	if err != nil {
+		log.Printf("Error revoking share: %v", err)
+		return false
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected > 0
+}
+
+func (p *PostgresStorage) RecordShareAccess(access models.ShareAccess) error {
+	_, err := p.Db.Exec(`
+      INSERT INTO share_accesses (id, share_id, accessed_at, ip, user_agent, bytes_served, success, denial_reason)
+      VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+  `,
+		access.ID,
+		access.ShareID,
+		access.AccessedAt,
+		access.IP,
+		access.UserAgent,
+		access.BytesServed,
+		access.Success,
+		access.DenialReason,
+	)
+	return err
+}
+
+// GetShareAccessPage returns a page of accesses for a share, newest first
+func (p *PostgresStorage) GetShareAccessPage(shareID string, limit, offset int) ([]models.ShareAccess, error) {
+	rows, err := p.Db.Query(`
+      SELECT id, share_id, accessed_at, COALESCE(ip, ''), COALESCE(user_agent, ''), bytes_served, success, COALESCE(denial_reason, '')
+      FROM share_accesses WHERE share_id = $1 ORDER BY accessed_at DESC LIMIT $2 OFFSET $3
+  `, shareID, limit, offset)
+	if err != nil {
+		log.Printf("Error querying share accesses: %v", err)
+		return []models.ShareAccess{}, err
+	}
+	defer func(rows *sql.Rows) {
+		if cerr := rows.Close(); cerr != nil {
+			log.Printf("Error closing rows: %v", cerr)
+		}
+	}(rows)
+
+	accesses := []models.ShareAccess{}
+	for rows.Next() {
+		var access models.ShareAccess
+		if err := rows.Scan(
+			&access.ID,
+			&access.ShareID,
+			&access.AccessedAt,
+			&access.IP,
+			&access.UserAgent,
+			&access.BytesServed,
+			&access.Success,
+			&access.DenialReason,
+		); err != nil {
+			log.Printf("Error scanning row: %v", err)
+			continue
+		}
+		accesses = append(accesses, access)
+	}
+	return accesses, rows.Err()
+}
+
+func (p *PostgresStorage) GetShareAccessStats(shareID string) (models.ShareAccessStats, error) {
+	stats := models.ShareAccessStats{DenialsByReason: map[string]int{}}
+	var lastAccessed sql.NullTime
+
+	err := p.Db.QueryRow(`
+      SELECT COUNT(*),
+             COUNT(*) FILTER (WHERE success),
+             COUNT(*) FILTER (WHERE NOT success),
+             COALESCE(SUM(bytes_served), 0),
+             COUNT(DISTINCT ip),
+             MAX(accessed_at)
+      FROM share_accesses WHERE share_id = $1
+  `, shareID).Scan(
+		&stats.TotalAccesses,
+		&stats.Successful,
+		&stats.Denied,
+		&stats.BytesServed,
+		&stats.UniqueIPs,
+		&lastAccessed,
+	)
+	if err != nil {
+		return models.ShareAccessStats{}, err
+	}
+	if lastAccessed.Valid {
+		stats.LastAccessedAt = &lastAccessed.Time
+	}
+
+	rows, err := p.Db.Query(`
+      SELECT denial_reason, COUNT(*)
+      FROM share_accesses WHERE share_id = $1 AND NOT success
+      GROUP BY denial_reason
+  `, shareID)
+	if err != nil {
+		return models.ShareAccessStats{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reason sql.NullString
+		var count int
+		if err := rows.Scan(&reason, &count); err != nil {
+			return models.ShareAccessStats{}, err
+		}
+		stats.DenialsByReason[reason.String] = count
+	}
+
+	return stats, rows.Err()
+}
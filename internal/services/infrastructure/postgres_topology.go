@@ -0,0 +1,55 @@
+package infrastructure
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ShardTopology is the shard layout recorded in every shard database
+type ShardTopology struct {
+	ShardID    int
+	ShardCount int
+	// Resolver is the String of the resolver routing users to the shards
+	Resolver string
+}
+
+// CheckTopology records the topology in a shard database on its first start
+// and afterwards verifies that the configuration still matches the record,
+// so a changed shard count or swapped connection strings cannot silently
+// route users to the wrong database
+func (p *PostgresStorage) CheckTopology(want ShardTopology) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := p.Db.ExecContext(ctx, `
+		INSERT INTO shard_topology (shard_id, shard_count, resolver)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (singleton) DO NOTHING
+	`, want.ShardID, want.ShardCount, want.Resolver); err != nil {
+		return fmt.Errorf("record shard topology: %w", err)
+	}
+
+	var recorded ShardTopology
+	if err := p.Db.QueryRowContext(ctx, `
+		SELECT shard_id, shard_count, resolver FROM shard_topology
+	`).Scan(&recorded.ShardID, &recorded.ShardCount, &recorded.Resolver); err != nil {
+		return fmt.Errorf("read shard topology: %w", err)
+	}
+
+	return want.Matches(recorded)
+}
+
+// Matches returns an error describing how the topology differs from the
+// recorded one
+func (t ShardTopology) Matches(recorded ShardTopology) error {
+	switch {
+	case recorded.ShardID != t.ShardID:
+		return fmt.Errorf("database is shard %d of %d but configured as shard %d", recorded.ShardID, recorded.ShardCount, t.ShardID)
+	case recorded.ShardCount != t.ShardCount:
+		return fmt.Errorf("shard %d was recorded in a topology of %d shards but %d are configured; move the users before changing the shard count", t.ShardID, recorded.ShardCount, t.ShardCount)
+	case recorded.Resolver != t.Resolver:
+		return fmt.Errorf("shard %d was recorded with resolver %s but %s is configured; move the users before changing the resolver", t.ShardID, recorded.Resolver, t.Resolver)
+	}
+	return nil
+}
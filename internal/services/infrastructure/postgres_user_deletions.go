@@ -0,0 +1,238 @@
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/tracing"
+)
+
+const userDeletionColumns = `user_id, status, phase, cursor_id, files_deleted, objects_deleted, attempts, COALESCE(last_error, ''), started_at, updated_at, completed_at`
+
+func scanUserDeletion(row rowScanner) (models.UserDeletion, error) {
+	var job models.UserDeletion
+	var completedAt sql.NullTime
+	err := row.Scan(
+		&job.UserID,
+		&job.Status,
+		&job.Phase,
+		&job.Cursor,
+		&job.FilesDeleted,
+		&job.ObjectsDeleted,
+		&job.Attempts,
+		&job.LastError,
+		&job.StartedAt,
+		&job.UpdatedAt,
+		&completedAt,
+	)
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	return job, err
+}
+
+// StartUserDeletion records a deletion job for a user unless one exists, and
+// returns the job
+func (p *PostgresStorage) StartUserDeletion(ctx context.Context, userID string) (job models.UserDeletion, err error) {
+	span, ctx := tracing.StartPostgresSpan(ctx, "StartUserDeletion")
+	defer tracing.Finish(span, &err)
+
+	_, err = p.Db.ExecContext(ctx, `
+      INSERT INTO user_deletions (user_id, phase) VALUES ($1, $2)
+      ON CONFLICT (user_id) DO NOTHING
+  `, userID, models.DeletionBlockAccess)
+	if err != nil {
+		return models.UserDeletion{}, err
+	}
+	job, _, err = p.GetUserDeletion(ctx, userID)
+	return job, err
+}
+
+func (p *PostgresStorage) GetUserDeletion(ctx context.Context, userID string) (job models.UserDeletion, exists bool, err error) {
+	span, ctx := tracing.StartPostgresSpan(ctx, "GetUserDeletion")
+	defer tracing.Finish(span, &err)
+
+	job, err = scanUserDeletion(p.Db.QueryRowContext(ctx, `SELECT `+userDeletionColumns+` FROM user_deletions WHERE user_id = $1`, userID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.UserDeletion{}, false, nil
+	}
+	if err != nil {
+		return models.UserDeletion{}, false, err
+	}
+	return job, true, nil
+}
+
+// ClaimUserDeletion leases the running job of a user. It fails when the job
+// is finished or leased by another run.
+func (p *PostgresStorage) ClaimUserDeletion(ctx context.Context, userID string, lease time.Duration) (job models.UserDeletion, claimed bool, err error) {
+	span, ctx := tracing.StartPostgresSpan(ctx, "ClaimUserDeletion")
+	defer tracing.Finish(span, &err)
+
+	job, err = scanUserDeletion(p.Db.QueryRowContext(ctx, `
+      UPDATE user_deletions SET locked_until = $2
+      WHERE user_id = $1 AND status = 'running' AND locked_until <= NOW()
+      RETURNING `+userDeletionColumns, userID, time.Now().Add(lease)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.UserDeletion{}, false, nil
+	}
+	if err != nil {
+		return models.UserDeletion{}, false, err
+	}
+	return job, true, nil
+}
+
+// ClaimDueUserDeletions leases up to limit running jobs that are neither
+// leased nor waiting for a retry
+func (p *PostgresStorage) ClaimDueUserDeletions(ctx context.Context, limit int, lease time.Duration) (jobs []models.UserDeletion, err error) {
+	span, ctx := tracing.StartPostgresSpan(ctx, "ClaimDueUserDeletions")
+	defer tracing.Finish(span, &err)
+
+	rows, err := p.Db.QueryContext(ctx, `
+      UPDATE user_deletions SET locked_until = $2
+      WHERE user_id IN (
+          SELECT user_id FROM user_deletions
+          WHERE status = 'running' AND locked_until <= NOW() AND next_attempt_at <= NOW()
+          ORDER BY started_at
+          LIMIT $1
+          FOR UPDATE SKIP LOCKED
+      )
+      RETURNING `+userDeletionColumns, limit, time.Now().Add(lease))
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		if cerr := rows.Close(); cerr != nil {
+			log.Printf("Error closing rows: %v", cerr)
+		}
+	}(rows)
+
+	for rows.Next() {
+		job, err := scanUserDeletion(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// CheckpointUserDeletion stores the progress of a job and extends its lease
+func (p *PostgresStorage) CheckpointUserDeletion(ctx context.Context, job models.UserDeletion, lease time.Duration) (err error) {
+	span, ctx := tracing.StartPostgresSpan(ctx, "CheckpointUserDeletion")
+	defer tracing.Finish(span, &err)
+
+	_, err = p.Db.ExecContext(ctx, `
+      UPDATE user_deletions
+      SET phase = $2, cursor_id = $3, files_deleted = $4, objects_deleted = $5,
+          updated_at = NOW(), locked_until = $6
+      WHERE user_id = $1
+  `, job.UserID, job.Phase, job.Cursor, job.FilesDeleted, job.ObjectsDeleted, time.Now().Add(lease))
+	return err
+}
+
+// FailUserDeletion records a failed run and releases the job for a retry at retryAt
+func (p *PostgresStorage) FailUserDeletion(ctx context.Context, userID, reason string, retryAt time.Time) (err error) {
+	span, ctx := tracing.StartPostgresSpan(ctx, "FailUserDeletion")
+	defer tracing.Finish(span, &err)
+
+	_, err = p.Db.ExecContext(ctx, `
+      UPDATE user_deletions
+      SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3, locked_until = NOW(), updated_at = NOW()
+      WHERE user_id = $1
+  `, userID, reason, retryAt)
+	return err
+}
+
+// ReleaseUserDeletion gives up the lease of an interrupted run, so the job
+// can be resumed right away
+func (p *PostgresStorage) ReleaseUserDeletion(ctx context.Context, userID string) (err error) {
+	span, ctx := tracing.StartPostgresSpan(ctx, "ReleaseUserDeletion")
+	defer tracing.Finish(span, &err)
+
+	_, err = p.Db.ExecContext(ctx, `UPDATE user_deletions SET locked_until = NOW() WHERE user_id = $1`, userID)
+	return err
+}
+
+// CompleteUserDeletion marks a job done and stores events in the same transaction
+func (p *PostgresStorage) CompleteUserDeletion(ctx context.Context, userID string, events ...models.OutboxMessage) (err error) {
+	span, _ := tracing.StartPostgresSpan(ctx, "CompleteUserDeletion")
+	defer tracing.Finish(span, &err)
+
+	_, err = p.execWithOutbox(events, `
+      UPDATE user_deletions
+      SET status = 'completed', phase = $2, cursor_id = '', last_error = NULL,
+          completed_at = NOW(), updated_at = NOW(), locked_until = NOW()
+      WHERE user_id = $1 AND status = 'running'
+  `, userID, models.DeletionDone)
+	return err
+}
+
+// ListUserFilesAfter returns up to limit files of a user with IDs greater
+// than after, ordered by ID; an empty after starts at the beginning
+func (p *PostgresStorage) ListUserFilesAfter(ctx context.Context, userID, after string, limit int) (files []models.FileMetadata, err error) {
+	span, ctx := tracing.StartPostgresSpan(ctx, "ListUserFilesAfter")
+	defer tracing.Finish(span, &err)
+
+	if after == "" {
+		after = "00000000-0000-0000-0000-000000000000"
+	}
+	rows, err := p.Db.QueryContext(ctx, `
+      SELECT `+fileMetadataColumns+` FROM files
+      WHERE user_id = $1 AND id > $2
+      ORDER BY id
+      LIMIT $3
+  `, userID, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		if cerr := rows.Close(); cerr != nil {
+			log.Printf("Error closing rows: %v", cerr)
+		}
+	}(rows)
+
+	for rows.Next() {
+		metadata, err := scanFileMetadata(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, metadata)
+	}
+	return files, rows.Err()
+}
+
+// RevokeAllSharesForUser revokes every active share link of a user
+func (p *PostgresStorage) RevokeAllSharesForUser(ctx context.Context, userID string) (revoked int64, err error) {
+	span, ctx := tracing.StartPostgresSpan(ctx, "RevokeAllSharesForUser")
+	defer tracing.Finish(span, &err)
+
+	result, err := p.Db.ExecContext(ctx, `UPDATE shares SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteSharesForUser deletes the share links of a user and their access log
+func (p *PostgresStorage) DeleteSharesForUser(ctx context.Context, userID string) (err error) {
+	span, ctx := tracing.StartPostgresSpan(ctx, "DeleteSharesForUser")
+	defer tracing.Finish(span, &err)
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM share_accesses WHERE share_id IN (SELECT id FROM shares WHERE user_id = $1)`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM shares WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,407 @@
+package infrastructure
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/tracing"
+	"github.com/lib/pq"
+)
+
+const webhookSubscriptionColumns = `id, user_id, organization, url, event_types, secret, consecutive_failures, disabled_at, COALESCE(disabled_reason, ''), created_at`
+
+func scanWebhookSubscription(row interface{ Scan(...interface{}) error }) (models.WebhookSubscription, error) {
+	var sub models.WebhookSubscription
+	var disabledAt sql.NullTime
+	err := row.Scan(
+		&sub.ID,
+		&sub.UserID,
+		&sub.Organization,
+		&sub.URL,
+		pq.Array(&sub.EventTypes),
+		&sub.Secret,
+		&sub.ConsecutiveFailures,
+		&disabledAt,
+		&sub.DisabledReason,
+		&sub.CreatedAt,
+	)
+	if disabledAt.Valid {
+		sub.DisabledAt = &disabledAt.Time
+	}
+	return sub, err
+}
+
+func (p *PostgresStorage) CreateWebhookSubscription(sub models.WebhookSubscription) error {
+	_, err := p.Db.Exec(`
+      INSERT INTO webhook_subscriptions (id, user_id, organization, url, event_types, secret, created_at)
+      VALUES ($1, $2, $3, $4, $5, $6, $7)
+  `, sub.ID, sub.UserID, sub.Organization, sub.URL, pq.Array(sub.EventTypes), sub.Secret, sub.CreatedAt)
+	return err
+}
+
+// ListWebhookSubscriptions returns the subscriptions of a user, or of an
+// organization when organization is set
+func (p *PostgresStorage) ListWebhookSubscriptions(userID, organization string) ([]models.WebhookSubscription, error) {
+	query := `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions WHERE user_id = $1 AND organization = '' ORDER BY created_at`
+	arg := userID
+	if organization != "" {
+		query = `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions WHERE organization = $1 ORDER BY created_at`
+		arg = organization
+	}
+	return p.queryWebhookSubscriptions(query, arg)
+}
+
+// MatchWebhookSubscriptions returns the enabled subscriptions of a user, or
+// of an organization, that asked for eventType
+func (p *PostgresStorage) MatchWebhookSubscriptions(userID, organization, eventType string) ([]models.WebhookSubscription, error) {
+	if organization != "" {
+		return p.queryWebhookSubscriptions(`
+          SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions
+          WHERE organization = $1 AND disabled_at IS NULL AND $2 = ANY(event_types)
+      `, organization, eventType)
+	}
+	return p.queryWebhookSubscriptions(`
+      SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions
+      WHERE user_id = $1 AND organization = '' AND disabled_at IS NULL AND $2 = ANY(event_types)
+  `, userID, eventType)
+}
+
+func (p *PostgresStorage) queryWebhookSubscriptions(query string, args ...interface{}) ([]models.WebhookSubscription, error) {
+	rows, err := p.Db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		if cerr := rows.Close(); cerr != nil {
+			log.Printf("Error closing rows: %v", cerr)
+		}
+	}(rows)
+
+	subs := []models.WebhookSubscription{}
+	for rows.Next() {
+		sub, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// GetWebhookSubscription returns a subscription of a user, or of an
+// organization when organization is set
+func (p *PostgresStorage) GetWebhookSubscription(id, userID, organization string) (models.WebhookSubscription, bool) {
+	query := `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions WHERE id = $1 AND user_id = $2 AND organization = ''`
+	arg := userID
+	if organization != "" {
+		query = `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions WHERE id = $1 AND organization = $2`
+		arg = organization
+	}
+
+	sub, err := scanWebhookSubscription(p.Db.QueryRow(query, id, arg))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error getting webhook subscription: %v", err)
+		}
+		return models.WebhookSubscription{}, false
+	}
+	return sub, true
+}
+
+// UpdateWebhookSubscription changes the URL and event types. Enabling a
+// disabled subscription resets its failure count.
+func (p *PostgresStorage) UpdateWebhookSubscription(sub models.WebhookSubscription, enable bool) error {
+	_, err := p.Db.Exec(`
+      UPDATE webhook_subscriptions
+      SET url = $2, event_types = $3,
+          disabled_at = CASE WHEN $4 THEN NULL ELSE disabled_at END,
+          disabled_reason = CASE WHEN $4 THEN NULL ELSE disabled_reason END,
+          consecutive_failures = CASE WHEN $4 THEN 0 ELSE consecutive_failures END
+      WHERE id = $1
+  `, sub.ID, sub.URL, pq.Array(sub.EventTypes), enable)
+	return err
+}
+
+// DeleteWebhookSubscription removes a subscription and its delivery log
+func (p *PostgresStorage) DeleteWebhookSubscription(id string) error {
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec(`DELETE FROM webhook_deliveries WHERE subscription_id = $1`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM webhook_subscriptions WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteWebhooksForUser removes the subscriptions of a user and the
+// organization memberships recorded for them. Organization subscriptions the
+// user created stay with the organization.
+func (p *PostgresStorage) DeleteWebhooksForUser(ctx context.Context, userID string) (err error) {
+	span, ctx := tracing.StartPostgresSpan(ctx, "DeleteWebhooksForUser")
+	defer tracing.Finish(span, &err)
+
+	tx, err := p.Db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, query := range []string{
+		`DELETE FROM webhook_deliveries WHERE subscription_id IN (SELECT id FROM webhook_subscriptions WHERE user_id = $1 AND organization = '')`,
+		`DELETE FROM webhook_subscriptions WHERE user_id = $1 AND organization = ''`,
+		`DELETE FROM organization_members WHERE user_id = $1`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// EnqueueWebhookDeliveries stores pending deliveries. An event already
+// queued for a subscription is skipped, so a redelivered message does not
+// reach a receiver twice.
+func (p *PostgresStorage) EnqueueWebhookDeliveries(deliveries []models.WebhookDelivery) error {
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, d := range deliveries {
+		_, err := tx.Exec(`
+          INSERT INTO webhook_deliveries (id, subscription_id, event_id, event_type, payload, status, created_at)
+          VALUES ($1, $2, $3, $4, $5, 'pending', NOW())
+          ON CONFLICT (subscription_id, event_id) DO NOTHING
+      `, d.ID, d.SubscriptionID, d.EventID, d.EventType, []byte(d.Payload))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ClaimWebhookDeliveries leases up to limit due deliveries of enabled
+// subscriptions. Claimed rows are not due again before lease expires, so
+// replicas do not send the same delivery concurrently, and a replica that
+// dies mid-send only delays it.
+func (p *PostgresStorage) ClaimWebhookDeliveries(limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	rows, err := p.Db.Query(`
+      WITH due AS (
+          SELECT d.id FROM webhook_deliveries d
+          JOIN webhook_subscriptions s ON s.id = d.subscription_id
+          WHERE d.status = 'pending' AND d.next_attempt_at <= NOW() AND s.disabled_at IS NULL
+          ORDER BY d.next_attempt_at
+          LIMIT $1
+          FOR UPDATE OF d SKIP LOCKED
+      )
+      UPDATE webhook_deliveries d
+      SET next_attempt_at = $2
+      FROM due, webhook_subscriptions s
+      WHERE d.id = due.id AND s.id = d.subscription_id
+      RETURNING d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.attempts, d.created_at, s.url, s.secret
+  `, limit, time.Now().Add(lease))
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		if cerr := rows.Close(); cerr != nil {
+			log.Printf("Error closing rows: %v", cerr)
+		}
+	}(rows)
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		d := models.WebhookDelivery{Status: models.WebhookPending}
+		var payload []byte
+		if err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &payload, &d.Attempts, &d.CreatedAt, &d.URL, &d.Secret); err != nil {
+			return nil, err
+		}
+		d.Payload = payload
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// RecordWebhookAttempt stores the outcome of sending a delivery and tracks
+// consecutive failures of its subscription. The subscription is disabled,
+// and its pending deliveries failed, once disableAfter attempts in a row
+// failed; disabled reports whether that happened now.
+func (p *PostgresStorage) RecordWebhookAttempt(d models.WebhookDelivery, attempt models.WebhookAttempt, disableAfter int) (disabled bool, err error) {
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	status := models.WebhookDelivered
+	nextAttempt := time.Now()
+	switch {
+	case attempt.Delivered:
+	case attempt.RetryAt != nil:
+		status = models.WebhookPending
+		nextAttempt = *attempt.RetryAt
+	default:
+		status = models.WebhookFailed
+	}
+
+	_, err = tx.Exec(`
+      UPDATE webhook_deliveries
+      SET status = $2, attempts = attempts + 1, next_attempt_at = $3,
+          last_status_code = NULLIF($4, 0), last_error = NULLIF($5, ''), last_attempt_at = NOW(),
+          delivered_at = CASE WHEN $6 THEN NOW() ELSE NULL END
+      WHERE id = $1
+  `, d.ID, status, nextAttempt, attempt.StatusCode, attempt.Error, attempt.Delivered)
+	if err != nil {
+		return false, err
+	}
+
+	if attempt.Delivered {
+		_, err = tx.Exec(`UPDATE webhook_subscriptions SET consecutive_failures = 0 WHERE id = $1 AND consecutive_failures > 0`, d.SubscriptionID)
+		if err != nil {
+			return false, err
+		}
+		return false, tx.Commit()
+	}
+
+	var failures int
+	var alreadyDisabled bool
+	err = tx.QueryRow(`
+      UPDATE webhook_subscriptions SET consecutive_failures = consecutive_failures + 1
+      WHERE id = $1
+      RETURNING consecutive_failures, disabled_at IS NOT NULL
+  `, d.SubscriptionID).Scan(&failures, &alreadyDisabled)
+	if err != nil {
+		return false, err
+	}
+
+	if !alreadyDisabled && disableAfter > 0 && failures >= disableAfter {
+		disabled = true
+		if _, err = tx.Exec(`
+          UPDATE webhook_subscriptions SET disabled_at = NOW(), disabled_reason = $2 WHERE id = $1
+      `, d.SubscriptionID, "disabled after consecutive failures: "+attempt.Error); err != nil {
+			return false, err
+		}
+		if _, err = tx.Exec(`
+          UPDATE webhook_deliveries SET status = 'failed', last_error = 'subscription disabled'
+          WHERE subscription_id = $1 AND status = 'pending'
+      `, d.SubscriptionID); err != nil {
+			return false, err
+		}
+	}
+	return disabled, tx.Commit()
+}
+
+// InsertWebhookDelivery logs a delivery that was already sent, e.g. a test event
+func (p *PostgresStorage) InsertWebhookDelivery(d models.WebhookDelivery) error {
+	_, err := p.Db.Exec(`
+      INSERT INTO webhook_deliveries (id, subscription_id, event_id, event_type, payload, status, attempts,
+                                      last_status_code, last_error, last_attempt_at, delivered_at, created_at)
+      VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0), NULLIF($9, ''), $10, $11, $12)
+  `, d.ID, d.SubscriptionID, d.EventID, d.EventType, []byte(d.Payload), d.Status, d.Attempts,
+		d.LastStatusCode, d.LastError, d.LastAttemptAt, d.DeliveredAt, d.CreatedAt)
+	return err
+}
+
+// GetWebhookDeliveryPage returns a page of deliveries of a subscription, newest first
+func (p *PostgresStorage) GetWebhookDeliveryPage(subscriptionID, status string, limit, offset int) ([]models.WebhookDelivery, error) {
+	rows, err := p.Db.Query(`
+      SELECT id, subscription_id, event_id, event_type, status, attempts,
+             COALESCE(last_status_code, 0), COALESCE(last_error, ''), created_at, last_attempt_at, delivered_at
+      FROM webhook_deliveries
+      WHERE subscription_id = $1 AND ($2 = '' OR status = $2)
+      ORDER BY created_at DESC LIMIT $3 OFFSET $4
+  `, subscriptionID, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		if cerr := rows.Close(); cerr != nil {
+			log.Printf("Error closing rows: %v", cerr)
+		}
+	}(rows)
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var lastAttemptAt, deliveredAt sql.NullTime
+		if err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Status, &d.Attempts,
+			&d.LastStatusCode, &d.LastError, &d.CreatedAt, &lastAttemptAt, &deliveredAt); err != nil {
+			return nil, err
+		}
+		if lastAttemptAt.Valid {
+			d.LastAttemptAt = &lastAttemptAt.Time
+		}
+		if deliveredAt.Valid {
+			d.DeliveredAt = &deliveredAt.Time
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// PurgeWebhookDeliveries deletes finished deliveries created before the given time
+func (p *PostgresStorage) PurgeWebhookDeliveries(before time.Time) (int64, error) {
+	result, err := p.Db.Exec(`DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// SetOrganizationMemberships replaces the organizations recorded for a user
+func (p *PostgresStorage) SetOrganizationMemberships(userID string, organizations []string) error {
+	tx, err := p.Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec(`
+      DELETE FROM organization_members WHERE user_id = $1 AND NOT (organization = ANY($2))
+  `, userID, pq.Array(organizations)); err != nil {
+		return err
+	}
+	for _, organization := range organizations {
+		if _, err := tx.Exec(`
+          INSERT INTO organization_members (user_id, organization, seen_at) VALUES ($1, $2, NOW())
+          ON CONFLICT (user_id, organization) DO UPDATE SET seen_at = NOW()
+      `, userID, organization); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetOrganizationsOfUser returns the organizations recorded for a user
+func (p *PostgresStorage) GetOrganizationsOfUser(userID string) ([]string, error) {
+	rows, err := p.Db.Query(`SELECT organization FROM organization_members WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		if cerr := rows.Close(); cerr != nil {
+			log.Printf("Error closing rows: %v", cerr)
+		}
+	}(rows)
+
+	var organizations []string
+	for rows.Next() {
+		var organization string
+		if err := rows.Scan(&organization); err != nil {
+			return nil, err
+		}
+		organizations = append(organizations, organization)
+	}
+	return organizations, rows.Err()
+}
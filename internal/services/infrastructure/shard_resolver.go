@@ -1,15 +1,194 @@
 package infrastructure
 
 import (
+	"fmt"
 	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
 )
 
-type Resolver struct {
-	shardCount int
+// Resolver strategies
+const (
+	// ResolverModulo is fnv32a(userID) % shards. Adding a shard remaps
+	// almost every user.
+	ResolverModulo = "modulo"
+	// ResolverRing is consistent hashing on a ring of weighted virtual nodes
+	ResolverRing = "ring"
+	// ResolverJump is the jump consistent hash of Lamping and Veach; it
+	// needs no memory but cannot weight shards
+	ResolverJump = "jump"
+)
+
+// DefaultVirtualNodes is the number of ring points of a shard of weight 1
+const DefaultVirtualNodes = 160
+
+// Resolver maps a user ID to the index of the shard holding the user's data
+type Resolver interface {
+	Resolve(userID string) int
+	// Shards is the number of shards resolved to
+	Shards() int
+	// String describes the strategy and its parameters. It is recorded in
+	// shard_topology, since changing it moves users.
+	String() string
+}
+
+// NewResolver returns the resolver of a strategy over one shard per weight.
+// virtualNodes is the number of ring points per unit of weight; zero means
+// DefaultVirtualNodes.
+func NewResolver(strategy string, weights []int, virtualNodes int) (Resolver, error) {
+	if len(weights) == 0 {
+		return nil, fmt.Errorf("no shards to resolve to")
+	}
+	uniform := true
+	for i, weight := range weights {
+		if weight < 1 {
+			return nil, fmt.Errorf("shard %d has weight %d, must be at least 1", i, weight)
+		}
+		uniform = uniform && weight == weights[0]
+	}
+
+	switch strategy {
+	case ResolverModulo, "":
+		if !uniform {
+			return nil, fmt.Errorf("the %s resolver cannot weight shards", ResolverModulo)
+		}
+		return moduloResolver{shardCount: len(weights)}, nil
+	case ResolverJump:
+		if !uniform {
+			return nil, fmt.Errorf("the %s resolver cannot weight shards", ResolverJump)
+		}
+		return jumpResolver{shardCount: len(weights)}, nil
+	case ResolverRing:
+		if virtualNodes == 0 {
+			virtualNodes = DefaultVirtualNodes
+		}
+		if virtualNodes < 1 {
+			return nil, fmt.Errorf("virtual nodes must be at least 1, got %d", virtualNodes)
+		}
+		return newRingResolver(weights, virtualNodes), nil
+	}
+	return nil, fmt.Errorf("unknown shard resolver %q", strategy)
 }
 
+// ResolveShard is the modulo strategy, the routing of deployments that
+// predate the other resolvers
 func ResolveShard(userID string, shardCount int) int {
 	h := fnv.New32a()
 	_, _ = h.Write([]byte(userID))
 	return int(h.Sum32()) % shardCount
 }
+
+type moduloResolver struct {
+	shardCount int
+}
+
+func (r moduloResolver) Resolve(userID string) int {
+	return ResolveShard(userID, r.shardCount)
+}
+
+func (r moduloResolver) Shards() int {
+	return r.shardCount
+}
+
+func (r moduloResolver) String() string {
+	return ResolverModulo
+}
+
+type jumpResolver struct {
+	shardCount int
+}
+
+// Resolve follows "A Fast, Minimal Memory, Consistent Hash Algorithm"
+func (r jumpResolver) Resolve(userID string) int {
+	key := hashKey(userID)
+	var b, j int64 = -1, 0
+	for j < int64(r.shardCount) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+func (r jumpResolver) Shards() int {
+	return r.shardCount
+}
+
+func (r jumpResolver) String() string {
+	return ResolverJump
+}
+
+// ringResolver places weight*virtualNodes points per shard on a 64-bit ring;
+// a user belongs to the shard of the first point at or after its hash. A
+// point's position depends only on its shard and number, so a new shard
+// takes over the arcs before its own points and leaves the rest in place.
+type ringResolver struct {
+	points []uint64
+	owners []int
+	count  int
+	desc   string
+}
+
+func newRingResolver(weights []int, virtualNodes int) *ringResolver {
+	type point struct {
+		hash  uint64
+		shard int
+	}
+	var points []point
+	for shard, weight := range weights {
+		for v := range weight * virtualNodes {
+			points = append(points, point{hash: hashKey(fmt.Sprintf("shard-%d-vnode-%d", shard, v)), shard: shard})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].hash != points[j].hash {
+			return points[i].hash < points[j].hash
+		}
+		return points[i].shard < points[j].shard
+	})
+
+	r := &ringResolver{count: len(weights)}
+	for _, p := range points {
+		r.points = append(r.points, p.hash)
+		r.owners = append(r.owners, p.shard)
+	}
+
+	formatted := make([]string, len(weights))
+	for i, weight := range weights {
+		formatted[i] = strconv.Itoa(weight)
+	}
+	r.desc = fmt.Sprintf("%s(vnodes=%d,weights=%s)", ResolverRing, virtualNodes, strings.Join(formatted, ","))
+	return r
+}
+
+func (r *ringResolver) Resolve(userID string) int {
+	h := hashKey(userID)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[i]
+}
+
+func (r *ringResolver) Shards() int {
+	return r.count
+}
+
+func (r *ringResolver) String() string {
+	return r.desc
+}
+
+// hashKey is fnv64a with the murmur3 finalizer, which spreads the similar
+// keys of ring points and user IDs evenly over the ring
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
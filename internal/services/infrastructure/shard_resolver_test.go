@@ -0,0 +1,145 @@
+package infrastructure
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// userIDs returns n fixed user IDs, so the tests are deterministic
+func userIDs(n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = uuid.NewSHA1(uuid.NameSpaceOID, []byte(strconv.Itoa(i))).String()
+	}
+	return ids
+}
+
+func mustResolver(t *testing.T, strategy string, weights []int) Resolver {
+	t.Helper()
+	r, err := NewResolver(strategy, weights, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func uniform(n int) []int {
+	weights := make([]int, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	return weights
+}
+
+// Going from N to N+1 shards must move about 1/(N+1) of the users, and only
+// to the new shard
+func TestResolverAddingAShardMovesFewUsers(t *testing.T) {
+	ids := userIDs(20000)
+	for _, strategy := range []string{ResolverRing, ResolverJump} {
+		for n := 1; n <= 12; n++ {
+			t.Run(fmt.Sprintf("%s/%d", strategy, n), func(t *testing.T) {
+				before := mustResolver(t, strategy, uniform(n))
+				after := mustResolver(t, strategy, uniform(n+1))
+
+				moved := 0
+				for _, id := range ids {
+					from, to := before.Resolve(id), after.Resolve(id)
+					if from == to {
+						continue
+					}
+					if to != n {
+						t.Fatalf("user moved from shard %d to old shard %d", from, to)
+					}
+					moved++
+				}
+
+				got := float64(moved) / float64(len(ids))
+				want := 1 / float64(n+1)
+				if math.Abs(got-want) > 0.3*want {
+					t.Fatalf("moved %.3f of the users, want about %.3f", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestResolverModuloMovesMostUsers(t *testing.T) {
+	ids := userIDs(10000)
+	before := mustResolver(t, ResolverModulo, uniform(4))
+	after := mustResolver(t, ResolverModulo, uniform(5))
+	moved := 0
+	for _, id := range ids {
+		if before.Resolve(id) != after.Resolve(id) {
+			moved++
+		}
+	}
+	if float64(moved)/float64(len(ids)) < 0.7 {
+		t.Fatalf("moved %d of %d users", moved, len(ids))
+	}
+	for _, id := range ids[:100] {
+		if before.Resolve(id) != ResolveShard(id, 4) {
+			t.Fatal("modulo resolver differs from ResolveShard")
+		}
+	}
+}
+
+func TestResolverBalancesByWeight(t *testing.T) {
+	ids := userIDs(40000)
+	tests := []struct {
+		strategy string
+		weights  []int
+	}{
+		{ResolverRing, uniform(5)},
+		{ResolverRing, []int{1, 2, 1, 4}},
+		{ResolverJump, uniform(5)},
+		{ResolverModulo, uniform(5)},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%v", tt.strategy, tt.weights), func(t *testing.T) {
+			r := mustResolver(t, tt.strategy, tt.weights)
+			counts := make([]int, len(tt.weights))
+			for _, id := range ids {
+				counts[r.Resolve(id)]++
+			}
+
+			total := 0
+			for _, weight := range tt.weights {
+				total += weight
+			}
+			for shard, weight := range tt.weights {
+				want := float64(weight) / float64(total)
+				got := float64(counts[shard]) / float64(len(ids))
+				if math.Abs(got-want) > 0.2*want {
+					t.Fatalf("shard %d holds %.3f of the users, want about %.3f", shard, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewResolver(t *testing.T) {
+	if r := mustResolver(t, ResolverRing, []int{1, 3}); r.String() != "ring(vnodes=160,weights=1,3)" || r.Shards() != 2 {
+		t.Fatalf("ring resolver %s over %d shards", r, r.Shards())
+	}
+	if r := mustResolver(t, "", uniform(1)); r.String() != ResolverModulo || r.Resolve("user") != 0 {
+		t.Fatalf("default resolver %s", r)
+	}
+	for _, tt := range []struct {
+		strategy string
+		weights  []int
+	}{
+		{"random", uniform(2)},
+		{ResolverRing, nil},
+		{ResolverRing, []int{1, 0}},
+		{ResolverJump, []int{1, 2}},
+		{ResolverModulo, []int{2, 1}},
+	} {
+		if _, err := NewResolver(tt.strategy, tt.weights, 0); err == nil {
+			t.Errorf("%s over %v: want an error", tt.strategy, tt.weights)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ProcessedBucket is the NATS KV bucket holding the processed-message ledger
+const ProcessedBucket = "file-service-processed"
+
+// KVLedger records processed messages as "<consumer>.<key>" entries of a KV
+// bucket. The bucket's TTL bounds how long a duplicate is recognized and
+// should exceed the stream's duplicate window and the longest redelivery.
+type KVLedger struct {
+	kv nats.KeyValue
+}
+
+// NewKVLedger creates or updates the ledger bucket with the given TTL
+func NewKVLedger(ttl time.Duration) (*KVLedger, error) {
+	if js == nil {
+		return nil, errors.New("jetstream not initialized")
+	}
+
+	cfg := &nats.KeyValueConfig{
+		Bucket:      ProcessedBucket,
+		Description: "Messages processed by file-service consumers",
+		TTL:         ttl,
+		Storage:     nats.FileStorage,
+	}
+	kv, err := js.KeyValue(ProcessedBucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(cfg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the TTL in line with the configuration; a KV bucket is the
+	// stream KV_<bucket> and its TTL the stream's MaxAge
+	info, err := js.StreamInfo("KV_" + ProcessedBucket)
+	if err == nil && info.Config.MaxAge != ttl {
+		streamCfg := info.Config
+		streamCfg.MaxAge = ttl
+		if _, err := js.UpdateStream(&streamCfg); err != nil {
+			return nil, err
+		}
+	}
+	return &KVLedger{kv: kv}, nil
+}
+
+func (l *KVLedger) Processed(consumer, key string) (bool, error) {
+	_, err := l.kv.Get(consumer + "." + key)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (l *KVLedger) Record(consumer, key string) error {
+	_, err := l.kv.Put(consumer+"."+key, []byte(time.Now().UTC().Format(time.RFC3339)))
+	return err
+}
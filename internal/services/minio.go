@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"mime"
+	"net/url"
+	"time"
 
+	"github.com/File-Sharing-BondBridg/File-Service/internal/tracing"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 )
@@ -13,11 +17,13 @@ import (
 type MinioService struct {
 	Client     *minio.Client
 	BucketName string
+	// QuarantineBucket holds infected objects until security reviews them
+	QuarantineBucket string
 }
 
 var minioInstance *MinioService
 
-func InitializeMinio(endpoint, accessKey, secretKey, bucket string, useSSL bool) error {
+func InitializeMinio(endpoint, accessKey, secretKey, bucket, quarantineBucket string, useSSL bool) error {
 	client, err := minio.New(endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
 		Secure: useSSL,
@@ -26,7 +32,24 @@ func InitializeMinio(endpoint, accessKey, secretKey, bucket string, useSSL bool)
 		return fmt.Errorf("failed to create MinIO client: %v", err)
 	}
 
-	// Create bucket if it doesn't exist
+	// Create buckets if they don't exist
+	for _, name := range []string{bucket, quarantineBucket} {
+		if err := ensureBucket(client, name); err != nil {
+			return err
+		}
+	}
+
+	minioInstance = &MinioService{
+		Client:           client,
+		BucketName:       bucket,
+		QuarantineBucket: quarantineBucket,
+	}
+
+	log.Println("Connected to MinIO successfully")
+	return nil
+}
+
+func ensureBucket(client *minio.Client, bucket string) error {
 	exists, err := client.BucketExists(context.Background(), bucket)
 	if err != nil {
 		return fmt.Errorf("failed to check bucket existence: %v", err)
@@ -39,13 +62,6 @@ func InitializeMinio(endpoint, accessKey, secretKey, bucket string, useSSL bool)
 		}
 		log.Printf("Created bucket: %s", bucket)
 	}
-
-	minioInstance = &MinioService{
-		Client:     client,
-		BucketName: bucket,
-	}
-
-	log.Println("Connected to MinIO successfully")
 	return nil
 }
 
@@ -62,10 +78,11 @@ func (m *MinioService) CheckConnection() error {
 	return err
 }
 
-func (s *MinioService) UploadFile(reader io.Reader, size int64, objectName, contentType string) error {
-	ctx := context.Background()
+func (s *MinioService) UploadFile(ctx context.Context, reader io.Reader, size int64, objectName, contentType string) (err error) {
+	span, ctx := tracing.StartMinioSpan(ctx, "PutObject", s.BucketName)
+	defer tracing.Finish(span, &err)
 
-	_, err := s.Client.PutObject(
+	_, err = s.Client.PutObject(
 		ctx,
 		s.BucketName,
 		objectName,
@@ -82,6 +99,75 @@ func (m *MinioService) DownloadFile(objectName, localFilePath string) error {
 	return m.Client.FGetObject(context.Background(), m.BucketName, objectName, localFilePath, minio.GetObjectOptions{})
 }
 
+// GetObject opens a streaming reader for an object together with its stat info.
+// The caller must close the returned object.
+func (m *MinioService) GetObject(ctx context.Context, objectName string) (*minio.Object, minio.ObjectInfo, error) {
+	return m.getObject(ctx, m.BucketName, objectName)
+}
+
+// GetQuarantinedObject opens an object in the quarantine bucket for analysis.
+func (m *MinioService) GetQuarantinedObject(ctx context.Context, objectName string) (*minio.Object, minio.ObjectInfo, error) {
+	return m.getObject(ctx, m.QuarantineBucket, objectName)
+}
+
+func (m *MinioService) getObject(ctx context.Context, bucket, objectName string) (_ *minio.Object, _ minio.ObjectInfo, err error) {
+	span, ctx := tracing.StartMinioSpan(ctx, "GetObject", bucket)
+	defer tracing.Finish(span, &err)
+
+	obj, err := m.Client.GetObject(ctx, bucket, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+
+	info, err := obj.Stat()
+	if err != nil {
+		_ = obj.Close()
+		return nil, minio.ObjectInfo{}, err
+	}
+	return obj, info, nil
+}
+
+// QuarantineObject moves an object from the files bucket into the quarantine bucket
+func (m *MinioService) QuarantineObject(ctx context.Context, objectName string) error {
+	return m.moveObject(ctx, m.BucketName, m.QuarantineBucket, objectName)
+}
+
+// ReleaseObject moves a quarantined object back into the files bucket
+func (m *MinioService) ReleaseObject(ctx context.Context, objectName string) error {
+	return m.moveObject(ctx, m.QuarantineBucket, m.BucketName, objectName)
+}
+
+func (m *MinioService) DeleteQuarantinedObject(objectName string) error {
+	return m.Client.RemoveObject(context.Background(), m.QuarantineBucket, objectName, minio.RemoveObjectOptions{})
+}
+
+// moveObject copies an object to another bucket and removes the source. It
+// is idempotent: when the source is gone but the destination exists, an
+// earlier attempt already moved the object and the move succeeds, so a
+// caller that failed to record the move can retry it.
+func (m *MinioService) moveObject(ctx context.Context, srcBucket, dstBucket, objectName string) (err error) {
+	span, ctx := tracing.StartMinioSpan(ctx, "MoveObject", dstBucket)
+	defer tracing.Finish(span, &err)
+
+	_, err = m.Client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: dstBucket, Object: objectName},
+		minio.CopySrcOptions{Bucket: srcBucket, Object: objectName},
+	)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			if _, statErr := m.Client.StatObject(ctx, dstBucket, objectName, minio.StatObjectOptions{}); statErr == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("copy %s from %s to %s: %w", objectName, srcBucket, dstBucket, err)
+	}
+
+	if err := m.Client.RemoveObject(ctx, srcBucket, objectName, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("remove %s from %s: %w", objectName, srcBucket, err)
+	}
+	return nil
+}
+
 func (m *MinioService) DeleteFile(objectName string) error {
 	return m.Client.RemoveObject(context.Background(), m.BucketName, objectName, minio.RemoveObjectOptions{})
 }
@@ -100,19 +186,38 @@ func GetContentType(extension string) string {
 		return "image/png"
 	case ".gif":
 		return "image/gif"
+	case ".webp":
+		return "image/webp"
+	case ".bmp":
+		return "image/bmp"
+	case ".svg":
+		return "image/svg+xml"
 	case ".pdf":
 		return "application/pdf"
+	case ".txt":
+		return "text/plain; charset=utf-8"
+	case ".html", ".htm":
+		return "text/html"
 	case ".mp4":
 		return "video/mp4"
+	case ".mov":
+		return "video/quicktime"
+	case ".webm":
+		return "video/webm"
 	case ".mp3":
 		return "audio/mpeg"
+	case ".wav":
+		return "audio/wav"
+	case ".ogg":
+		return "audio/ogg"
 	default:
 		return "application/octet-stream"
 	}
 }
 
-func (s *MinioService) DeleteObjectsByPrefix(prefix string) error {
-	ctx := context.Background()
+func (s *MinioService) DeleteObjectsByPrefix(ctx context.Context, prefix string) (err error) {
+	span, ctx := tracing.StartMinioSpan(ctx, "DeleteObjectsByPrefix", s.BucketName)
+	defer tracing.Finish(span, &err)
 	log.Printf("[MinIO] Starting deletion for prefix: %s (bucket: %s)", prefix, s.BucketName)
 
 	// Check bucket exists
@@ -167,3 +272,43 @@ func (s *MinioService) DeleteObjectsByPrefix(prefix string) error {
 	log.Printf("[MinIO] Successfully deleted %d objects", objectCount)
 	return nil
 }
+
+// RemoveObject deletes an object from bucket, or from the files bucket when
+// bucket is empty. Removing a missing object is not an error.
+func (m *MinioService) RemoveObject(bucket, objectName string) error {
+	if bucket == "" {
+		bucket = m.BucketName
+	}
+	return m.Client.RemoveObject(context.Background(), bucket, objectName, minio.RemoveObjectOptions{})
+}
+
+// RemoveObjects deletes objects of bucket, or of the files bucket when bucket
+// is empty, in one multi-object request per thousand names. Missing objects
+// are not an error.
+func (m *MinioService) RemoveObjects(ctx context.Context, bucket string, objectNames []string) (err error) {
+	if bucket == "" {
+		bucket = m.BucketName
+	}
+	span, ctx := tracing.StartMinioSpan(ctx, "RemoveObjects", bucket)
+	defer tracing.Finish(span, &err)
+	objectsCh := make(chan minio.ObjectInfo, len(objectNames))
+	for _, name := range objectNames {
+		objectsCh <- minio.ObjectInfo{Key: name}
+	}
+	close(objectsCh)
+
+	for removeErr := range m.Client.RemoveObjects(ctx, bucket, objectsCh, minio.RemoveObjectsOptions{}) {
+		if removeErr.Err != nil {
+			return fmt.Errorf("remove %s: %w", removeErr.ObjectName, removeErr.Err)
+		}
+	}
+	return ctx.Err()
+}
+
+// PresignedGetURL returns a URL that downloads an object of the files bucket
+// without credentials until expiry passes
+func (m *MinioService) PresignedGetURL(ctx context.Context, objectName, fileName string, expiry time.Duration) (*url.URL, error) {
+	params := url.Values{}
+	params.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	return m.Client.PresignedGetObject(ctx, m.BucketName, objectName, expiry, params)
+}
@@ -1,15 +1,35 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"log"
+	"slices"
 	"time"
 
+	"github.com/File-Sharing-BondBridg/File-Service/internal/tracing"
 	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
 )
 
+// FileEventsStream is the JetStream stream holding file and user events
+const FileEventsStream = "file-events"
+
+// fileEventSubjects are stored in FileEventsStream. They are listed instead
+// of "files.>" so that files.rpc.* requests are not captured (and acked) by
+// the stream.
+var fileEventSubjects = []string{
+	"files.uploaded",
+	"files.deleted",
+	"files.deleted.bulk",
+	"files.updated",
+	"files.quarantined",
+	"files.scan.>",
+	"files.share.>",
+	"users.>",
+}
+
 var (
 	nc  *nats.Conn
 	js  nats.JetStreamContext
@@ -67,19 +87,27 @@ func ConnectNATS(url string) (*nats.Conn, nats.JetStreamContext, error) {
 
 // ensureStreams creates streams used by the app if they don't exist
 func ensureStreams() error {
-	_, err := js.StreamInfo("file-events")
-	if err == nil {
-		log.Printf("[NATS] stream %s already exists", "file-events")
-		return nil
-	}
-
 	streamCfg := &nats.StreamConfig{
-		Name:     "file-events",
-		Subjects: []string{"files.*", "users.*"},
+		Name:     FileEventsStream,
+		Subjects: fileEventSubjects,
 		Storage:  nats.FileStorage,
 		MaxAge:   30 * 24 * time.Hour,
 	}
 
+	info, err := js.StreamInfo(streamCfg.Name)
+	if err == nil {
+		if slices.Equal(info.Config.Subjects, streamCfg.Subjects) {
+			log.Printf("[NATS] stream %s already exists", streamCfg.Name)
+			return nil
+		}
+
+		// Streams created earlier hold files.> or only single-token subjects
+		cfg := info.Config
+		cfg.Subjects = streamCfg.Subjects
+		_, err = js.UpdateStream(&cfg)
+		return err
+	}
+
 	_, err = js.AddStream(streamCfg)
 	return err
 }
@@ -106,31 +134,230 @@ func PublishEvent(subject string, payload interface{}) error {
 	return nil
 }
 
-// SubscribeEvent creates a durable, ack-based consumer.
-// handler receives the nats.Msg and is responsible to Ack() when done.
-// durableName should be unique per consumer service (e.g., "file-service-preview-consumer")
-func SubscribeEvent(subject, durableName string, handler nats.MsgHandler) (*nats.Subscription, error) {
+// PublishRaw publishes an already encoded event with the given message ID.
+// JetStream drops a second publish with the same ID within the stream's
+// duplicate window, which makes retries safe. The trace of ctx continues in
+// the consumers through the message headers.
+func PublishRaw(ctx context.Context, subject string, data []byte, msgID string) (err error) {
+	if js == nil {
+		return errors.New("jetstream not initialized")
+	}
+	msg := &nats.Msg{Subject: subject, Data: data}
+	span, _ := tracing.StartPublishSpan(ctx, msg)
+	defer tracing.Finish(span, &err)
+
+	_, err = js.PublishMsg(msg, nats.MsgId(msgID))
+	return err
+}
+
+// PullSubscribeEvent binds to the durable pull consumer created by
+// EnsurePullConsumer; callers Fetch messages at their own pace and must Ack,
+// Nak or Term each of them.
+func PullSubscribeEvent(subject, durableName string) (*nats.Subscription, error) {
 	if js == nil {
 		return nil, errors.New("jetstream not initialized")
 	}
-	// Create a durable, manual-ack subscription (pull or push? use push for simplicity)
-	sub, err := js.Subscribe(subject, func(msg *nats.Msg) {
-		// wrap handler to provide safe ack / nack handling
-		handler(msg)
-		// Note: handler should Ack() on success; otherwise implement timeout/nack logic
-	}, nats.Durable(durableName), nats.ManualAck())
+	sub, err := js.PullSubscribe(subject, durableName, nats.Bind(FileEventsStream, durableName))
 	if err != nil {
 		return nil, err
 	}
-	log.Printf("[NATS] subscribed (jetstream) subject=%s durable=%s", subject, durableName)
+	log.Printf("[NATS] pull subscribed (jetstream) subject=%s durable=%s", subject, durableName)
 	return sub, nil
 }
 
+// EnsurePullConsumer creates or updates a durable pull consumer on subject.
+// When it replaces an older consumer (e.g. a push consumer of the same
+// subject), the new one starts at the first message the old one had not
+// acknowledged and the old one is deleted; otherwise only new messages are
+// delivered, so a fresh consumer never replays the whole stream.
+func EnsurePullConsumer(subject, durableName, replaces string, maxDeliver int, ackWait time.Duration) error {
+	if js == nil {
+		return errors.New("jetstream not initialized")
+	}
+
+	_, err := js.ConsumerInfo(FileEventsStream, durableName)
+	if err == nil {
+		if _, _, err := retireConsumer(replaces); err != nil {
+			log.Printf("[NATS] failed to retire consumer %s: %v", replaces, err)
+		}
+		return UpdateConsumerLimits(durableName, maxDeliver, ackWait)
+	}
+	if !errors.Is(err, nats.ErrConsumerNotFound) {
+		return err
+	}
+
+	cfg := &nats.ConsumerConfig{
+		Durable:       durableName,
+		FilterSubject: subject,
+		AckPolicy:     nats.AckExplicitPolicy,
+		MaxDeliver:    maxDeliver,
+		AckWait:       ackWait,
+		DeliverPolicy: nats.DeliverNewPolicy,
+	}
+	startSeq, retired, err := retireConsumer(replaces)
+	if err != nil {
+		return err
+	}
+	if retired {
+		cfg.DeliverPolicy = nats.DeliverByStartSequencePolicy
+		cfg.OptStartSeq = startSeq
+	}
+
+	_, err = js.AddConsumer(FileEventsStream, cfg)
+	if errors.Is(err, nats.ErrConsumerNameAlreadyInUse) {
+		// Another replica created it first
+		return nil
+	}
+	return err
+}
+
+// retireConsumer deletes a durable consumer that has been replaced and returns
+// the first stream sequence it had not acknowledged. ok is false when the
+// consumer does not exist.
+func retireConsumer(durableName string) (startSeq uint64, ok bool, err error) {
+	if durableName == "" {
+		return 0, false, nil
+	}
+
+	info, err := js.ConsumerInfo(FileEventsStream, durableName)
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if err := js.DeleteConsumer(FileEventsStream, durableName); err != nil {
+		return 0, false, err
+	}
+	log.Printf("[NATS] retired consumer %s at stream sequence %d", durableName, info.AckFloor.Stream)
+	return info.AckFloor.Stream + 1, true, nil
+}
+
+// ConsumerLag is the backlog of a durable consumer.
+type ConsumerLag struct {
+	Consumer string `json:"consumer"`
+	// Pending messages have not been delivered yet
+	Pending uint64 `json:"pending"`
+	// AckPending messages were delivered but not acknowledged yet
+	AckPending  int `json:"ack_pending"`
+	Redelivered int `json:"redelivered"`
+	Waiting     int `json:"waiting_pulls"`
+}
+
+// GetConsumerLag reads the backlog of a durable consumer from JetStream
+func GetConsumerLag(durableName string) (ConsumerLag, error) {
+	if js == nil {
+		return ConsumerLag{}, errors.New("jetstream not initialized")
+	}
+	info, err := js.ConsumerInfo(FileEventsStream, durableName)
+	if err != nil {
+		return ConsumerLag{}, err
+	}
+	return ConsumerLag{
+		Consumer:    durableName,
+		Pending:     info.NumPending,
+		AckPending:  info.NumAckPending,
+		Redelivered: info.NumRedelivered,
+		Waiting:     info.NumWaiting,
+	}, nil
+}
+
+// UpdateConsumerLimits applies MaxDeliver and AckWait to an existing durable
+// consumer and to its replay consumer. Subscribing with options that differ
+// from the stored consumer fails, so this must run before subscribing when
+// the limits change.
+func UpdateConsumerLimits(durableName string, maxDeliver int, ackWait time.Duration) error {
+	if js == nil {
+		return errors.New("jetstream not initialized")
+	}
+
+	for _, stream := range []string{FileEventsStream, DeadLetterReplayStream} {
+		info, err := js.ConsumerInfo(stream, durableName)
+		if errors.Is(err, nats.ErrConsumerNotFound) || errors.Is(err, nats.ErrStreamNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		cfg := info.Config
+		if cfg.MaxDeliver == maxDeliver && cfg.AckWait == ackWait {
+			continue
+		}
+		cfg.MaxDeliver = maxDeliver
+		cfg.AckWait = ackWait
+		if _, err := js.UpdateConsumer(stream, &cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SubscribePlain subscribes without JetStream. Every replica receives every
+// message, which suits fan-out to local clients; nothing is redelivered.
+func SubscribePlain(subject string, handler nats.MsgHandler) (*nats.Subscription, error) {
+	if nc == nil {
+		return nil, nats.ErrConnectionClosed
+	}
+	return nc.Subscribe(subject, handler)
+}
+
 // PublishPlain publishes without JetStream (fire-and-forget).
 // Keep this for compatibility, but prefer PublishEvent for critical events.
-func PublishPlain(subject string, payload []byte) error {
+func PublishPlain(ctx context.Context, subject string, payload []byte) (err error) {
 	if nc == nil || !nc.IsConnected() {
 		return nats.ErrConnectionClosed
 	}
-	return nc.Publish(subject, payload)
+	msg := &nats.Msg{Subject: subject, Data: payload}
+	span, _ := tracing.StartPublishSpan(ctx, msg)
+	defer tracing.Finish(span, &err)
+
+	return nc.PublishMsg(msg)
+}
+
+// StreamReplay describes the part of a stream a replay saw
+type StreamReplay struct {
+	FirstSeq uint64
+	LastSeq  uint64
+	Messages int
+}
+
+// ReplayStream passes every message stored in stream, oldest first, to fn.
+// It stops at the last message stored when the replay started.
+func ReplayStream(ctx context.Context, stream string, fn func(subject string, data []byte) error) (StreamReplay, error) {
+	if js == nil {
+		return StreamReplay{}, errors.New("jetstream not initialized")
+	}
+	info, err := js.StreamInfo(stream)
+	if err != nil {
+		return StreamReplay{}, err
+	}
+	replay := StreamReplay{FirstSeq: info.State.FirstSeq, LastSeq: info.State.LastSeq}
+	if info.State.Msgs == 0 {
+		return replay, nil
+	}
+
+	sub, err := js.SubscribeSync("", nats.BindStream(stream), nats.OrderedConsumer(), nats.DeliverAll())
+	if err != nil {
+		return replay, err
+	}
+	defer func() { _ = sub.Unsubscribe() }()
+
+	for {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			return replay, err
+		}
+		meta, err := msg.Metadata()
+		if err != nil {
+			return replay, err
+		}
+		if err := fn(msg.Subject, msg.Data); err != nil {
+			return replay, err
+		}
+		replay.Messages++
+		if meta.Sequence.Stream >= replay.LastSeq {
+			return replay, nil
+		}
+	}
 }
@@ -1,14 +1,14 @@
 package query
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
 	"github.com/File-Sharing-BondBridg/File-Service/internal/services/infrastructure"
 )
 
-var postgresInstance *infrastructure.PostgresStorage
-
 // GetUserFileMetadataPage returns a paginated list of files for a user
 func GetUserFileMetadataPage(userID string, limit, offset int) ([]models.FileMetadata, error) {
 	pg := infrastructure.GetPostgresForUser(userID)
@@ -38,16 +38,25 @@ func GetUserFileStats(userID string) (models.UserFileStats, error) {
 }
 
 // GetFileMetadataForUser retrieves metadata of a file associated with a specific user based on the provided fileID and userID.
-func GetFileMetadataForUser(fileID, userID string) (models.FileMetadata, bool) {
+func GetFileMetadataForUser(ctx context.Context, fileID, userID string) (models.FileMetadata, bool) {
 	pg := infrastructure.GetPostgresForUser(userID)
-	return pg.GetFileMetadata(fileID)
+	metadata, exists := pg.GetFileMetadata(ctx, fileID)
+	// A shard holds many users; never hand out another user's file
+	if !exists || metadata.UserID != userID {
+		return models.FileMetadata{}, false
+	}
+	return metadata, true
 }
 
+// GetFileMetadata looks a file up on every shard. Prefer GetFileMetadataForUser
+// when the owner is known.
 func GetFileMetadata(fileID string) (models.FileMetadata, bool) {
-	if postgresInstance == nil {
-		return models.FileMetadata{}, false
+	for _, pg := range infrastructure.GetAllShards() {
+		if metadata, ok := pg.GetFileMetadata(context.Background(), fileID); ok {
+			return metadata, true
+		}
 	}
-	return postgresInstance.GetFileMetadata(fileID)
+	return models.FileMetadata{}, false
 }
 
 func GetFilePathsForUser(userID string) ([]string, error) {
@@ -75,3 +84,17 @@ func GetFilePathsForUser(userID string) ([]string, error) {
 
 	return paths, rows.Err()
 }
+
+// ListStalePendingFiles collects up to limit files per shard that are still
+// pending although they were last touched before the given time
+func ListStalePendingFiles(before time.Time, limit int) ([]models.FileMetadata, error) {
+	var files []models.FileMetadata
+	for _, pg := range infrastructure.GetAllShards() {
+		shardFiles, err := pg.ListStalePendingFiles(before, limit)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, shardFiles...)
+	}
+	return files, nil
+}
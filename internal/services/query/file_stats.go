@@ -0,0 +1,35 @@
+package query
+
+import (
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/infrastructure"
+)
+
+// ListFileStatsUsers pages through the users of a shard that have files or a
+// file count
+func ListFileStatsUsers(shard int, after string, limit int) ([]string, error) {
+	pg, err := infrastructure.GetShard(shard)
+	if err != nil {
+		return nil, err
+	}
+	return pg.ListFileStatsUsers(after, limit)
+}
+
+// FindFileStatsDrift returns the users of a shard whose stored file count
+// differs from their files
+func FindFileStatsDrift(shard int, userIDs []string) ([]models.FileStatsDrift, error) {
+	pg, err := infrastructure.GetShard(shard)
+	if err != nil {
+		return nil, err
+	}
+	return pg.FindFileStatsDrift(userIDs)
+}
+
+// GetFileCounts returns the stored file counts of users on a shard
+func GetFileCounts(shard int, userIDs []string) (map[string]int, error) {
+	pg, err := infrastructure.GetShard(shard)
+	if err != nil {
+		return nil, err
+	}
+	return pg.GetFileCounts(userIDs)
+}
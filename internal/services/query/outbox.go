@@ -0,0 +1,19 @@
+package query
+
+import (
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/infrastructure"
+)
+
+// GetOutboxLag returns the unpublished backlog of each shard, indexed by shard
+func GetOutboxLag() ([]models.OutboxLag, error) {
+	var lags []models.OutboxLag
+	for _, pg := range infrastructure.GetAllShards() {
+		lag, err := pg.GetOutboxLag()
+		if err != nil {
+			return nil, err
+		}
+		lags = append(lags, lag)
+	}
+	return lags, nil
+}
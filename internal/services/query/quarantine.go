@@ -0,0 +1,40 @@
+package query
+
+import (
+	"sort"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/infrastructure"
+)
+
+// ListQuarantinedFiles merges the quarantined files of all shards, most recent first
+func ListQuarantinedFiles(limit, offset int) ([]models.FileMetadata, int64, error) {
+	var files []models.FileMetadata
+	var total int64
+
+	for _, pg := range infrastructure.GetAllShards() {
+		shardFiles, err := pg.ListQuarantinedFiles(limit + offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		count, err := pg.CountQuarantinedFiles()
+		if err != nil {
+			return nil, 0, err
+		}
+		files = append(files, shardFiles...)
+		total += count
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].QuarantinedAt.After(*files[j].QuarantinedAt)
+	})
+
+	if offset >= len(files) {
+		return []models.FileMetadata{}, total, nil
+	}
+	files = files[offset:]
+	if len(files) > limit {
+		files = files[:limit]
+	}
+	return files, total, nil
+}
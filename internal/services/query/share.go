@@ -0,0 +1,33 @@
+package query
+
+import (
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/infrastructure"
+)
+
+// GetShareByToken looks the token up on every shard, since public share
+// links carry no user ID to route on.
+func GetShareByToken(token string) (models.Share, bool) {
+	for _, pg := range infrastructure.GetAllShards() {
+		if share, ok := pg.GetShareByToken(token); ok {
+			return share, true
+		}
+	}
+	return models.Share{}, false
+}
+
+func GetShareForUser(shareID, userID string) (models.Share, bool) {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.GetShareForUser(shareID, userID)
+}
+
+// GetShareAccessPage returns a page of recorded accesses for a share owned by userID
+func GetShareAccessPage(shareID, userID string, limit, offset int) ([]models.ShareAccess, error) {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.GetShareAccessPage(shareID, limit, offset)
+}
+
+func GetShareAccessStats(shareID, userID string) (models.ShareAccessStats, error) {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.GetShareAccessStats(shareID)
+}
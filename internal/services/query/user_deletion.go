@@ -0,0 +1,19 @@
+package query
+
+import (
+	"context"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/infrastructure"
+)
+
+// GetUserDeletion returns the deletion job of a user, if one was started
+func GetUserDeletion(ctx context.Context, userID string) (models.UserDeletion, bool, error) {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.GetUserDeletion(ctx, userID)
+}
+
+// ListUserFilesAfter pages through a user's files by ID
+func ListUserFilesAfter(ctx context.Context, userID, after string, limit int) ([]models.FileMetadata, error) {
+	pg := infrastructure.GetPostgresForUser(userID)
+	return pg.ListUserFilesAfter(ctx, userID, after, limit)
+}
@@ -0,0 +1,50 @@
+package query
+
+import (
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/infrastructure"
+)
+
+// ListWebhookSubscriptions returns the subscriptions of a user, or of an
+// organization when organization is set
+func ListWebhookSubscriptions(userID, organization string) ([]models.WebhookSubscription, error) {
+	pg := infrastructure.GetPostgresForUser(models.WebhookShardKey(userID, organization))
+	return pg.ListWebhookSubscriptions(userID, organization)
+}
+
+// GetWebhookSubscription looks a subscription up among those of the user and
+// of the given organizations
+func GetWebhookSubscription(id, userID string, organizations []string) (models.WebhookSubscription, bool) {
+	for _, organization := range append([]string{""}, organizations...) {
+		pg := infrastructure.GetPostgresForUser(models.WebhookShardKey(userID, organization))
+		if sub, ok := pg.GetWebhookSubscription(id, userID, organization); ok {
+			return sub, true
+		}
+	}
+	return models.WebhookSubscription{}, false
+}
+
+// MatchWebhookSubscriptions returns the enabled subscriptions that want an
+// event of a user: the user's own and those of the user's organizations
+func MatchWebhookSubscriptions(userID, eventType string) ([]models.WebhookSubscription, error) {
+	organizations, err := infrastructure.GetPostgresForUser(userID).GetOrganizationsOfUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []models.WebhookSubscription
+	for _, organization := range append([]string{""}, organizations...) {
+		pg := infrastructure.GetPostgresForUser(models.WebhookShardKey(userID, organization))
+		subs, err := pg.MatchWebhookSubscriptions(userID, organization, eventType)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, subs...)
+	}
+	return matches, nil
+}
+
+func GetWebhookDeliveryPage(sub models.WebhookSubscription, status string, limit, offset int) ([]models.WebhookDelivery, error) {
+	pg := infrastructure.GetPostgresForUser(sub.ShardKey())
+	return pg.GetWebhookDeliveryPage(sub.ID, status, limit, offset)
+}
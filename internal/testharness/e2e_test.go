@@ -0,0 +1,213 @@
+package testharness
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/rpc"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/scanner"
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+)
+
+// settle bounds how long an event takes to be relayed and consumed
+const settle = 15 * time.Second
+
+var (
+	harness    *Harness
+	harnessErr error
+)
+
+func TestMain(m *testing.M) {
+	harness, harnessErr = Start()
+	if harnessErr != nil {
+		log.Printf("End-to-end harness failed to start: %v", harnessErr)
+	}
+	code := m.Run()
+	if harness != nil {
+		harness.Close()
+	}
+	os.Exit(code)
+}
+
+func requireHarness(t *testing.T) *Harness {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("end-to-end test skipped in -short mode")
+	}
+	if errors.Is(harnessErr, ErrUnavailable) {
+		t.Skipf("skipped: %v", harnessErr)
+	}
+	if harnessErr != nil {
+		t.Fatalf("end-to-end harness: %v", harnessErr)
+	}
+	return harness
+}
+
+func TestUploadIsScanned(t *testing.T) {
+	h := requireHarness(t)
+	token := h.OIDC.Token(uuid.NewString())
+
+	clean := h.Upload(t, token, "notes.txt", []byte("hello"))
+	infected := h.Upload(t, token, "eicar.com", scanner.EICAR)
+
+	Eventually(t, settle, "the clean file to be scanned", func() bool {
+		info, _ := h.FileInfo(t, token, clean.ID)
+		return info.ScanStatus == models.ScanStatusClean
+	})
+	if _, ok := h.Objects.Object(FilesBucket, clean.FilePath); !ok {
+		t.Fatal("clean object missing")
+	}
+
+	Eventually(t, settle, "the infected file to be quarantined", func() bool {
+		info, _ := h.FileInfo(t, token, infected.ID)
+		return info.ScanStatus == models.ScanStatusInfected
+	})
+	if _, ok := h.Objects.Object(FilesBucket, infected.FilePath); ok {
+		t.Fatal("infected object left in the files bucket")
+	}
+	if _, ok := h.Objects.Object(QuarantineBucket, infected.FilePath); !ok {
+		t.Fatal("infected object not in quarantine")
+	}
+}
+
+func TestListFilesPaginates(t *testing.T) {
+	h := requireHarness(t)
+	token := h.OIDC.Token(uuid.NewString())
+
+	var uploaded []string
+	for i := range 5 {
+		uploaded = append(uploaded, h.Upload(t, token, fmt.Sprintf("file-%d.txt", i), []byte("content")).ID)
+	}
+
+	var listed []string
+	for page := 1; page <= 3; page++ {
+		var answer struct {
+			Files      []models.FileMetadata `json:"files"`
+			Total      int                   `json:"total"`
+			TotalPages int                   `json:"totalPages"`
+		}
+		if status := h.Do(t, http.MethodGet, fmt.Sprintf("/api/files?page=%d&pageSize=2", page), token, nil, "", &answer); status != http.StatusOK {
+			t.Fatalf("page %d: status %d", page, status)
+		}
+		if answer.Total != 5 || answer.TotalPages != 3 {
+			t.Fatalf("page %d: total %d in %d pages", page, answer.Total, answer.TotalPages)
+		}
+		if want := min(2, 5-2*(page-1)); len(answer.Files) != want {
+			t.Fatalf("page %d: %d files, want %d", page, len(answer.Files), want)
+		}
+		for _, file := range answer.Files {
+			listed = append(listed, file.ID)
+		}
+	}
+
+	slices.Sort(uploaded)
+	slices.Sort(listed)
+	if !slices.Equal(listed, uploaded) {
+		t.Fatalf("listed %v, uploaded %v", listed, uploaded)
+	}
+}
+
+func TestRPCListReportsScanStatus(t *testing.T) {
+	h := requireHarness(t)
+	userID := uuid.NewString()
+	token := h.OIDC.Token(userID)
+
+	infected := h.Upload(t, token, "eicar.com", scanner.EICAR)
+	Eventually(t, settle, "the infected file to be quarantined", func() bool {
+		info, _ := h.FileInfo(t, token, infected.ID)
+		return info.ScanStatus == models.ScanStatusInfected
+	})
+
+	nc, err := nats.Connect(h.NATSURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	req := nats.NewMsg(rpc.SubjectList)
+	req.Header.Set("Authorization", "Bearer "+h.OIDC.ServiceToken(RPCClient))
+	req.Data, _ = json.Marshal(rpc.ListRequest{UserID: userID})
+	reply, err := nc.RequestMsg(req, 5*time.Second)
+	if err != nil {
+		t.Fatalf("files.rpc.list: %v", err)
+	}
+	if code := reply.Header.Get("Nats-Service-Error-Code"); code != "" {
+		t.Fatalf("files.rpc.list failed with %s: %s", code, reply.Data)
+	}
+
+	var answer rpc.ListResponse
+	if err := json.Unmarshal(reply.Data, &answer); err != nil {
+		t.Fatal(err)
+	}
+	if len(answer.Files) != 1 {
+		t.Fatalf("listed %d files", len(answer.Files))
+	}
+	if file := answer.Files[0]; file.ScanStatus != models.ScanStatusInfected || !file.Quarantined || file.ScannedAt == nil {
+		t.Fatalf("listed %s with status %q, quarantined %t", file.ID, file.ScanStatus, file.Quarantined)
+	}
+}
+
+func TestDeleteFile(t *testing.T) {
+	h := requireHarness(t)
+	token := h.OIDC.Token(uuid.NewString())
+	file := h.Upload(t, token, "notes.txt", []byte("hello"))
+
+	if status := h.Do(t, http.MethodDelete, "/api/files/"+file.ID+"/delete", token, nil, "", nil); status != http.StatusOK {
+		t.Fatalf("delete: status %d", status)
+	}
+	if _, ok := h.FileInfo(t, token, file.ID); ok {
+		t.Fatal("deleted file still listed")
+	}
+	if status := h.Do(t, http.MethodDelete, "/api/files/"+file.ID+"/delete", token, nil, "", nil); status != http.StatusNotFound {
+		t.Fatalf("second delete: status %d", status)
+	}
+
+	Eventually(t, settle, "the storage cleanup to remove the object", func() bool {
+		_, ok := h.Objects.Object(FilesBucket, file.FilePath)
+		return !ok
+	})
+}
+
+func TestUserDeletedCleansUp(t *testing.T) {
+	h := requireHarness(t)
+	userID := uuid.NewString()
+	token := h.OIDC.Token(userID)
+	admin := h.OIDC.Token(uuid.NewString(), "admin")
+
+	files := []models.FileMetadata{
+		h.Upload(t, token, "a.txt", []byte("a")),
+		h.Upload(t, token, "b.txt", []byte("b")),
+	}
+
+	if err := events.Publish(context.Background(), events.UserDeleted{UserID: userID}); err != nil {
+		t.Fatalf("publish users.deleted: %v", err)
+	}
+
+	Eventually(t, settle, "the deletion job to complete", func() bool {
+		var job models.UserDeletion
+		status := h.Do(t, http.MethodGet, "/api/admin/users/"+userID+"/deletion", admin, nil, "", &job)
+		return status == http.StatusOK && job.Status == models.DeletionCompleted
+	})
+
+	if status := h.Do(t, http.MethodGet, "/api/files", token, nil, "", nil); status != http.StatusGone {
+		t.Fatalf("list files of a deleted user: status %d", status)
+	}
+	for _, file := range files {
+		if _, ok := h.Objects.Object(FilesBucket, file.FilePath); ok {
+			t.Fatalf("object %s left", file.FilePath)
+		}
+	}
+	if keys := h.Objects.Keys(FilesBucket, "users/"+userID+"/"); len(keys) > 0 {
+		t.Fatalf("user folder left: %v", keys)
+	}
+}
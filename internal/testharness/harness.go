@@ -0,0 +1,327 @@
+// Package testharness runs the service in process for end-to-end tests: the
+// full Gin router and the event consumers, against an in-memory object
+// store, a fake OIDC provider, an embedded NATS server with JetStream and
+// Postgres.
+//
+// Postgres is the one dependency that does not run in process. It is taken
+// from TEST_DATABASE_URL; every harness creates two schemas there, one per
+// shard, and drops them on Close. Without TEST_DATABASE_URL the end-to-end
+// tests are skipped.
+package testharness
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/cmd/middleware"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/api"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/user"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/api/handlers/util"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/app"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/configuration"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/models"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/scanner"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services/infrastructure"
+	"github.com/gin-gonic/gin"
+	natsserver "github.com/nats-io/nats-server/v2/server"
+)
+
+// Buckets of the object store
+const (
+	FilesBucket      = "files"
+	QuarantineBucket = "quarantine"
+)
+
+// RPCClient is the service client allowed to call files.rpc.*; see
+// OIDCProvider.ServiceToken
+const RPCClient = "harness-client"
+
+// ErrUnavailable is returned by Start when TEST_DATABASE_URL is not set. A
+// configured Postgres that cannot be reached is an ordinary error.
+var ErrUnavailable = errors.New("testharness: Postgres not configured")
+
+// Harness is a running service. The service keeps its connections in
+// package state, so only one harness can run per test binary; start it from
+// TestMain.
+type Harness struct {
+	// Server serves the Gin router of the service
+	Server  *httptest.Server
+	Objects *ObjectStore
+	OIDC    *OIDCProvider
+	// NATSURL is the embedded NATS server, e.g. for files.rpc.* requests
+	NATSURL string
+	// Scanner is the engine of the scan consumers; content containing
+	// scanner.EICAR is infected
+	Scanner *scanner.Fake
+
+	cancel  context.CancelFunc
+	cleanup []func()
+}
+
+// Start boots the service with short intervals, so events are relayed and
+// consumed within a fraction of a second
+func Start() (*Harness, error) {
+	h := &Harness{cancel: func() {}}
+	if err := h.start(); err != nil {
+		h.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *Harness) start() error {
+	natsURL, err := h.startNATS()
+	if err != nil {
+		return err
+	}
+	h.NATSURL = natsURL
+	shards, err := h.startPostgres()
+	if err != nil {
+		return err
+	}
+
+	if h.OIDC, err = NewOIDCProvider(); err != nil {
+		return err
+	}
+	h.cleanup = append(h.cleanup, h.OIDC.Close)
+	if err := middleware.InitAuth(h.OIDC.URL()); err != nil {
+		return fmt.Errorf("init auth: %w", err)
+	}
+
+	h.Objects = NewObjectStore()
+	h.cleanup = append(h.cleanup, h.Objects.Close)
+	if err := services.InitializeMinio(h.Objects.Endpoint(), "harness", "harness-secret", FilesBucket, QuarantineBucket, false); err != nil {
+		return fmt.Errorf("init object store: %w", err)
+	}
+
+	resolver, err := infrastructure.NewResolver(infrastructure.ResolverRing, []int{1, 1}, 0)
+	if err != nil {
+		return err
+	}
+	if err := infrastructure.InitializePostgresShards(shards, resolver); err != nil {
+		return fmt.Errorf("init postgres: %w", err)
+	}
+
+	cfg := configuration.Load()
+	cfg.Scan.Workers = 2
+	cfg.Scan.Timeout = 10 * time.Second
+	cfg.Scan.RetryBaseDelay = 100 * time.Millisecond
+	cfg.Scan.RetryMaxDelay = time.Second
+	cfg.RPC.Enabled = true
+	cfg.RPC.AllowedClients = RPCClient
+	cfg.Webhooks.Enabled = false
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	user.ConfigureDeletion(user.DeletionConfig{
+		BatchSize:  100,
+		Lease:      time.Minute,
+		RunTimeout: time.Minute,
+		Interval:   100 * time.Millisecond,
+		BaseDelay:  100 * time.Millisecond,
+		MaxDelay:   time.Second,
+	})
+
+	h.Scanner = &scanner.Fake{SignatureVersion: "1"}
+	if err := app.SetupNATS(natsURL, h.Scanner, cfg.Scan, cfg.Consumers, cfg.RPC, cfg.Webhooks); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	util.StartOutboxRelay(ctx, util.OutboxRelayConfig{
+		Interval:  50 * time.Millisecond,
+		BatchSize: 100,
+		BaseDelay: 100 * time.Millisecond,
+		MaxDelay:  time.Second,
+		Retention: time.Hour,
+	})
+	user.StartDeletionRunner(ctx)
+
+	gin.SetMode(gin.TestMode)
+	h.Server = httptest.NewServer(api.NewRouter())
+	h.cleanup = append(h.cleanup, h.Server.Close)
+	return nil
+}
+
+// Close stops the service and removes what Start created
+func (h *Harness) Close() {
+	h.cancel()
+	for i := len(h.cleanup) - 1; i >= 0; i-- {
+		h.cleanup[i]()
+	}
+	h.cleanup = nil
+}
+
+// startNATS runs an embedded NATS server with JetStream, storing its
+// streams in a temporary directory
+func (h *Harness) startNATS() (string, error) {
+	dir, err := os.MkdirTemp("", "testharness-nats-")
+	if err != nil {
+		return "", err
+	}
+	srv, err := natsserver.NewServer(&natsserver.Options{
+		Host:      "127.0.0.1",
+		Port:      natsserver.RANDOM_PORT,
+		JetStream: true,
+		StoreDir:  dir,
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", fmt.Errorf("create nats server: %w", err)
+	}
+	go srv.Start()
+	h.cleanup = append(h.cleanup, func() {
+		srv.Shutdown()
+		srv.WaitForShutdown()
+		_ = os.RemoveAll(dir)
+	})
+
+	if !srv.ReadyForConnections(10 * time.Second) {
+		return "", errors.New("embedded nats server did not start")
+	}
+	return srv.ClientURL(), nil
+}
+
+func (h *Harness) startPostgres() ([]string, error) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		return nil, fmt.Errorf("%w: set TEST_DATABASE_URL", ErrUnavailable)
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reach Postgres at TEST_DATABASE_URL: %w", err)
+	}
+
+	var schemas, shards []string
+	h.cleanup = append(h.cleanup, func() {
+		for _, schema := range schemas {
+			_, _ = db.Exec("DROP SCHEMA IF EXISTS " + schema + " CASCADE")
+		}
+		_ = db.Close()
+	})
+	for i := range 2 {
+		schema := fmt.Sprintf("testharness_%d_%d_shard%d", os.Getpid(), time.Now().UnixNano(), i)
+		if _, err := db.Exec("CREATE SCHEMA " + schema); err != nil {
+			return nil, fmt.Errorf("create schema: %w", err)
+		}
+		schemas = append(schemas, schema)
+		shards = append(shards, withSearchPath(dsn, schema))
+	}
+	return shards, nil
+}
+
+// withSearchPath points a connection string at schema
+func withSearchPath(dsn, schema string) string {
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		q := u.Query()
+		q.Set("search_path", schema)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return dsn + " search_path=" + schema
+}
+
+// Do sends a request to the service as the holder of token, which may be
+// empty, and decodes a JSON answer into out unless out is nil. It returns
+// the status code.
+func (h *Harness) Do(t testing.TB, method, path, token string, body io.Reader, contentType string, out any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, h.Server.URL+path, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := h.Server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decode answer: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// Upload uploads one file through POST /api/files/upload
+func (h *Harness) Upload(t testing.TB, token, name string, content []byte) models.FileMetadata {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write(content)
+	_ = form.Close()
+
+	var answer struct {
+		Results []struct {
+			Success bool                `json:"success"`
+			File    models.FileMetadata `json:"file"`
+			Error   string              `json:"error"`
+		} `json:"results"`
+	}
+	if status := h.Do(t, http.MethodPost, "/api/files/upload", token, &body, form.FormDataContentType(), &answer); status != http.StatusOK {
+		t.Fatalf("upload %s: status %d", name, status)
+	}
+	if len(answer.Results) != 1 || !answer.Results[0].Success {
+		t.Fatalf("upload %s: %+v", name, answer.Results)
+	}
+	return answer.Results[0].File
+}
+
+// FileInfo returns the metadata of GET /api/files/:id/info, and false when
+// the file is not found
+func (h *Harness) FileInfo(t testing.TB, token, fileID string) (models.FileMetadata, bool) {
+	t.Helper()
+	var answer struct {
+		File models.FileMetadata `json:"file"`
+	}
+	switch status := h.Do(t, http.MethodGet, "/api/files/"+fileID+"/info", token, nil, "", &answer); status {
+	case http.StatusOK:
+		return answer.File, true
+	case http.StatusNotFound:
+		return models.FileMetadata{}, false
+	default:
+		t.Fatalf("info of %s: status %d", fileID, status)
+		return models.FileMetadata{}, false
+	}
+}
+
+// Eventually fails the test unless cond holds within timeout
+func Eventually(t testing.TB, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(timeout); !cond(); time.Sleep(50 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out after %s waiting for %s", timeout, what)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package testharness
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ObjectStore is an in-memory stand-in for MinIO. It speaks the part of the
+// S3 API the service uses through minio-go: buckets, single-part uploads,
+// ranged reads, copies, listings and multi-object deletes. Signatures are
+// not checked.
+type ObjectStore struct {
+	server *httptest.Server
+
+	mu      sync.Mutex
+	buckets map[string]map[string]storedObject
+}
+
+type storedObject struct {
+	data        []byte
+	contentType string
+	etag        string
+	modified    time.Time
+}
+
+// NewObjectStore starts an empty object store; Close stops it
+func NewObjectStore() *ObjectStore {
+	s := &ObjectStore{buckets: map[string]map[string]storedObject{}}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Endpoint is the host:port to pass to minio.New
+func (s *ObjectStore) Endpoint() string {
+	return strings.TrimPrefix(s.server.URL, "http://")
+}
+
+func (s *ObjectStore) Close() {
+	s.server.Close()
+}
+
+// Object returns the content of an object
+func (s *ObjectStore) Object(bucket, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.buckets[bucket][key]
+	return obj.data, ok
+}
+
+// Keys lists the objects of bucket starting with prefix, in key order
+func (s *ObjectStore) Keys(bucket, prefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for key := range s.buckets[bucket] {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *ObjectStore) serve(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+
+	switch {
+	case key == "" && r.Method == http.MethodHead:
+		s.headBucket(w, bucket)
+	case key == "" && r.Method == http.MethodPut:
+		s.makeBucket(w, bucket)
+	case key == "" && r.Method == http.MethodGet && query.Has("location"):
+		writeXML(w, http.StatusOK, struct {
+			XMLName xml.Name `xml:"LocationConstraint"`
+		}{})
+	case key == "" && r.Method == http.MethodGet:
+		s.listObjects(w, bucket, query.Get("prefix"))
+	case key == "" && r.Method == http.MethodPost && query.Has("delete"):
+		s.deleteObjects(w, r, bucket)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		s.copyObject(w, r, bucket, key)
+	case r.Method == http.MethodPut:
+		s.putObject(w, r, bucket, key)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		s.getObject(w, r, bucket, key)
+	case r.Method == http.MethodDelete:
+		s.mu.Lock()
+		delete(s.buckets[bucket], key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", r.Method+" "+r.URL.String())
+	}
+}
+
+func (s *ObjectStore) headBucket(w http.ResponseWriter, bucket string) {
+	s.mu.Lock()
+	_, ok := s.buckets[bucket]
+	s.mu.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *ObjectStore) makeBucket(w http.ResponseWriter, bucket string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.buckets[bucket]; ok {
+		writeError(w, http.StatusConflict, "BucketAlreadyOwnedByYou", bucket)
+		return
+	}
+	s.buckets[bucket] = map[string]storedObject{}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *ObjectStore) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	body := io.Reader(r.Body)
+	// minio-go signs each chunk of uploads over plain HTTP
+	if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		body = &chunkedReader{r: bufio.NewReader(r.Body)}
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+
+	obj, ok := s.store(bucket, key, data, r.Header.Get("Content-Type"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", bucket)
+		return
+	}
+	w.Header().Set("ETag", obj.etag)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *ObjectStore) copyObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", err.Error())
+		return
+	}
+	srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+
+	s.mu.Lock()
+	src, ok := s.buckets[srcBucket][srcKey]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchKey", source)
+		return
+	}
+
+	obj, ok := s.store(bucket, key, src.data, src.contentType)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", bucket)
+		return
+	}
+	writeXML(w, http.StatusOK, struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		ETag         string
+		LastModified string
+	}{ETag: obj.etag, LastModified: obj.modified.Format(time.RFC3339Nano)})
+}
+
+func (s *ObjectStore) store(bucket, key string, data []byte, contentType string) (storedObject, bool) {
+	sum := md5.Sum(data)
+	obj := storedObject{
+		data:        data,
+		contentType: contentType,
+		etag:        `"` + hex.EncodeToString(sum[:]) + `"`,
+		modified:    time.Now().UTC().Truncate(time.Second),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objects, ok := s.buckets[bucket]
+	if ok {
+		objects[key] = obj
+	}
+	return obj, ok
+}
+
+func (s *ObjectStore) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	s.mu.Lock()
+	obj, ok := s.buckets[bucket][key]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchKey", key)
+		return
+	}
+
+	w.Header().Set("ETag", obj.etag)
+	if obj.contentType != "" {
+		w.Header().Set("Content-Type", obj.contentType)
+	}
+	// ServeContent answers the Range requests of minio.Object's ReadAt
+	http.ServeContent(w, r, key, obj.modified, bytes.NewReader(obj.data))
+}
+
+func (s *ObjectStore) listObjects(w http.ResponseWriter, bucket, prefix string) {
+	type content struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int64
+		StorageClass string
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		MaxKeys     int
+		IsTruncated bool
+		Contents    []content
+	}{Name: bucket, Prefix: prefix, MaxKeys: 1000}
+
+	s.mu.Lock()
+	objects, ok := s.buckets[bucket]
+	for key, obj := range objects {
+		if strings.HasPrefix(key, prefix) {
+			result.Contents = append(result.Contents, content{key, obj.modified.Format(time.RFC3339Nano), obj.etag, int64(len(obj.data)), "STANDARD"})
+		}
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", bucket)
+		return
+	}
+
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	result.KeyCount = len(result.Contents)
+	writeXML(w, http.StatusOK, result)
+}
+
+func (s *ObjectStore) deleteObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	var request struct {
+		Objects []struct {
+			Key string
+		} `xml:"Object"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	for _, obj := range request.Objects {
+		delete(s.buckets[bucket], obj.Key)
+	}
+	s.mu.Unlock()
+
+	// Quiet mode: only failures are listed
+	writeXML(w, http.StatusOK, struct {
+		XMLName xml.Name `xml:"DeleteResult"`
+	}{})
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeXML(w, status, struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: message})
+}
+
+// chunkedReader decodes an aws-chunked body: "<hex size>;chunk-signature=..."
+// lines each followed by that many bytes, up to a chunk of size 0 and
+// optional trailers
+type chunkedReader struct {
+	r         *bufio.Reader
+	remaining int
+	done      bool
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		if err := c.nextChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := c.r.Read(p[:min(len(p), c.remaining)])
+	c.remaining -= n
+	if c.remaining == 0 && err == nil {
+		// Every chunk ends with CRLF
+		_, err = c.r.Discard(2)
+	}
+	return n, err
+}
+
+func (c *chunkedReader) nextChunk() error {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("chunk header: %w", err)
+	}
+	sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+	size, err := strconv.ParseInt(sizeHex, 16, 64)
+	if err != nil {
+		return fmt.Errorf("chunk size %q: %w", sizeHex, err)
+	}
+	if size == 0 {
+		// What follows are trailers, e.g. a checksum, which are not verified
+		c.done = true
+		return nil
+	}
+	c.remaining = int(size)
+	return nil
+}
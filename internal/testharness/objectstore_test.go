@@ -0,0 +1,109 @@
+package testharness
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/services"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+func TestObjectStoreServesMinioService(t *testing.T) {
+	store := NewObjectStore()
+	defer store.Close()
+
+	client, err := minio.New(store.Endpoint(), &minio.Options{Creds: credentials.NewStaticV4("harness", "harness-secret", "")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, bucket := range []string{FilesBucket, QuarantineBucket} {
+		if err := client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{}); err != nil {
+			t.Fatalf("make %s: %v", bucket, err)
+		}
+	}
+	if exists, err := client.BucketExists(ctx, FilesBucket); err != nil || !exists {
+		t.Fatalf("bucket exists: %t, %v", exists, err)
+	}
+	m := &services.MinioService{Client: client, BucketName: FilesBucket, QuarantineBucket: QuarantineBucket}
+
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	if err := m.UploadFile(ctx, bytes.NewReader(content), int64(len(content)), "a.txt", "text/plain"); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if got, _ := store.Object(FilesBucket, "a.txt"); !bytes.Equal(got, content) {
+		t.Fatalf("stored %d bytes, want %d", len(got), len(content))
+	}
+
+	obj, info, err := m.GetObject(ctx, "a.txt")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if info.Size != int64(len(content)) || info.ContentType != "text/plain" {
+		t.Fatalf("info %+v", info)
+	}
+	part := make([]byte, 5)
+	if _, err := obj.ReadAt(part, 1003); err != nil || string(part) != "34567" {
+		t.Fatalf("ranged read %q, %v", part, err)
+	}
+	if _, err := obj.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if all, err := io.ReadAll(obj); err != nil || !bytes.Equal(all, content) {
+		t.Fatalf("read %d bytes, %v", len(all), err)
+	}
+	obj.Close()
+
+	if _, _, err := m.GetObject(ctx, "missing.txt"); minio.ToErrorResponse(err).Code != "NoSuchKey" {
+		t.Fatalf("missing object: %v", err)
+	}
+
+	if err := m.QuarantineObject(ctx, "a.txt"); err != nil {
+		t.Fatalf("quarantine: %v", err)
+	}
+	if _, ok := store.Object(FilesBucket, "a.txt"); ok {
+		t.Fatal("quarantined object still in the files bucket")
+	}
+	if got, _ := store.Object(QuarantineBucket, "a.txt"); !bytes.Equal(got, content) {
+		t.Fatal("quarantined object differs")
+	}
+	// A redelivery after a failed database write moves the object again
+	if err := m.QuarantineObject(ctx, "a.txt"); err != nil {
+		t.Fatalf("quarantine again: %v", err)
+	}
+	var missing minio.ErrorResponse
+	if err := m.QuarantineObject(ctx, "never-existed"); !errors.As(err, &missing) || missing.Code != "NoSuchKey" {
+		t.Fatalf("quarantine missing object: %v", err)
+	}
+
+	for range 2 {
+		if err := m.ReleaseObject(ctx, "a.txt"); err != nil {
+			t.Fatalf("release: %v", err)
+		}
+	}
+	if got, _ := store.Object(FilesBucket, "a.txt"); !bytes.Equal(got, content) {
+		t.Fatal("released object differs")
+	}
+	if err := m.RemoveObjects(ctx, "", []string{"a.txt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"users/u1/.init", "users/u1/b", "users/u2/.init", "c"} {
+		if err := m.UploadFile(ctx, bytes.NewReader(nil), 0, name, ""); err != nil {
+			t.Fatalf("upload %s: %v", name, err)
+		}
+	}
+	if err := m.DeleteObjectsByPrefix(ctx, "users/u1/"); err != nil {
+		t.Fatalf("delete prefix: %v", err)
+	}
+	if err := m.RemoveObjects(ctx, "", []string{"c", "never-existed"}); err != nil {
+		t.Fatalf("remove objects: %v", err)
+	}
+	if keys := store.Keys(FilesBucket, ""); len(keys) != 1 || keys[0] != "users/u2/.init" {
+		t.Fatalf("left %v", keys)
+	}
+}
@@ -0,0 +1,103 @@
+package testharness
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+// oidcKeyID names the provider's only signing key
+const oidcKeyID = "harness"
+
+// OIDCProvider is a stand-in for Keycloak: it serves the discovery document
+// and signing keys middleware.InitAuth loads, and issues tokens for any user.
+type OIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+}
+
+// NewOIDCProvider starts a provider with a fresh RSA key; Close stops it
+func NewOIDCProvider() (*OIDCProvider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	p := &OIDCProvider{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                                p.URL(),
+			"authorization_endpoint":                p.URL() + "/auth",
+			"token_endpoint":                        p.URL() + "/token",
+			"jwks_uri":                              p.URL() + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": oidcKeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	p.server = httptest.NewServer(mux)
+	return p, nil
+}
+
+// URL is the issuer URL to pass to middleware.InitAuth
+func (p *OIDCProvider) URL() string {
+	return p.server.URL
+}
+
+func (p *OIDCProvider) Close() {
+	p.server.Close()
+}
+
+// Token returns a bearer token of the frontend client for userID holding
+// the given realm roles
+func (p *OIDCProvider) Token(userID string, roles ...string) string {
+	return p.sign(map[string]any{
+		"sub":          userID,
+		"azp":          "frontend",
+		"realm_access": map[string]any{"roles": roles},
+	})
+}
+
+// ServiceToken returns a client-credentials token of another service
+func (p *OIDCProvider) ServiceToken(clientID string) string {
+	return p.sign(map[string]any{"sub": "service-account-" + clientID, "azp": clientID})
+}
+
+func (p *OIDCProvider) sign(claims map[string]any) string {
+	now := time.Now()
+	claims["iss"] = p.URL()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(time.Hour).Unix()
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": oidcKeyID})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
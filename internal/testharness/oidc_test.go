@@ -0,0 +1,50 @@
+package testharness
+
+import (
+	"context"
+	"testing"
+
+	"github.com/coreos/go-oidc"
+)
+
+func TestOIDCProviderTokensVerify(t *testing.T) {
+	p, err := NewOIDCProvider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	ctx := context.Background()
+	provider, err := oidc.NewProvider(ctx, p.URL())
+	if err != nil {
+		t.Fatalf("discovery: %v", err)
+	}
+	verifier := provider.Verifier(&oidc.Config{SkipClientIDCheck: true})
+
+	token, err := verifier.Verify(ctx, p.Token("user-1", "admin"))
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	var claims struct {
+		Sub         string `json:"sub"`
+		Azp         string `json:"azp"`
+		RealmAccess struct {
+			Roles []string `json:"roles"`
+		} `json:"realm_access"`
+	}
+	if err := token.Claims(&claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Sub != "user-1" || claims.Azp != "frontend" || len(claims.RealmAccess.Roles) != 1 || claims.RealmAccess.Roles[0] != "admin" {
+		t.Fatalf("claims %+v", claims)
+	}
+
+	other, err := NewOIDCProvider()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if _, err := verifier.Verify(ctx, other.Token("user-1")); err == nil {
+		t.Fatal("token of another provider verified")
+	}
+}
@@ -0,0 +1,134 @@
+// Package tracing carries Datadog trace context across NATS messages and
+// the outbox, and starts the spans of storage calls, so an upload, its
+// events and the work they trigger show up in one trace.
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nats-io/nats.go"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+// Service names of the storage spans, so Datadog shows them as their own services
+const (
+	PostgresService = "file-service-postgres"
+	MinioService    = "file-service-minio"
+)
+
+// Inject writes the trace context of the span in ctx to h. It does nothing
+// when ctx carries no span.
+func Inject(ctx context.Context, h nats.Header) {
+	span, ok := tracer.SpanFromContext(ctx)
+	if !ok {
+		return
+	}
+	_ = tracer.Inject(span.Context(), tracer.HTTPHeadersCarrier(http.Header(h)))
+}
+
+// Extract reads the trace context written by Inject
+func Extract(h nats.Header) (ddtrace.SpanContext, bool) {
+	if h == nil {
+		return nil, false
+	}
+	sctx, err := tracer.Extract(tracer.HTTPHeadersCarrier(http.Header(h)))
+	return sctx, err == nil
+}
+
+// Carrier returns the trace context of the span in ctx as a map, e.g. to
+// store it with an outbox message; nil when ctx carries no span
+func Carrier(ctx context.Context) map[string]string {
+	span, ok := tracer.SpanFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	carrier := tracer.TextMapCarrier{}
+	if err := tracer.Inject(span.Context(), carrier); err != nil {
+		return nil
+	}
+	return carrier
+}
+
+// StartFromCarrier starts a span continuing the trace stored by Carrier, or
+// a new trace when carrier is empty
+func StartFromCarrier(ctx context.Context, operation string, carrier map[string]string, opts ...tracer.StartSpanOption) (ddtrace.Span, context.Context) {
+	if len(carrier) > 0 {
+		if parent, err := tracer.Extract(tracer.TextMapCarrier(carrier)); err == nil {
+			opts = append(opts, tracer.ChildOf(parent))
+		}
+	}
+	return tracer.StartSpanFromContext(ctx, operation, opts...)
+}
+
+// StartConsumerSpan starts the span of a consumer handling msg. It continues
+// the trace of the publisher when the message headers carry one.
+func StartConsumerSpan(ctx context.Context, msg *nats.Msg, consumer string) (ddtrace.Span, context.Context) {
+	opts := []tracer.StartSpanOption{
+		tracer.ResourceName(msg.Subject),
+		tracer.SpanType(ext.SpanTypeMessageConsumer),
+		tracer.Tag("messaging.system", "nats"),
+		tracer.Tag("messaging.destination", msg.Subject),
+		tracer.Tag("messaging.consumer", consumer),
+	}
+	if parent, ok := Extract(msg.Header); ok {
+		opts = append(opts, tracer.ChildOf(parent))
+	}
+	return tracer.StartSpanFromContext(ctx, "nats.consume", opts...)
+}
+
+// StartPublishSpan starts the span of publishing msg; its context is
+// injected into the message headers.
+func StartPublishSpan(ctx context.Context, msg *nats.Msg) (ddtrace.Span, context.Context) {
+	span, ctx := tracer.StartSpanFromContext(ctx, "nats.publish",
+		tracer.ResourceName(msg.Subject),
+		tracer.SpanType(ext.SpanTypeMessageProducer),
+		tracer.Tag("messaging.system", "nats"),
+		tracer.Tag("messaging.destination", msg.Subject),
+	)
+	if msg.Header == nil {
+		msg.Header = nats.Header{}
+	}
+	Inject(ctx, msg.Header)
+	return span, ctx
+}
+
+// StartPostgresSpan starts the span of a Postgres query; resource names the
+// storage method, e.g. "ClaimUserDeletion"
+func StartPostgresSpan(ctx context.Context, resource string) (ddtrace.Span, context.Context) {
+	return tracer.StartSpanFromContext(ctx, "postgres.query",
+		tracer.ServiceName(PostgresService),
+		tracer.ResourceName(resource),
+		tracer.SpanType(ext.SpanTypeSQL),
+		tracer.Tag(ext.DBSystem, ext.DBSystemPostgreSQL),
+	)
+}
+
+// StartMinioSpan starts the span of a MinIO call on bucket
+func StartMinioSpan(ctx context.Context, operation, bucket string) (ddtrace.Span, context.Context) {
+	return tracer.StartSpanFromContext(ctx, "minio.request",
+		tracer.ServiceName(MinioService),
+		tracer.ResourceName(operation+" "+bucket),
+		tracer.SpanType(ext.SpanTypeHTTP),
+		tracer.Tag("aws.service", "s3"),
+		tracer.Tag("bucket", bucket),
+	)
+}
+
+// StartSpan starts a span for a unit of work within a handler, e.g. one
+// phase of a user deletion
+func StartSpan(ctx context.Context, operation, resource string) (ddtrace.Span, context.Context) {
+	return tracer.StartSpanFromContext(ctx, operation, tracer.ResourceName(resource))
+}
+
+// Finish finishes span, marking it failed when *err is set. It is meant to be
+// deferred with a pointer to a named error result.
+func Finish(span ddtrace.Span, err *error) {
+	if err != nil && *err != nil {
+		span.Finish(tracer.WithError(*err))
+		return
+	}
+	span.Finish()
+}
@@ -0,0 +1,57 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+)
+
+func TestPublishAndConsumeShareTrace(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	root, ctx := tracer.StartSpanFromContext(context.Background(), "http.request")
+	msg := &nats.Msg{Subject: "files.uploaded"}
+	publish, _ := StartPublishSpan(ctx, msg)
+	publish.Finish()
+
+	consume, _ := StartConsumerSpan(context.Background(), msg, "scan")
+	consume.Finish()
+	root.Finish()
+
+	if consume.Context().TraceID() != root.Context().TraceID() {
+		t.Fatal("consumer span started a new trace")
+	}
+	spans := mt.FinishedSpans()
+	if len(spans) != 3 || spans[1].ParentID() != publish.Context().SpanID() {
+		t.Fatalf("consumer span is not a child of the publish span: %v", spans)
+	}
+}
+
+func TestCarrierContinuesTrace(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	if Carrier(context.Background()) != nil {
+		t.Fatal("carrier without a span")
+	}
+
+	root, ctx := tracer.StartSpanFromContext(context.Background(), "http.request")
+	carrier := Carrier(ctx)
+	root.Finish()
+
+	relay, _ := StartFromCarrier(context.Background(), "outbox.relay", carrier)
+	relay.Finish()
+	if relay.Context().TraceID() != root.Context().TraceID() {
+		t.Fatal("relay span started a new trace")
+	}
+
+	orphan, _ := StartFromCarrier(context.Background(), "outbox.relay", nil)
+	orphan.Finish()
+	if orphan.Context().TraceID() == root.Context().TraceID() {
+		t.Fatal("span without carrier joined an existing trace")
+	}
+}
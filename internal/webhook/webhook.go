@@ -0,0 +1,243 @@
+// Package webhook signs and sends file events to HTTP endpoints of customers
+// that are not on NATS.
+//
+// Every request carries the event envelope as its body and three headers:
+// Webhook-Id (the event ID, stable across retries), Webhook-Timestamp (unix
+// seconds) and Webhook-Signature, "sha256=" followed by the hex HMAC-SHA256
+// of "<timestamp>.<body>" keyed with the subscription secret.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/File-Sharing-BondBridg/File-Service/internal/events"
+)
+
+const (
+	HeaderID        = "Webhook-Id"
+	HeaderTimestamp = "Webhook-Timestamp"
+	HeaderSignature = "Webhook-Signature"
+	HeaderEventType = "Webhook-Event-Type"
+
+	signaturePrefix = "sha256="
+	secretPrefix    = "whsec_"
+)
+
+// EventTypes are the subjects a subscription may ask for. Scan requests and
+// requeues are internal and never sent.
+var EventTypes = []string{
+	events.SubjectFileUploaded,
+	events.SubjectFileDeleted,
+	events.SubjectFilesDeleted,
+	events.SubjectFileUpdated,
+	events.SubjectFileQuarantined,
+	events.SubjectScanCompleted,
+	events.SubjectScanReclassified,
+	events.SubjectShareAccessed,
+}
+
+// ValidateEventTypes requires a non-empty list of known event types
+func ValidateEventTypes(types []string) error {
+	if len(types) == 0 {
+		return errors.New("event_types is required")
+	}
+	for _, t := range types {
+		if !slices.Contains(EventTypes, t) {
+			return fmt.Errorf("unknown event type %q", t)
+		}
+	}
+	return nil
+}
+
+// ValidateURL requires an absolute https URL, or http when allowInsecure is
+// set for local receivers. Unless allowPrivate is set, hosts that are
+// loopback, private, link-local or unspecified addresses are rejected; the
+// Sender checks the resolved address again when it connects.
+func ValidateURL(raw string, allowInsecure, allowPrivate bool) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return errors.New("url must be absolute")
+	}
+	if !allowPrivate {
+		host := u.Hostname()
+		if addr, err := netip.ParseAddr(host); (err == nil && forbiddenAddress(addr)) || strings.EqualFold(host, "localhost") {
+			return ErrForbiddenAddress
+		}
+	}
+	switch {
+	case u.Scheme == "https":
+		return nil
+	case u.Scheme == "http" && allowInsecure:
+		return nil
+	}
+	return errors.New("url must use https")
+}
+
+// ErrForbiddenAddress is returned for receivers that are not on the public
+// internet
+var ErrForbiddenAddress = errors.New("receiver must not be a loopback, private, link-local or unspecified address")
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// forbiddenAddress reports addresses a receiver must not have, including the
+// metadata service at 169.254.169.254
+func forbiddenAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() ||
+		addr.IsUnspecified() || sharedAddressSpace.Contains(addr)
+}
+
+// publicOnly is a net.Dialer Control that refuses connections to forbidden
+// addresses. It runs after DNS resolution for every connection, so a name
+// that resolves to a private address, or rebinds to one, is refused too.
+func publicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil || forbiddenAddress(addr) {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// NewSecret returns a random signing secret
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return secretPrefix + hex.EncodeToString(b), nil
+}
+
+// Sign returns the Webhook-Signature of body sent at timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the headers of a received webhook, as a receiver would. A
+// timestamp further than tolerance from now is rejected to limit replays.
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid timestamp")
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age > tolerance || age < -tolerance {
+		return errors.New("timestamp outside tolerance")
+	}
+	if !hmac.Equal([]byte(header.Get(HeaderSignature)), []byte(Sign(secret, timestamp, body))) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// Result describes one delivery attempt. StatusCode is 0 when no response
+// was received.
+type Result struct {
+	StatusCode int
+	Duration   time.Duration
+	Err        error
+}
+
+func (r Result) OK() bool { return r.Err == nil }
+
+// Sender POSTs signed events.
+type Sender struct {
+	Client *http.Client
+}
+
+// NewSender returns a Sender whose requests time out after timeout. Redirects
+// are not followed, so a receiver cannot bounce signed payloads elsewhere.
+// Unless allowPrivate is set, connections to loopback, private, link-local
+// and unspecified addresses are refused and no proxy is used.
+func NewSender(timeout time.Duration, allowPrivate bool) *Sender {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: publicOnly}
+		transport.DialContext = dialer.DialContext
+		transport.Proxy = nil
+	}
+	return &Sender{
+		Client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Send POSTs body to target. Any 2xx response is a success. The response body
+// is discarded, so its content never reaches the delivery log.
+func (s *Sender) Send(ctx context.Context, target, secret, eventID, eventType string, body []byte) Result {
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return Result{Err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "BondBridg-Webhooks/1.0")
+	req.Header.Set(HeaderID, eventID)
+	req.Header.Set(HeaderEventType, eventType)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(start.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(secret, start.Unix(), body))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return Result{Duration: time.Since(start), Err: err}
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+
+	result := Result{StatusCode: resp.StatusCode, Duration: time.Since(start)}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		result.Err = fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return result
+}
+
+// SubjectTest is the type of events sent by the test endpoint
+const SubjectTest = "webhook.test"
+
+// TestEvent is sent on request to check a receiver; it is never published
+// to NATS.
+type TestEvent struct {
+	SubscriptionID string    `json:"subscription_id"`
+	UserID         string    `json:"user_id"`
+	SentAt         time.Time `json:"sent_at"`
+}
+
+func (TestEvent) Subject() string { return SubjectTest }
+func (TestEvent) Version() int    { return 1 }
+func (e TestEvent) Validate() error {
+	if e.SubscriptionID == "" || e.UserID == "" {
+		return errors.New("subscription_id and user_id are required")
+	}
+	return nil
+}
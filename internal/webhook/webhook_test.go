@@ -0,0 +1,163 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testSecret = "whsec_test-secret"
+
+func TestSendSignsThePayload(t *testing.T) {
+	var got http.Header
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+		if err := Verify(testSecret, r.Header, body, time.Minute); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	payload := []byte(`{"id":"evt-1","type":"files.uploaded","data":{"file_id":"f"}}`)
+	result := NewSender(time.Second, true).Send(context.Background(), receiver.URL, testSecret, "evt-1", "files.uploaded", payload)
+
+	if !result.OK() || result.StatusCode != http.StatusNoContent {
+		t.Fatalf("result %+v", result)
+	}
+	if string(body) != string(payload) {
+		t.Fatalf("body %s", body)
+	}
+	if got.Get(HeaderID) != "evt-1" || got.Get(HeaderEventType) != "files.uploaded" {
+		t.Fatalf("headers %v", got)
+	}
+}
+
+func TestVerifyRejectsTampering(t *testing.T) {
+	body := []byte(`{"id":"evt-1"}`)
+	now := time.Now().Unix()
+	header := http.Header{}
+	header.Set(HeaderTimestamp, strconv.FormatInt(now, 10))
+	header.Set(HeaderSignature, Sign(testSecret, now, body))
+
+	if err := Verify(testSecret, header, body, time.Minute); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+	if err := Verify("whsec_other", header, body, time.Minute); err == nil {
+		t.Fatal("wrong secret accepted")
+	}
+	if err := Verify(testSecret, header, []byte(`{"id":"evt-2"}`), time.Minute); err == nil {
+		t.Fatal("changed body accepted")
+	}
+
+	old := now - 3600
+	header.Set(HeaderTimestamp, strconv.FormatInt(old, 10))
+	header.Set(HeaderSignature, Sign(testSecret, old, body))
+	if err := Verify(testSecret, header, body, time.Minute); err == nil {
+		t.Fatal("stale timestamp accepted")
+	}
+}
+
+func TestSendFailures(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/error":
+			http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+		case "/redirect":
+			http.Redirect(w, r, "/elsewhere", http.StatusFound)
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		}
+	}))
+	defer receiver.Close()
+	sender := NewSender(50*time.Millisecond, true)
+
+	for _, tc := range []struct {
+		path   string
+		status int
+		err    string
+	}{
+		{"/error", http.StatusServiceUnavailable, "status 503"},
+		{"/redirect", http.StatusFound, "status 302"},
+		{"/slow", 0, "Timeout"},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			result := sender.Send(context.Background(), receiver.URL+tc.path, testSecret, "evt-1", "files.uploaded", []byte(`{}`))
+			if result.OK() || result.StatusCode != tc.status || !strings.Contains(result.Err.Error(), tc.err) || strings.Contains(result.Err.Error(), "database") {
+				t.Fatalf("result %d %v", result.StatusCode, result.Err)
+			}
+		})
+	}
+}
+
+// The check runs when connecting, so names resolving to private addresses
+// are refused as well
+func TestSendRefusesPrivateAddresses(t *testing.T) {
+	var hits atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer receiver.Close()
+	_, port, _ := net.SplitHostPort(receiver.Listener.Addr().String())
+
+	sender := NewSender(time.Second, false)
+	for _, target := range []string{receiver.URL, "http://localhost:" + port} {
+		result := sender.Send(context.Background(), target, testSecret, "evt-1", "files.uploaded", []byte(`{}`))
+		if !errors.Is(result.Err, ErrForbiddenAddress) || result.StatusCode != 0 {
+			t.Fatalf("%s: result %d %v", target, result.StatusCode, result.Err)
+		}
+	}
+	if hits.Load() != 0 {
+		t.Fatalf("receiver reached %d times", hits.Load())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := ValidateURL("http://localhost:9000/hook", false, true); err == nil {
+		t.Error("http accepted without allowInsecure")
+	}
+	if err := ValidateURL("http://localhost:9000/hook", true, true); err != nil {
+		t.Error(err)
+	}
+	if err := ValidateURL("/hook", true, true); err == nil {
+		t.Error("relative URL accepted")
+	}
+	if err := ValidateURL("https://hooks.example.com/files", false, false); err != nil {
+		t.Error(err)
+	}
+	for _, target := range []string{
+		"https://localhost/hook",
+		"https://127.0.0.1/hook",
+		"https://10.1.2.3/hook",
+		"https://192.168.0.10/hook",
+		"https://169.254.169.254/latest/meta-data",
+		"https://[::1]/hook",
+		"https://[fe80::1]/hook",
+		"https://[::ffff:127.0.0.1]/hook",
+		"https://0.0.0.0/hook",
+	} {
+		if err := ValidateURL(target, false, false); !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("%s: %v", target, err)
+		}
+	}
+	if err := ValidateEventTypes([]string{"files.uploaded", "files.scan.completed"}); err != nil {
+		t.Error(err)
+	}
+	if err := ValidateEventTypes([]string{"files.scan.requested"}); err == nil {
+		t.Error("internal event type accepted")
+	}
+	if err := ValidateEventTypes(nil); err == nil {
+		t.Error("empty event types accepted")
+	}
+}